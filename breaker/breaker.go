@@ -0,0 +1,396 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// breaker is the circuit breaker of provider nodes. Every node of a service has a
+// breaker which is opened by consecutive failures or the error rate of a sliding
+// window, and then half opened after Config.OpenTimeout to probe the node.
+//
+//	b := breaker.NewGroup(breaker.WithServiceConfig("com.ikurento.user.UserProvider", cfg))
+//	sel := cache.NewSelector(selector.Registry(r), selector.NodeFilter(b.Available))
+//	c := client.NewClient(client.Selector(sel), client.Breaker(b), ...)
+
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+import (
+	log "github.com/AlexStocks/log4go"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/registry"
+)
+
+var (
+	ErrOpen = errors.New("circuit breaker is open")
+)
+
+//////////////////////////////////////////
+// state
+//////////////////////////////////////////
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+var stateStrings = [...]string{
+	"closed",
+	"open",
+	"half-open",
+}
+
+func (s State) String() string {
+	return stateStrings[s]
+}
+
+// Event is the state transition of the breaker of a provider node.
+type Event struct {
+	Service  string
+	Location string // ip:port of the provider
+	From     State
+	To       State
+}
+
+//////////////////////////////////////////
+// config
+//////////////////////////////////////////
+
+// Config of the breaker, its zero fields are set to the defaults.
+type Config struct {
+	// Window is the duration of the sliding window, which is split into Buckets
+	Window  time.Duration
+	Buckets int
+	// the breaker is opened if the error rate of the window reaches ErrorRate and
+	// the window has MinRequests at least, or it gets ConsecutiveFailures failures.
+	MinRequests         int
+	ErrorRate           float64
+	ConsecutiveFailures int
+	// OpenTimeout is the duration of the open state before half open
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of probe requests in half open state,
+	// the breaker is closed if all of them succeed.
+	HalfOpenRequests int
+	// IsFailure reports whether @err is a failure of the node, which counts toward the
+	// error rate & consecutive failures, and fails a probe. The default is IsNodeFailure.
+	IsFailure func(err error) bool
+}
+
+const (
+	DefaultWindow              = 10 * time.Second
+	DefaultBuckets             = 10
+	DefaultMinRequests         = 20
+	DefaultErrorRate           = 0.5
+	DefaultConsecutiveFailures = 5
+	DefaultOpenTimeout         = 5 * time.Second
+	DefaultHalfOpenRequests    = 1
+)
+
+func (c Config) withDefaults() Config {
+	if c.Window <= 0 {
+		c.Window = DefaultWindow
+	}
+	if c.Buckets <= 0 {
+		c.Buckets = DefaultBuckets
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = DefaultMinRequests
+	}
+	if c.ErrorRate <= 0 {
+		c.ErrorRate = DefaultErrorRate
+	}
+	if c.ConsecutiveFailures <= 0 {
+		c.ConsecutiveFailures = DefaultConsecutiveFailures
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = DefaultOpenTimeout
+	}
+	if c.HalfOpenRequests <= 0 {
+		c.HalfOpenRequests = DefaultHalfOpenRequests
+	}
+	if c.IsFailure == nil {
+		c.IsFailure = IsNodeFailure
+	}
+	return c
+}
+
+//////////////////////////////////////////
+// breaker of a node
+//////////////////////////////////////////
+
+type bucket struct {
+	start    time.Time
+	success  int
+	failures int
+}
+
+type nodeBreaker struct {
+	conf     Config
+	service  string
+	location string
+
+	sync.Mutex
+	state       State
+	buckets     []bucket // ring of the sliding window
+	consecutive int      // consecutive failures
+	openedAt    time.Time
+	probes      int // requests in half open state
+	probeOK     int // probes without any error
+}
+
+func newNodeBreaker(conf Config, service, location string) *nodeBreaker {
+	return &nodeBreaker{
+		conf:     conf,
+		service:  service,
+		location: location,
+		buckets:  make([]bucket, conf.Buckets),
+	}
+}
+
+// the bucket of @now, the expired buckets are reset
+func (b *nodeBreaker) bucket(now time.Time) *bucket {
+	width := b.conf.Window / time.Duration(b.conf.Buckets)
+	start := now.Truncate(width)
+	bk := &b.buckets[int(start.UnixNano()/int64(width))%len(b.buckets)]
+	if !bk.start.Equal(start) {
+		*bk = bucket{start: start}
+	}
+	return bk
+}
+
+func (b *nodeBreaker) window(now time.Time) (total, failures int) {
+	for _, bk := range b.buckets {
+		if now.Sub(bk.start) < b.conf.Window {
+			total += bk.success + bk.failures
+			failures += bk.failures
+		}
+	}
+	return
+}
+
+func (b *nodeBreaker) reset() {
+	for i := range b.buckets {
+		b.buckets[i] = bucket{}
+	}
+	b.consecutive = 0
+	b.probes = 0
+	b.probeOK = 0
+}
+
+// transit sets the state to @to and returns the event. It should be called with lock.
+func (b *nodeBreaker) transit(to State, now time.Time) *Event {
+	e := &Event{Service: b.service, Location: b.location, From: b.state, To: to}
+	b.state = to
+	b.reset()
+	if to == StateOpen {
+		b.openedAt = now
+	}
+	return e
+}
+
+// available reports whether the node can be selected now.
+func (b *nodeBreaker) available(now time.Time) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		return b.conf.OpenTimeout <= now.Sub(b.openedAt)
+	case StateHalfOpen:
+		return b.probes < b.conf.HalfOpenRequests
+	default:
+		return true
+	}
+}
+
+// acquire permits a request, which turns an open breaker into half open after OpenTimeout.
+func (b *nodeBreaker) acquire(now time.Time) (bool, *Event) {
+	var e *Event
+
+	b.Lock()
+	defer b.Unlock()
+
+	if b.state == StateOpen {
+		if now.Sub(b.openedAt) < b.conf.OpenTimeout {
+			return false, nil
+		}
+		e = b.transit(StateHalfOpen, now)
+	}
+	if b.state == StateHalfOpen {
+		if b.conf.HalfOpenRequests <= b.probes {
+			return false, e
+		}
+		b.probes++
+	}
+
+	return true, e
+}
+
+// done records the result of a request permitted by acquire.
+func (b *nodeBreaker) done(now time.Time, err error) *Event {
+	failed := b.conf.IsFailure(err)
+
+	b.Lock()
+	defer b.Unlock()
+
+	switch b.state {
+	case StateHalfOpen:
+		if failed {
+			return b.transit(StateOpen, now)
+		}
+		if err != nil {
+			// a business error says nothing about the node, so another probe is permitted
+			b.probes--
+			return nil
+		}
+		b.probeOK++
+		if b.conf.HalfOpenRequests <= b.probeOK {
+			return b.transit(StateClosed, now)
+		}
+
+	case StateClosed:
+		bk := b.bucket(now)
+		if !failed {
+			bk.success++
+			b.consecutive = 0
+			return nil
+		}
+		bk.failures++
+		b.consecutive++
+		if b.conf.ConsecutiveFailures <= b.consecutive {
+			return b.transit(StateOpen, now)
+		}
+		if total, failures := b.window(now); b.conf.MinRequests <= total &&
+			b.conf.ErrorRate <= float64(failures)/float64(total) {
+			return b.transit(StateOpen, now)
+		}
+	}
+
+	return nil
+}
+
+//////////////////////////////////////////
+// breakers of all nodes
+//////////////////////////////////////////
+
+type Options struct {
+	Config         Config            // the default config
+	ServiceConfigs map[string]Config // service interface -> config
+	OnStateChange  func(Event)
+}
+
+type Option func(*Options)
+
+// WithConfig sets the default config of all services
+func WithConfig(conf Config) Option {
+	return func(o *Options) {
+		o.Config = conf
+	}
+}
+
+// WithServiceConfig sets the config of @service, the interface name
+func WithServiceConfig(service string, conf Config) Option {
+	return func(o *Options) {
+		o.ServiceConfigs[service] = conf
+	}
+}
+
+// OnStateChange sets the callback of state transitions, which should not block.
+func OnStateChange(fn func(Event)) Option {
+	return func(o *Options) {
+		o.OnStateChange = fn
+	}
+}
+
+// Group holds the breakers of provider nodes. It is safe for concurrent use.
+type Group struct {
+	opts     Options
+	breakers *Nodes
+}
+
+func NewGroup(opts ...Option) *Group {
+	options := Options{
+		ServiceConfigs: make(map[string]Config),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return &Group{
+		opts: options,
+		breakers: NewNodes(func(service, location string) interface{} {
+			conf, ok := options.ServiceConfigs[service]
+			if !ok {
+				conf = options.Config
+			}
+			return newNodeBreaker(conf.withDefaults(), service, location)
+		}),
+	}
+}
+
+func (g *Group) breaker(service string, url *registry.ServiceURL) *nodeBreaker {
+	return g.breakers.Get(service, url.Location).(*nodeBreaker)
+}
+
+// Remove deletes the breakers of the provider @location, which has been removed from
+// the registry. It's the callback of selector.RemoveNotifier.
+func (g *Group) Remove(location string) {
+	g.breakers.Remove(location)
+}
+
+func (g *Group) notify(e *Event) {
+	if e == nil {
+		return
+	}
+	log.Warn("circuit breaker of service %s provider %s: %s -> %s", e.Service, e.Location, e.From, e.To)
+	if g.opts.OnStateChange != nil {
+		g.opts.OnStateChange(*e)
+	}
+}
+
+// State of the breaker of the provider @url of @service
+func (g *Group) State(service string, url *registry.ServiceURL) State {
+	b := g.breaker(service, url)
+	b.Lock()
+	defer b.Unlock()
+	return b.state
+}
+
+// Available reports whether the provider @url of @service can be selected,
+// it is the selector.NodeFilter of the selector.
+func (g *Group) Available(service string, url *registry.ServiceURL) bool {
+	return g.breaker(service, url).available(time.Now())
+}
+
+// Acquire permits a request to the provider @url of @service, whose result should be
+// reported by @done. It returns ErrOpen if the breaker is open.
+func (g *Group) Acquire(service string, url *registry.ServiceURL) (done func(error), err error) {
+	b := g.breaker(service, url)
+	ok, e := b.acquire(time.Now())
+	g.notify(e)
+	if !ok {
+		return nil, ErrOpen
+	}
+
+	return func(err error) {
+		g.notify(b.done(time.Now(), err))
+	}, nil
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/codec/hessian"
+	"github.com/AlexStocks/dubbogo/common"
+	"github.com/AlexStocks/dubbogo/registry"
+)
+
+const service = "com.ikurento.user.UserProvider"
+
+func TestConsecutiveFailures(t *testing.T) {
+	var events []Event
+	g := NewGroup(
+		WithServiceConfig(service, Config{ConsecutiveFailures: 3, OpenTimeout: 50 * time.Millisecond}),
+		OnStateChange(func(e Event) { events = append(events, e) }),
+	)
+	url := &registry.ServiceURL{Location: "127.0.0.1:20000"}
+	call := func(err error) error {
+		done, e := g.Acquire(service, url)
+		if e != nil {
+			return e
+		}
+		done(err)
+		return nil
+	}
+
+	oops := errors.New("oops")
+	for i := 0; i < 3; i++ {
+		call(nil)
+		call(oops)
+		call(oops)
+	}
+	// 4xx errors are not failures of the node
+	call(common.NotFound("dubbogo.client", "no such method"))
+	call(oops)
+	call(oops)
+	if s := g.State(service, url); s != StateClosed {
+		t.Fatalf("state:%s, expected closed", s)
+	}
+
+	call(oops)
+	if s := g.State(service, url); s != StateOpen || g.Available(service, url) {
+		t.Fatalf("state:%s, expected open", s)
+	}
+	if err := call(nil); err != ErrOpen {
+		t.Errorf("call() = %v, expected ErrOpen", err)
+	}
+
+	// half open: a failed probe opens it again
+	time.Sleep(60 * time.Millisecond)
+	if !g.Available(service, url) {
+		t.Errorf("the node should be available after OpenTimeout")
+	}
+	call(oops)
+	if s := g.State(service, url); s != StateOpen {
+		t.Fatalf("state:%s, expected open", s)
+	}
+
+	// a successful probe closes it
+	time.Sleep(60 * time.Millisecond)
+	call(nil)
+	if s := g.State(service, url); s != StateClosed {
+		t.Fatalf("state:%s, expected closed", s)
+	}
+
+	var transitions []State
+	for _, e := range events {
+		if e.Service != service || e.Location != url.Location {
+			t.Errorf("event:%+v", e)
+		}
+		transitions = append(transitions, e.To)
+	}
+	expected := []State{StateOpen, StateHalfOpen, StateOpen, StateHalfOpen, StateClosed}
+	if !reflect.DeepEqual(transitions, expected) {
+		t.Errorf("transitions:%v, expected:%v", transitions, expected)
+	}
+}
+
+func TestErrorRate(t *testing.T) {
+	g := NewGroup(WithConfig(Config{MinRequests: 10, ErrorRate: 0.5, ConsecutiveFailures: 100}))
+	url := &registry.ServiceURL{Location: "127.0.0.1:20000"}
+	other := &registry.ServiceURL{Location: "127.0.0.1:20001"}
+
+	for i := 0; i < 10; i++ {
+		done, err := g.Acquire(service, url)
+		if err != nil {
+			t.Fatalf("@i:%d, Acquire() = %v", i, err)
+		}
+		if i%2 == 1 {
+			done(errors.New("oops"))
+		} else {
+			done(nil)
+		}
+	}
+	if s := g.State(service, url); s != StateOpen {
+		t.Errorf("state:%s, expected open", s)
+	}
+	// the breakers of other nodes are independent
+	if s := g.State(service, other); s != StateClosed {
+		t.Errorf("state of other node:%s, expected closed", s)
+	}
+}
+
+func TestIsNodeFailure(t *testing.T) {
+	for _, c := range []struct {
+		err     error
+		failure bool
+	}{
+		{nil, false},
+		{errors.New("connection reset"), true},
+		{common.InternalServerError("dubbogo.client", "oops"), true},
+		{common.NewError("dubbogo.client", context.DeadlineExceeded.Error(), 408), true},
+		{common.NewError("dubbogo.client", fmt.Sprintf("%v", context.Canceled), 408), false},
+		{jerrors.Trace(context.Canceled), false},
+		{jerrors.Trace(hessian.ErrNullResponse), false},
+		{common.BadRequest("dubbogo.client", "encode request: oops"), false},
+	} {
+		if f := IsNodeFailure(c.err); f != c.failure {
+			t.Errorf("IsNodeFailure(%v) = %v", c.err, f)
+		}
+	}
+}
+
+func TestHalfOpenProbe(t *testing.T) {
+	g := NewGroup(WithConfig(Config{ConsecutiveFailures: 1, OpenTimeout: 10 * time.Millisecond}))
+	url := &registry.ServiceURL{Location: "127.0.0.1:20000"}
+	call := func(err error) error {
+		done, e := g.Acquire(service, url)
+		if e != nil {
+			return e
+		}
+		done(err)
+		return nil
+	}
+
+	call(errors.New("oops"))
+	time.Sleep(20 * time.Millisecond)
+	// a business error is not a successful probe, and permits another one
+	if err := call(common.NotFound("dubbogo.client", "no such user")); err != nil {
+		t.Fatalf("probe = %v", err)
+	}
+	if s := g.State(service, url); s != StateHalfOpen || !g.Available(service, url) {
+		t.Fatalf("state:%s, expected half open", s)
+	}
+	call(nil)
+	if s := g.State(service, url); s != StateClosed {
+		t.Fatalf("state:%s, expected closed", s)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	g := NewGroup(WithConfig(Config{ConsecutiveFailures: 1}))
+	url := &registry.ServiceURL{Location: "127.0.0.1:20000"}
+	other := &registry.ServiceURL{Location: "127.0.0.1:20001"}
+	done, _ := g.Acquire(service, url)
+	done(errors.New("oops"))
+	g.Available("other.Service", url)
+	g.Available(service, other)
+	if n := g.breakers.Len(); n != 3 {
+		t.Fatalf("breakers:%d", n)
+	}
+
+	g.Remove(url.Location)
+	if n := g.breakers.Len(); n != 1 {
+		t.Errorf("breakers:%d after Remove", n)
+	}
+	// the provider which comes back gets a new breaker
+	if s := g.State(service, url); s != StateClosed {
+		t.Errorf("state:%s, expected closed", s)
+	}
+}
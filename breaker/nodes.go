@@ -0,0 +1,99 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package breaker
+
+import (
+	"sync"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/codec/hessian"
+	"github.com/AlexStocks/dubbogo/common"
+)
+
+// IsNodeFailure reports whether @err is a failure of the provider node, such as a 5xx
+// error, a timeout or a broken connection. The 4xx errors, the null response of java
+// and the errors of the caller, such as the canceled context and the encoding errors,
+// are not. It's the default Config.IsFailure of this package & package limiter.
+func IsNodeFailure(err error) bool {
+	if err == nil || common.IsCanceled(err) || jerrors.Cause(err) == hessian.ErrNullResponse {
+		return false
+	}
+	return common.IsServerError(err)
+}
+
+// Nodes holds a value of every provider node of the services, such as the breakers of
+// this package and the limiters of package limiter. The values are created on demand,
+// and removed with their providers by Remove. It is safe for concurrent use.
+type Nodes struct {
+	new func(service, location string) interface{}
+
+	sync.RWMutex
+	nodes map[string]map[string]interface{} // location -> service -> value
+}
+
+// NewNodes returns the Nodes whose values are created by @new
+func NewNodes(new func(service, location string) interface{}) *Nodes {
+	return &Nodes{
+		new:   new,
+		nodes: make(map[string]map[string]interface{}),
+	}
+}
+
+// Get returns the value of the provider @location of @service
+func (n *Nodes) Get(service, location string) interface{} {
+	n.RLock()
+	v, ok := n.nodes[location][service]
+	n.RUnlock()
+	if ok {
+		return v
+	}
+
+	n.Lock()
+	defer n.Unlock()
+	services, ok := n.nodes[location]
+	if !ok {
+		services = make(map[string]interface{})
+		n.nodes[location] = services
+	}
+	if v, ok = services[service]; !ok {
+		v = n.new(service, location)
+		services[service] = v
+	}
+	return v
+}
+
+// Remove deletes the values of the provider @location of all services, it's the
+// callback of selector.RemoveNotifier.
+func (n *Nodes) Remove(location string) {
+	n.Lock()
+	delete(n.nodes, location)
+	n.Unlock()
+}
+
+// Len returns the number of the provider nodes
+func (n *Nodes) Len() int {
+	n.RLock()
+	defer n.RUnlock()
+	num := 0
+	for _, services := range n.nodes {
+		num += len(services)
+	}
+	return num
+}
@@ -0,0 +1,306 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/codec"
+	"github.com/AlexStocks/dubbogo/common"
+	"github.com/AlexStocks/dubbogo/metrics"
+)
+
+const (
+	DefaultCacheSize = 1000
+)
+
+// CacheConfig of the results of an idempotent method, like the dubbo "cache=lru".
+// A copy of the result is stored, and every hit gets a deep copy of its own.
+type CacheConfig struct {
+	// Size is the max results of the method, the least recently used one is evicted
+	// beyond it. It's DefaultCacheSize if it is 0.
+	Size int
+	// TTL of a result, the results never expire if it is 0
+	TTL time.Duration
+}
+
+type cacheEntry struct {
+	key    string
+	value  reflect.Value // the copied response, which is pointed by the response of the call
+	expire time.Time
+}
+
+// flight is the call of the first miss of a key, which the concurrent misses wait for
+type flight struct {
+	done  chan struct{}
+	value reflect.Value // the copied response, which is invalid if the call fails or it is not cached
+}
+
+// resultCache is a LRU cache of the responses of a method, the key is the service
+// config and the digest of the args.
+type resultCache struct {
+	sync.Mutex
+	service string
+	method  string
+	conf    CacheConfig
+	ll      *list.List
+	entries map[string]*list.Element
+	flights map[string]*flight
+}
+
+func newResultCache(service, method string, conf CacheConfig) *resultCache {
+	if conf.Size <= 0 {
+		conf.Size = DefaultCacheSize
+	}
+	return &resultCache{
+		service: service,
+		method:  method,
+		conf:    conf,
+		ll:      list.New(),
+		entries: make(map[string]*list.Element),
+		flights: make(map[string]*flight),
+	}
+}
+
+// newResultCaches creates the caches of @confs, service name -> method name -> config
+func newResultCaches(confs map[string]map[string]CacheConfig) map[string]map[string]*resultCache {
+	caches := make(map[string]map[string]*resultCache, len(confs))
+	for service, methods := range confs {
+		caches[service] = make(map[string]*resultCache, len(methods))
+		for method, conf := range methods {
+			caches[service][method] = newResultCache(service, method, conf)
+		}
+	}
+	return caches
+}
+
+// deepCopy returns a copy of @v which shares no pointer, map or slice with it. The
+// unexported fields of structs are copied as they are, for they can not be set.
+// @ptrs maps the copied pointers to their copies, so the cycles are copied as well.
+func deepCopy(v reflect.Value, ptrs map[uintptr]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		if c, ok := ptrs[v.Pointer()]; ok && c.Type() == v.Type() {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		ptrs[v.Pointer()] = c
+		if m, ok := v.Interface().(proto.Message); ok {
+			proto.Merge(c.Interface().(proto.Message), m)
+		} else {
+			c.Elem().Set(deepCopy(v.Elem(), ptrs))
+		}
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem(), ptrs))
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, k := range v.MapKeys() {
+			c.SetMapIndex(deepCopy(k, ptrs), deepCopy(v.MapIndex(k), ptrs))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), ptrs))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), ptrs))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if f := c.Field(i); f.CanSet() {
+				f.Set(deepCopy(v.Field(i), ptrs))
+			}
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// key of @request, whose args are not serializable if it returns an error. The type
+// of the args is a part of the key, so []T{x} and x are different.
+func (c *resultCache) key(request Request) (string, error) {
+	args := request.Args()
+	b, err := json.Marshal(args)
+	if err != nil {
+		return "", jerrors.Trace(err)
+	}
+	return request.ServiceConfig().String() + "#" + reflect.TypeOf(args).String() + "#" + codec.Digest(b), nil
+}
+
+// copyTo copies the cached response @value into @rsp
+func copyTo(value reflect.Value, rsp interface{}) bool {
+	v := reflect.ValueOf(rsp)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Type() != value.Type() {
+		return false
+	}
+	if m, ok := rsp.(proto.Message); ok {
+		proto.Reset(m)
+		proto.Merge(m, value.Interface().(proto.Message))
+		return true
+	}
+	v.Elem().Set(deepCopy(value, make(map[uintptr]reflect.Value)).Elem())
+	return true
+}
+
+// get copies the response of @key into @rsp
+func (c *resultCache) get(key string, rsp interface{}) bool {
+	var entry *cacheEntry
+
+	c.Lock()
+	if elem, ok := c.entries[key]; ok {
+		entry = elem.Value.(*cacheEntry)
+		if !entry.expire.IsZero() && time.Now().After(entry.expire) {
+			c.remove(elem)
+			entry = nil
+		} else {
+			c.ll.MoveToFront(elem)
+		}
+	}
+	c.Unlock()
+
+	ok := entry != nil && copyTo(entry.value, rsp)
+	if ok {
+		metrics.CacheHits.WithLabelValues(c.service, c.method).Inc()
+	} else {
+		metrics.CacheMisses.WithLabelValues(c.service, c.method).Inc()
+	}
+	return ok
+}
+
+// put stores a copy of the response @rsp of @key, and returns the copy, which is invalid
+// if it can not be cached.
+func (c *resultCache) put(key string, rsp interface{}) reflect.Value {
+	v := reflect.ValueOf(rsp)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return reflect.Value{}
+	}
+	entry := &cacheEntry{key: key, value: deepCopy(v, make(map[uintptr]reflect.Value))}
+	if 0 < c.conf.TTL {
+		entry.expire = time.Now().Add(c.conf.TTL)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.ll.MoveToFront(elem)
+	} else {
+		c.entries[key] = c.ll.PushFront(entry)
+	}
+	for c.conf.Size < c.ll.Len() {
+		c.remove(c.ll.Back())
+	}
+	return entry.value
+}
+
+func (c *resultCache) remove(elem *list.Element) {
+	c.ll.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// do calls @call for the miss of @key, whose concurrent misses wait for the first one
+// and share its response, like singleflight. The error is not shared, which may be the
+// timeout of the first call's own ctx.
+func (c *resultCache) do(ctx context.Context, key string, rsp interface{}, call func() error) error {
+	c.Lock()
+	if f, ok := c.flights[key]; ok {
+		c.Unlock()
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return common.NewError("dubbogo.client", ctx.Err().Error(), 408)
+		}
+		if f.value.IsValid() && copyTo(f.value, rsp) {
+			return nil
+		}
+		return call()
+	}
+	f := &flight{done: make(chan struct{})}
+	c.flights[key] = f
+	c.Unlock()
+
+	defer func() {
+		c.Lock()
+		delete(c.flights, key)
+		c.Unlock()
+		close(f.done)
+	}()
+	err := call()
+	if err == nil {
+		f.value = c.put(key, rsp)
+	}
+	return err
+}
+
+// cachedCall serves @request from the result cache of its method if there is one,
+// and caches the response of @call.
+func (c *rpcClient) cachedCall(ctx context.Context, request Request, response interface{},
+	call func() error) error {
+
+	cache := c.caches[serviceName(request)][request.Method()]
+	if cache == nil {
+		return call()
+	}
+	key, err := cache.key(request)
+	if err != nil {
+		return call()
+	}
+
+	select {
+	case <-ctx.Done():
+		return common.NewError("dubbogo.client", ctx.Err().Error(), 408)
+	default:
+	}
+	if cache.get(key, response) {
+		return nil
+	}
+
+	return cache.do(ctx, key, response, call)
+}
@@ -24,6 +24,9 @@ import (
 	"github.com/AlexStocks/dubbogo/codec"
 	"github.com/AlexStocks/dubbogo/codec/hessian"
 	"github.com/AlexStocks/dubbogo/codec/jsonrpc"
+	"github.com/AlexStocks/dubbogo/codec/protobuf"
+	"github.com/AlexStocks/dubbogo/codec/thrift"
+	"github.com/AlexStocks/dubbogo/codec/triple"
 	"github.com/AlexStocks/dubbogo/registry"
 	"github.com/AlexStocks/dubbogo/registry/zk"
 	"github.com/AlexStocks/dubbogo/selector"
@@ -38,6 +41,8 @@ type Client interface {
 	Options() Options
 	NewRequest(group, version, service, method string, args interface{}, reqOpts ...RequestOption) Request
 	Call(ctx context.Context, req Request, rsp interface{}, opts ...CallOption) error
+	// BatchCall sends all calls of @batch to @service in one round trip. Only jsonrpc supports it.
+	BatchCall(ctx context.Context, group, version, service string, batch jsonrpc.Batch, opts ...CallOption) error
 	String() string
 	Close()
 }
@@ -64,6 +69,14 @@ type (
 	RequestOption func(*RequestOptions)
 )
 
+type (
+	// CallFunc sends @req to the provider @serviceURL and decodes its reply into @rsp.
+	CallFunc func(ctx context.Context, serviceURL registry.ServiceURL, req Request, rsp interface{}) error
+	// Filter runs around every call to a provider, such as tracing, metrics, caching,
+	// mocking & auth token. It should call @next to go on with the call.
+	Filter func(ctx context.Context, serviceURL registry.ServiceURL, req Request, rsp interface{}, next CallFunc) error
+)
+
 type (
 	dubbogoClientConfig struct {
 		codecType     codec.CodecType
@@ -82,16 +95,28 @@ var (
 	DefaultPoolSize = 0
 	// DefaultPoolTTL sets the connection pool ttl
 	DefaultPoolTTL = time.Minute
+	// DefaultPoolIdleTimeout is the max idle time of a pooled connection
+	DefaultPoolIdleTimeout = time.Second * 30
+	// DefaultDrainTimeout is the max wait for the in-flight calls at Close
+	DefaultDrainTimeout = time.Second * 5
 
 	contentType2Codec = map[string]codec.NewCodec{
-		"application/json":    jsonrpc.NewCodec,
-		"application/jsonrpc": jsonrpc.NewCodec,
-		"application/dubbo":   hessian.NewCodec,
+		"application/json":       jsonrpc.NewCodec,
+		"application/jsonrpc":    jsonrpc.NewCodec,
+		"application/dubbo":      hessian.NewCodec,
+		"application/x-hessian":  hessian.NewHTTPCodec,
+		"application/x-protobuf": protobuf.NewCodec,
+		"application/x-thrift":   thrift.NewCodec,
+		"application/grpc+proto": triple.NewCodec,
 	}
 
 	codec2ContentType = map[string]string{
-		"jsonrpc": "application/json",
-		"dubbo":   "application/dubbo",
+		"jsonrpc":  "application/json",
+		"dubbo":    "application/dubbo",
+		"hessian":  "application/x-hessian",
+		"protobuf": "application/x-protobuf",
+		"thrift":   "application/x-thrift",
+		"tri":      "application/grpc+proto",
 	}
 
 	dubbogoClientConfigMap = map[codec.CodecType]dubbogoClientConfig{
@@ -108,6 +133,38 @@ var (
 			transportType: codec.TRANSPORT_TCP,
 			newTransport:  transport.NewTCPTransport,
 		},
+
+		// plain hessian servlet
+		codec.CODECTYPE_HESSIAN: dubbogoClientConfig{
+			codecType:     codec.CODECTYPE_HESSIAN,
+			newCodec:      hessian.NewHTTPCodec,
+			transportType: codec.TRANSPORT_HTTP,
+			newTransport:  transport.NewHTTPTransport,
+		},
+
+		// dubbo frame with protobuf serialization
+		codec.CODECTYPE_PROTOBUF: dubbogoClientConfig{
+			codecType:     codec.CODECTYPE_PROTOBUF,
+			newCodec:      protobuf.NewCodec,
+			transportType: codec.TRANSPORT_TCP,
+			newTransport:  transport.NewTCPTransport,
+		},
+
+		// thrift binary protocol over framed transport
+		codec.CODECTYPE_THRIFT: dubbogoClientConfig{
+			codecType:     codec.CODECTYPE_THRIFT,
+			newCodec:      thrift.NewCodec,
+			transportType: codec.TRANSPORT_TCP,
+			newTransport:  transport.NewTCPTransport,
+		},
+
+		// triple, grpc over http/2
+		codec.CODECTYPE_TRIPLE: dubbogoClientConfig{
+			codecType:     codec.CODECTYPE_TRIPLE,
+			newCodec:      triple.NewCodec,
+			transportType: codec.TRANSPORT_HTTP2,
+			newTransport:  transport.NewHTTP2Transport,
+		},
 	}
 
 	DefaultRegistries = map[string]registry.NewRegistry{
@@ -0,0 +1,674 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/codec"
+	"github.com/AlexStocks/dubbogo/common"
+	"github.com/AlexStocks/dubbogo/metrics"
+	"github.com/AlexStocks/dubbogo/registry"
+	"github.com/AlexStocks/dubbogo/selector"
+	"github.com/AlexStocks/dubbogo/transport"
+)
+
+type testRegistry struct{}
+
+func (r *testRegistry) Register(conf interface{}) error { return nil }
+func (r *testRegistry) GetServices(registry.ServiceConfigIf) ([]*registry.ServiceURL, error) {
+	return nil, nil
+}
+func (r *testRegistry) Watch() (registry.Watcher, error) { return nil, nil }
+func (r *testRegistry) Close()                           {}
+func (r *testRegistry) String() string                   { return "test-registry" }
+
+// testSelector always selects the provider @url
+type testSelector struct {
+	url registry.ServiceURL
+}
+
+func (s *testSelector) Options() selector.Options { return selector.Options{} }
+func (s *testSelector) Select(conf registry.ServiceConfigIf) (selector.Next, error) {
+	return func(ID int64) (*registry.ServiceURL, error) {
+		url := s.url
+		return &url, nil
+	}, nil
+}
+func (s *testSelector) Close() error   { return nil }
+func (s *testSelector) String() string { return "test-selector" }
+
+// startEchoProvider starts a jsonrpc provider whose methods reply "@method @param".
+// @onRequest is called with every http request if it is not nil.
+func startEchoProvider(t *testing.T, onRequest func(*http.Request)) (*httptest.Server, registry.ServiceURL) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if onRequest != nil {
+			onRequest(r)
+		}
+		var req struct {
+			ID     int64    `json:"id"`
+			Method string   `json:"method"`
+			Params []string `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("json.Decode() = %v", err)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req.ID,
+			"result":  req.Method + " " + strings.Join(req.Params, ","),
+		})
+	}))
+
+	return ts, registry.ServiceURL{
+		Protocol: "jsonrpc",
+		Location: strings.TrimPrefix(ts.URL, "http://"),
+		Ip:       "127.0.0.1",
+		Port:     ts.URL[strings.LastIndex(ts.URL, ":")+1:],
+		Path:     "/com.ikurento.Echo",
+	}
+}
+
+func TestFilters(t *testing.T) {
+	ts, url := startEchoProvider(t, nil)
+	defer ts.Close()
+
+	var trace []string
+	traceFilter := func(name string) Filter {
+		return func(ctx context.Context, serviceURL registry.ServiceURL, req Request, rsp interface{}, next CallFunc) error {
+			trace = append(trace, name+">"+serviceURL.Path)
+			err := next(ctx, serviceURL, req, rsp)
+			trace = append(trace, name+"<"+*(rsp.(*string)))
+			return err
+		}
+	}
+	mockFilter := func(ctx context.Context, serviceURL registry.ServiceURL, req Request, rsp interface{}, next CallFunc) error {
+		*(rsp.(*string)) = "mock"
+		return nil
+	}
+
+	c := NewClient(
+		CodecType(codec.CODECTYPE_JSONRPC),
+		Registry(&testRegistry{}),
+		Selector(&testSelector{url: url}),
+		Filters(traceFilter("a"), traceFilter("b")),
+	)
+	defer c.Close()
+
+	var rsp string
+	if err := c.Call(context.Background(), c.NewRequest("", "", "com.ikurento.Echo", "Hello", []string{"x"}), &rsp); err != nil {
+		t.Fatalf("Call() = %v", err)
+	}
+	expected := []string{"a>/com.ikurento.Echo", "b>/com.ikurento.Echo", "b<Hello x", "a<Hello x"}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Errorf("trace:%q", trace)
+	}
+
+	// per call filters override the default ones
+	trace, rsp = nil, ""
+	if err := c.Call(context.Background(), c.NewRequest("", "", "com.ikurento.Echo", "Hello", []string{"y"}), &rsp,
+		WithFilters(mockFilter)); err != nil || rsp != "mock" || len(trace) != 0 {
+		t.Errorf("Call(mock) = %v, rsp:%q, trace:%q", err, rsp, trace)
+	}
+	if err := c.Call(context.Background(), c.NewRequest("", "", "com.ikurento.Echo", "Hello", []string{"z"}), &rsp,
+		WithFilters()); err != nil || rsp != "Hello z" || len(trace) != 0 {
+		t.Errorf("Call(no filter) = %v, rsp:%q, trace:%q", err, rsp, trace)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	var traceparent string
+	ts, url := startEchoProvider(t, func(r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+	})
+	defer ts.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	c := NewClient(
+		CodecType(codec.CODECTYPE_JSONRPC),
+		Registry(&testRegistry{}),
+		Selector(&testSelector{url: url}),
+		TracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))),
+	)
+	defer c.Close()
+
+	var rsp string
+	if err := c.Call(context.Background(), c.NewRequest("", "", "com.ikurento.Echo", "Hello", []string{"x"}), &rsp); err != nil {
+		t.Fatalf("Call() = %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("spans:%+v", spans)
+	}
+	attempt, call := spans[0], spans[1]
+	if call.Name != "com.ikurento.Echo/Hello" || call.SpanKind != trace.SpanKindClient || call.Parent.IsValid() {
+		t.Errorf("call span:%+v", call)
+	}
+	if attempt.Parent.SpanID() != call.SpanContext.SpanID() {
+		t.Errorf("the parent of attempt span is %s rather than %s", attempt.Parent.SpanID(), call.SpanContext.SpanID())
+	}
+	var location string
+	for _, kv := range attempt.Attributes {
+		if kv.Key == attribute.Key("dubbogo.location") {
+			location = kv.Value.AsString()
+		}
+	}
+	if location != url.Location {
+		t.Errorf("attempt span location:%q", location)
+	}
+
+	if n := testutil.ToFloat64(metrics.ClientRequests.WithLabelValues("com.ikurento.Echo", "Hello", url.Location, metrics.CODE_OK)); n != 1 {
+		t.Errorf("client requests:%v", n)
+	}
+
+	// the provider receives the context of the attempt span
+	expected := "00-" + attempt.SpanContext.TraceID().String() + "-" + attempt.SpanContext.SpanID().String() + "-01"
+	if traceparent != expected {
+		t.Errorf("traceparent:%q, expected:%q", traceparent, expected)
+	}
+}
+
+func TestMethodCallOptions(t *testing.T) {
+	url, err := registry.NewServiceURL("jsonrpc://127.0.0.1:20880/com.ikurento.Echo?interface=com.ikurento.Echo" +
+		"&timeout=3000&retries=2&Hello.timeout=500")
+	if err != nil {
+		t.Fatalf("NewServiceURL() = %v", err)
+	}
+	for _, c := range []struct {
+		method  string
+		opts    CallOptions
+		timeout time.Duration
+		retries int
+	}{
+		// method param > service param > defaults
+		{"Hello", CallOptions{}, 500 * time.Millisecond, 3},
+		{"Bye", CallOptions{}, 3000 * time.Millisecond, 3},
+		// client options > url params
+		{"Hello", CallOptions{RequestTimeout: time.Second, Retries: 1}, time.Second, 1},
+		{"Hello", CallOptions{RequestTimeout: 100 * time.Millisecond}, 100 * time.Millisecond, 3},
+		{"Bye", CallOptions{RequestTimeout: time.Second, Retries: 5}, time.Second, 5},
+	} {
+		opts := methodCallOptions(c.opts, url, c.method)
+		if opts.RequestTimeout != c.timeout || opts.Retries != c.retries {
+			t.Errorf("methodCallOptions(%s, %+v) = {timeout:%v, retries:%d}, expected:{timeout:%v, retries:%d}",
+				c.method, c.opts, opts.RequestTimeout, opts.Retries, c.timeout, c.retries)
+		}
+	}
+
+	// the defaults are used if neither the client nor the url sets them
+	if opts := methodCallOptions(CallOptions{}, &registry.ServiceURL{}, "Hello"); opts.RequestTimeout != DefaultRequestTimeout ||
+		opts.Retries != DefaultRetries {
+		t.Errorf("methodCallOptions(no params) = %+v", opts)
+	}
+
+	// per call > method > client default > url params
+	c := NewClient(
+		CodecType(codec.CODECTYPE_JSONRPC),
+		Registry(&testRegistry{}),
+		Selector(&testSelector{url: *url}),
+		Retries(2),
+		RequestTimeout(2*time.Second),
+		MethodCallOptions("com.ikurento.Echo", "Hello", WithRetries(4)),
+	).(*rpcClient)
+	defer c.Close()
+	hello := c.NewRequest("", "", "com.ikurento.Echo", "Hello", nil)
+	bye := c.NewRequest("", "", "com.ikurento.Echo", "Bye", nil)
+	for _, tc := range []struct {
+		opts    CallOptions
+		timeout time.Duration
+		retries int
+	}{
+		{methodCallOptions(c.callOptions(hello), url, "Hello"), 2 * time.Second, 4},
+		{methodCallOptions(c.callOptions(hello, WithRetries(1)), url, "Hello"), 2 * time.Second, 1},
+		{methodCallOptions(c.callOptions(hello, WithRequestTimeout(time.Second)), url, "Hello"), time.Second, 4},
+		{methodCallOptions(c.callOptions(bye), url, "Bye"), 2 * time.Second, 2},
+	} {
+		if tc.opts.RequestTimeout != tc.timeout || tc.opts.Retries != tc.retries {
+			t.Errorf("call options:%+v, expected:{timeout:%v, retries:%d}", tc.opts, tc.timeout, tc.retries)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	ts, url := startEchoProvider(t, nil)
+	defer ts.Close()
+
+	var (
+		entered = make(chan struct{})
+		blocked = make(chan struct{})
+		closed  = make(chan struct{})
+	)
+	blockFilter := func(ctx context.Context, serviceURL registry.ServiceURL, req Request, rsp interface{}, next CallFunc) error {
+		entered <- struct{}{}
+		<-blocked
+		return next(ctx, serviceURL, req, rsp)
+	}
+	c := NewClient(
+		CodecType(codec.CODECTYPE_JSONRPC),
+		Registry(&testRegistry{}),
+		Selector(&testSelector{url: url}),
+		Filters(blockFilter),
+	)
+
+	done := make(chan error)
+	var rsp string
+	go func() {
+		done <- c.Call(context.Background(), c.NewRequest("", "", "com.ikurento.Echo", "Hello", []string{"x"}), &rsp)
+	}()
+	<-entered
+	go func() {
+		c.Close()
+		close(closed)
+	}()
+
+	// new calls are rejected, and the in-flight one is drained
+	time.Sleep(20 * time.Millisecond)
+	err := c.Call(context.Background(), c.NewRequest("", "", "com.ikurento.Echo", "Hello", []string{"y"}), new(string))
+	if e, ok := err.(*common.Error); !ok || e.Code != http.StatusServiceUnavailable {
+		t.Errorf("Call() after Close = %v", err)
+	}
+	select {
+	case <-closed:
+		t.Fatalf("the client is closed with an in-flight call")
+	default:
+	}
+	close(blocked)
+	if err = <-done; err != nil || rsp != "Hello x" {
+		t.Errorf("Call() = %v, rsp:%q", err, rsp)
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatalf("the client is not closed")
+	}
+}
+
+// testConn is a transport.Client whose validity is set by the test
+type testConn struct {
+	transport.Client
+	sync.Mutex
+	invalid bool
+	closed  bool
+}
+
+func (c *testConn) Valid() bool {
+	c.Lock()
+	defer c.Unlock()
+	return !c.invalid
+}
+
+func (c *testConn) Close() error {
+	c.Lock()
+	c.closed = true
+	c.Unlock()
+	return nil
+}
+
+type testTransport struct {
+	transport.Transport
+	sync.Mutex
+	conns []*testConn
+}
+
+func (t *testTransport) Dial(addr string, opts ...transport.DialOption) (transport.Client, error) {
+	t.Lock()
+	defer t.Unlock()
+	c := &testConn{}
+	t.conns = append(t.conns, c)
+	return c, nil
+}
+
+func TestPool(t *testing.T) {
+	var (
+		tr  = &testTransport{}
+		ctx = context.Background()
+	)
+	p := newPool(Options{PoolSize: 1, PoolMaxActive: 1, PoolWaitTimeout: 20 * time.Millisecond})
+	defer p.close()
+
+	get := func() (*poolConn, error) {
+		return p.getConn(ctx, "jsonrpc", "127.0.0.1:1", "/com.ikurento.Echo", tr, time.Second)
+	}
+	c1, err := get()
+	if err != nil {
+		t.Fatalf("getConn() = %v", err)
+	}
+
+	// wait until PoolWaitTimeout
+	if _, err = get(); err != errPoolTimeout {
+		t.Errorf("getConn() with PoolMaxActive connections = %v", err)
+	}
+	// the canceled call is not the pool wait timeout
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = p.getConn(canceled, "jsonrpc", "127.0.0.1:1", "/com.ikurento.Echo", tr, time.Second); err != context.Canceled {
+		t.Errorf("getConn() with canceled ctx = %v", err)
+	}
+	// the waiter gets the released connection
+	got := make(chan *poolConn)
+	go func() {
+		c, _ := get()
+		got <- c
+	}()
+	time.Sleep(5 * time.Millisecond)
+	p.release(c1, nil)
+	if c := <-got; c != c1 {
+		t.Errorf("the waiter gets %p, not the released %p", c, c1)
+	}
+
+	// the invalid idle connection is replaced
+	p.release(c1, nil)
+	tr.conns[0].invalid = true
+	c2, err := get()
+	if err != nil || c2 == c1 || !tr.conns[0].closed {
+		t.Errorf("getConn() = %v, the invalid connection is reused or not closed", err)
+	}
+	p.release(c2, nil)
+
+	stats := p.stats()["jsonrpc://127.0.0.1:1//com.ikurento.Echo"]
+	if stats.Active != 1 || stats.Idle != 1 || stats.Hits != 1 || stats.Misses != 2 ||
+		stats.Timeouts != 1 || stats.Evictions != 1 {
+		t.Errorf("stats:%+v", stats)
+	}
+
+	// the connections of the removed provider are closed
+	p.remove("127.0.0.1:1")
+	if !tr.conns[1].closed || len(p.stats()) != 0 {
+		t.Errorf("the connections of the removed provider are not closed, stats:%+v", p.stats())
+	}
+}
+
+// the connection to the provider is reused by the calls
+func TestPoolReuse(t *testing.T) {
+	var (
+		lock  sync.Mutex
+		addrs = make(map[string]struct{})
+	)
+	ts, url := startEchoProvider(t, func(r *http.Request) {
+		lock.Lock()
+		addrs[r.RemoteAddr] = struct{}{}
+		lock.Unlock()
+	})
+	defer ts.Close()
+
+	c := NewClient(
+		CodecType(codec.CODECTYPE_JSONRPC),
+		Registry(&testRegistry{}),
+		Selector(&testSelector{url: url}),
+		PoolSize(1),
+	)
+	defer c.Close()
+
+	for i := 0; i < 3; i++ {
+		var rsp string
+		if err := c.Call(context.Background(), c.NewRequest("", "", "com.ikurento.Echo", "Hello", []string{"x"}), &rsp); err != nil {
+			t.Fatalf("Call() = %v", err)
+		}
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(addrs) != 1 {
+		t.Errorf("the calls use %d connections", len(addrs))
+	}
+	for key, s := range c.(PoolStatsReporter).PoolStats() {
+		if s.Hits != 2 || s.Misses != 1 || s.Idle != 1 {
+			t.Errorf("%s stats:%+v", key, s)
+		}
+	}
+}
+
+// configRegistry provides the params of every service config
+type configRegistry struct {
+	testRegistry
+	params url.Values
+}
+
+func (r *configRegistry) Config(registry.ServiceConfigIf) url.Values { return r.params }
+
+type echoMock struct{}
+
+func (echoMock) Hello(ctx context.Context, args []string, rsp *string) error {
+	*rsp = "mock " + strings.Join(args, ",")
+	return nil
+}
+
+func TestMock(t *testing.T) {
+	var calls int32
+	ts, upURL := startEchoProvider(t, func(*http.Request) { atomic.AddInt32(&calls, 1) })
+	defer ts.Close()
+	down, downURL := startEchoProvider(t, nil)
+	down.Close()
+
+	reg := &configRegistry{params: url.Values{}}
+	sel := &testSelector{url: upURL}
+	c := NewClient(
+		CodecType(codec.CODECTYPE_JSONRPC),
+		Registry(reg),
+		Selector(sel),
+		Mock("com.ikurento.Echo", echoMock{}),
+	)
+	defer c.Close()
+
+	// the business error of the provider
+	bizErr := func(ctx context.Context, serviceURL registry.ServiceURL, req Request, rsp interface{}, next CallFunc) error {
+		if err := next(ctx, serviceURL, req, rsp); err != nil {
+			return err
+		}
+		return common.BadRequest("dubbogo.server", "invalid name")
+	}
+	for _, tc := range []struct {
+		mock  string
+		down  bool
+		biz   bool
+		rsp   string
+		err   bool
+		calls int32
+	}{
+		{mock: `force:return "forced"`, rsp: "forced"},
+		{mock: "force", rsp: "mock x"},
+		{mock: "force:throw", err: true},
+		{mock: "fail:return null", rsp: "Hello x", calls: 1},
+		{mock: "fail:return null", down: true, rsp: ""},
+		{mock: "fail", down: true, rsp: "mock x"},
+		{mock: "return \"failed\"", down: true, rsp: "failed"},
+		{mock: "fail:throw", down: true, err: true},
+		{mock: `fail:return "failed"`, biz: true, err: true, calls: 1},
+	} {
+		reg.params.Set("mock", tc.mock)
+		sel.url = upURL
+		if tc.down {
+			sel.url = downURL
+		}
+		atomic.StoreInt32(&calls, 0)
+
+		opts := []CallOption{WithRetries(1)}
+		if tc.biz {
+			opts = append(opts, WithFilters(bizErr))
+		}
+		rsp := "unset"
+		err := c.Call(context.Background(), c.NewRequest("", "", "com.ikurento.Echo", "Hello", []string{"x"}), &rsp,
+			opts...)
+		if (err != nil) != tc.err || (!tc.err && rsp != tc.rsp) || atomic.LoadInt32(&calls) != tc.calls {
+			t.Errorf("Call(mock:%q, down:%v) = %v, rsp:%q, calls:%d", tc.mock, tc.down, err, rsp, calls)
+		}
+	}
+}
+
+// the static mock of the service config works without the registry.Configurator
+func TestStaticMock(t *testing.T) {
+	ts, url := startEchoProvider(t, nil)
+	defer ts.Close()
+
+	c := NewClient(
+		CodecType(codec.CODECTYPE_JSONRPC),
+		Registry(&testRegistry{}),
+		Selector(&testSelector{url: url}),
+		ServiceConfigs(registry.ServiceConfig{Protocol: "jsonrpc", Service: "com.ikurento.Echo",
+			Mock: `force:return "static"`}),
+	)
+	defer c.Close()
+
+	var rsp string
+	err := c.Call(context.Background(), c.NewRequest("", "", "com.ikurento.Echo", "Hello", []string{"x"}), &rsp)
+	if err != nil || rsp != "static" {
+		t.Errorf("Call() = %v, rsp:%q", err, rsp)
+	}
+}
+
+func TestCache(t *testing.T) {
+	var calls int32
+	ts, url := startEchoProvider(t, func(*http.Request) { atomic.AddInt32(&calls, 1) })
+	defer ts.Close()
+
+	c := NewClient(
+		CodecType(codec.CODECTYPE_JSONRPC),
+		Registry(&testRegistry{}),
+		Selector(&testSelector{url: url}),
+		Cache("com.ikurento.Echo", "Get", CacheConfig{Size: 2, TTL: 100 * time.Millisecond}),
+	)
+	defer c.Close()
+
+	call := func(ctx context.Context, method, arg string, expectedCalls int32) {
+		var rsp string
+		err := c.Call(ctx, c.NewRequest("", "", "com.ikurento.Echo", method, []string{arg}), &rsp)
+		if ctx.Err() == nil && (err != nil || rsp != method+" "+arg) {
+			t.Errorf("Call(%s, %s) = %v, rsp:%q", method, arg, err, rsp)
+		}
+		if ctx.Err() != nil && err == nil {
+			t.Errorf("Call(%s, %s) with canceled ctx = nil", method, arg)
+		}
+		if n := atomic.LoadInt32(&calls); n != expectedCalls {
+			t.Errorf("Call(%s, %s): calls:%d, expected:%d", method, arg, n, expectedCalls)
+		}
+	}
+
+	call(context.Background(), "Get", "x", 1)
+	call(context.Background(), "Get", "x", 1)
+	call(context.Background(), "Get", "y", 2)
+	call(context.Background(), "Get", "z", 3)
+	call(context.Background(), "Get", "x", 4) // evicted by z
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	call(canceled, "Get", "x", 4)
+	time.Sleep(150 * time.Millisecond)
+	call(context.Background(), "Get", "x", 5) // expired
+	call(context.Background(), "Hello", "x", 6)
+	call(context.Background(), "Hello", "x", 7)
+
+	if n := testutil.ToFloat64(metrics.CacheHits.WithLabelValues("com.ikurento.Echo", "Get")); n != 1 {
+		t.Errorf("cache hits:%v", n)
+	}
+	if n := testutil.ToFloat64(metrics.CacheMisses.WithLabelValues("com.ikurento.Echo", "Get")); n != 5 {
+		t.Errorf("cache misses:%v", n)
+	}
+}
+
+// every hit of the cache gets a copy of its own
+func TestCacheCopy(t *testing.T) {
+	cache := newResultCache("com.ikurento.Echo", "Get", CacheConfig{})
+	cache.put("k", &map[string][]string{"a": {"x"}})
+
+	var rsp map[string][]string
+	if !cache.get("k", &rsp) || !reflect.DeepEqual(rsp, map[string][]string{"a": {"x"}}) {
+		t.Fatalf("get() = %v", rsp)
+	}
+	rsp["a"][0] = "y"
+	rsp["b"] = nil
+	var again map[string][]string
+	if !cache.get("k", &again) || !reflect.DeepEqual(again, map[string][]string{"a": {"x"}}) {
+		t.Errorf("get() after the mutation of a hit = %v", again)
+	}
+
+	// the dynamic types of the interfaces are kept, which json can not encode or decode
+	type reply struct {
+		ID    interface{}
+		Attrs map[interface{}]interface{}
+		Next  *reply
+	}
+	miss := &reply{ID: int64(1), Attrs: map[interface{}]interface{}{int32(1): []interface{}{"a", 2.5}}}
+	miss.Next = miss
+	cache.put("reply", miss)
+	var hit reply
+	if !cache.get("reply", &hit) || !reflect.DeepEqual(&hit, miss) {
+		t.Errorf("get() = %#v, expected:%#v", hit, *miss)
+	}
+	miss.Attrs[int32(1)].([]interface{})[0] = "b"
+	if hit.Attrs[int32(1)].([]interface{})[0] != "a" || hit.Next.Next != hit.Next {
+		t.Errorf("get() = %#v after the mutation of the miss", hit)
+	}
+
+	k1, _ := cache.key(newRPCRequest("", "jsonrpc", "", "com.ikurento.Echo", "Get", []string{"x"}, ""))
+	k2, _ := cache.key(newRPCRequest("", "jsonrpc", "", "com.ikurento.Echo", "Get", "x", ""))
+	if k1 == k2 {
+		t.Errorf("the keys of []string{x} and x are the same %q", k1)
+	}
+}
+
+// the concurrent misses of the same args share one call
+func TestCacheSingleflight(t *testing.T) {
+	var calls int32
+	ts, url := startEchoProvider(t, func(*http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+	})
+	defer ts.Close()
+
+	c := NewClient(
+		CodecType(codec.CODECTYPE_JSONRPC),
+		Registry(&testRegistry{}),
+		Selector(&testSelector{url: url}),
+		Cache("com.ikurento.Echo", "Get", CacheConfig{}),
+	)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var rsp string
+			err := c.Call(context.Background(), c.NewRequest("", "", "com.ikurento.Echo", "Get", []string{"x"}), &rsp)
+			if err != nil || rsp != "Get x" {
+				t.Errorf("Call() = %v, rsp:%q", err, rsp)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("calls:%d", n)
+	}
+}
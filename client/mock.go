@@ -0,0 +1,156 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/breaker"
+	"github.com/AlexStocks/dubbogo/common"
+	"github.com/AlexStocks/dubbogo/registry"
+)
+
+var typeOfError = reflect.TypeOf((*error)(nil)).Elem()
+
+// mock of a service, which is parsed from the "mock" param of its config:
+// "force:return <json>" & "force:throw [message]" short-circuit the calls;
+// "fail:return <json>", "fail:throw [message]" or "return <json>" replace the calls failed
+// by the RpcException, see mockable;
+// "force" & "fail" ("true") call the mock implementation of Options.Mocks instead.
+type mock struct {
+	force  bool   // mock without calling the providers
+	action string // "return <json>", "throw [message]", or "" for the mock implementation
+}
+
+func parseMock(s string) *mock {
+	m := &mock{action: strings.TrimSpace(s)}
+	switch {
+	case len(m.action) == 0 || m.action == "false":
+		return nil
+	case strings.HasPrefix(m.action, "force"):
+		m.force = true
+		m.action = strings.TrimPrefix(m.action, "force")
+	case strings.HasPrefix(m.action, "fail"):
+		m.action = strings.TrimPrefix(m.action, "fail")
+	}
+	m.action = strings.TrimSpace(strings.TrimPrefix(m.action, ":"))
+	if m.action == "true" || m.action == "default" {
+		m.action = ""
+	}
+	return m
+}
+
+// mock of @request from the static service config of Options.ServiceConfigs, which is
+// overridden by the registry.Configurator, such as the zookeeper configurators.
+func (c *rpcClient) mock(request Request) *mock {
+	var s string
+	if conf, ok := request.ServiceConfig().(*registry.ServiceConfig); ok {
+		s = c.opts.ServiceConfigs[conf.Key()].Mock
+	}
+	if conf, ok := c.opts.Registry.(registry.Configurator); ok {
+		if params := conf.Config(request.ServiceConfig()); params.Get("mock") != "" {
+			s = params.Get("mock")
+		}
+	}
+	return parseMock(s)
+}
+
+// mockable reports whether the failed call of @err is replaced by the mock of "fail", which
+// is a RpcException of dubbo, such as a failure of the provider node, no provider, or the
+// rejection of the limiter. The business errors & the null response of java are not.
+func mockable(err error) bool {
+	if breaker.IsNodeFailure(err) {
+		return true
+	}
+	e, ok := jerrors.Cause(err).(*common.Error)
+	return ok && e.ID == "dubbogo.client" &&
+		(e.Code == http.StatusNotFound || e.Code == http.StatusTooManyRequests)
+}
+
+// invokeMock sets @response by the mock @m of @request
+func (c *rpcClient) invokeMock(ctx context.Context, m *mock, request Request, response interface{}) error {
+	switch {
+	case strings.HasPrefix(m.action, "return"):
+		return mockReturn(strings.TrimSpace(strings.TrimPrefix(m.action, "return")), response)
+
+	case strings.HasPrefix(m.action, "throw"):
+		msg := strings.TrimSpace(strings.TrimPrefix(m.action, "throw"))
+		if len(msg) == 0 {
+			msg = fmt.Sprintf("mock error of %s.%s", serviceName(request), request.Method())
+		}
+		return common.InternalServerError("dubbogo.client", msg)
+
+	default:
+		impl, ok := c.opts.Mocks[serviceName(request)]
+		if !ok {
+			return common.InternalServerError("dubbogo.client",
+				fmt.Sprintf("no mock implementation of service %s", serviceName(request)))
+		}
+		return jerrors.Trace(callMock(ctx, impl, request, response))
+	}
+}
+
+// mockReturn decodes the json @value into @rsp, "null" & "empty" reset it
+func mockReturn(value string, rsp interface{}) error {
+	if value == "" || value == "null" || value == "empty" {
+		if v := reflect.ValueOf(rsp); v.Kind() == reflect.Ptr && !v.IsNil() {
+			v.Elem().Set(reflect.Zero(v.Elem().Type()))
+		}
+		return nil
+	}
+	if err := json.Unmarshal([]byte(value), rsp); err != nil {
+		return common.InternalServerError("dubbogo.client", fmt.Sprintf("invalid mock value %q: %v", value, err))
+	}
+	return nil
+}
+
+// callMock calls the method of @request of the mock implementation @impl, whose type is
+// func(ctx context.Context, args T, rsp *R) error like the handlers of the server.
+func callMock(ctx context.Context, impl interface{}, request Request, response interface{}) error {
+	method := reflect.ValueOf(impl).MethodByName(request.Method())
+	if !method.IsValid() {
+		return jerrors.Errorf("mock %T has no method %s", impl, request.Method())
+	}
+	mtype := method.Type()
+	if mtype.NumIn() != 3 || mtype.NumOut() != 1 || mtype.Out(0) != typeOfError {
+		return jerrors.Errorf("mock method %T.%s should be func(context.Context, args, rsp) error", impl, request.Method())
+	}
+
+	in := []reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(request.Args()), reflect.ValueOf(response)}
+	for i := 1; i < len(in); i++ {
+		if !in[i].IsValid() {
+			in[i] = reflect.Zero(mtype.In(i))
+		}
+		if !in[i].Type().AssignableTo(mtype.In(i)) {
+			return jerrors.Errorf("mock method %T.%s: %s is not assignable to %s", impl, request.Method(), in[i].Type(), mtype.In(i))
+		}
+	}
+
+	if err, _ := method.Call(in)[0].Interface().(error); err != nil {
+		return err
+	}
+	return nil
+}
@@ -17,11 +17,19 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
 	"time"
 )
 
 import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/breaker"
 	"github.com/AlexStocks/dubbogo/codec"
+	"github.com/AlexStocks/dubbogo/limiter"
 	"github.com/AlexStocks/dubbogo/registry"
 	"github.com/AlexStocks/dubbogo/selector"
 	"github.com/AlexStocks/dubbogo/transport"
@@ -46,15 +54,24 @@ type RequestOptions struct {
 // Call Options
 //////////////////////////////////////////////
 
+// CallOptions of a call take precedence over the Options.MethodCallOptions of its method,
+// which take precedence over the client Options.CallOptions. The params published in the
+// provider url, such as "<method>.timeout", "<method>.retries" & "<method>.loadbalance",
+// and then the service params "timeout", "retries" & "loadbalance" are used if the client
+// sets none of them, and the defaults such as DefaultRequestTimeout are used at last.
 type CallOptions struct {
 	// Transport Dial Timeout
 	DialTimeout time.Duration
-	// Number of Call attempts
+	// Number of Call attempts, the dubbo url param "retries" excludes the first attempt
 	Retries int
 	// Request/Response timeout
 	RequestTimeout time.Duration
 	// cache selector address
 	Next selector.Next
+	// selector mode of the call, such as selector.SM_RoundRobin
+	SelectMode selector.Mode
+	// Filters run in order around every call to a provider
+	Filters []Filter
 }
 
 // WithDialTimeout is a CallOption which overrides that which
@@ -81,6 +98,22 @@ func WithRequestTimeout(d time.Duration) CallOption {
 	}
 }
 
+// WithSelectMode is a CallOption which overrides the selector mode
+// and the loadbalance param of the provider url
+func WithSelectMode(mode selector.Mode) CallOption {
+	return func(o *CallOptions) {
+		o.SelectMode = mode
+	}
+}
+
+// WithFilters is a CallOption which overrides the filters
+// set in Options.CallOptions. WithFilters() disables them.
+func WithFilters(filters ...Filter) CallOption {
+	return func(o *CallOptions) {
+		o.Filters = filters
+	}
+}
+
 //////////////////////////////////////////////
 // Options
 //////////////////////////////////////////////
@@ -95,12 +128,60 @@ type Options struct {
 	Selector  selector.Selector
 	Transport transport.Transport
 
-	// Connection Pool
+	// Application is the name of the consumer application, which is sent to the providers
+	// for their acl
+	Application string
+
+	// AccessKey & SecretKey sign the requests to the providers which publish "sign=true"
+	AccessKey string
+	SecretKey string
+
+	// TLSConfig enables tls of the transport, such as transport.LoadTLSConfig(...). The
+	// secure providers are selected by selector.NodeFilter(selector.TLSFilter(true)).
+	TLSConfig *tls.Config
+
+	// Connection Pool of every provider address of a service path.
+	// PoolSize is the max idle connections, PoolTTL is the max lifetime of a connection.
 	PoolSize int
 	PoolTTL  time.Duration
+	// PoolMinIdle connections are kept by the background eviction
+	PoolMinIdle int
+	// PoolMaxActive is the max open connections, 0 means no limit
+	PoolMaxActive int
+	// PoolIdleTimeout is the max idle time of a connection
+	PoolIdleTimeout time.Duration
+	// PoolWaitTimeout is the max wait for a free connection if there are PoolMaxActive ones,
+	// 0 means waiting until the request timeout
+	PoolWaitTimeout time.Duration
 
 	// Default Call Options
 	CallOptions CallOptions
+	// MethodCallOptions of the methods, service name -> method name -> options
+	MethodCallOptions map[string]map[string][]CallOption
+
+	// TracerProvider creates the spans of calls, the default is the global one of otel
+	TracerProvider trace.TracerProvider
+
+	// Breaker records the results of calls to providers, whose open providers are
+	// excluded by the selector created with selector.NodeFilter(Breaker.Available)
+	Breaker *breaker.Group
+
+	// Limiter limits the in-flight calls to providers adaptively
+	Limiter *limiter.Group
+
+	// DrainTimeout is the max wait for the in-flight calls at Close
+	DrainTimeout time.Duration
+
+	// Mocks are the mock implementations of the services, service name -> mock, which
+	// are called if the "mock" param of the service config is "force" or "fail".
+	Mocks map[string]interface{}
+
+	// ServiceConfigs are the static configs of the services, ServiceConfig.Key() -> config,
+	// such as the mock, which are overridden by the registry.Configurator.
+	ServiceConfigs map[string]registry.ServiceConfig
+
+	// Caches of the results of the idempotent methods, service name -> method name -> config
+	Caches map[string]map[string]CacheConfig
 
 	// Other options for implementations of the interface
 	// can be stored in a context
@@ -109,13 +190,15 @@ type Options struct {
 
 func newOptions(options ...Option) Options {
 	opts := Options{
+		// Retries & RequestTimeout are resolved by the provider url if they are not set
 		CallOptions: CallOptions{
-			Retries:        DefaultRetries,
-			RequestTimeout: DefaultRequestTimeout,
-			DialTimeout:    transport.DefaultDialTimeout,
+			DialTimeout: transport.DefaultDialTimeout,
 		},
-		PoolSize: DefaultPoolSize,
-		PoolTTL:  DefaultPoolTTL,
+		PoolSize:        DefaultPoolSize,
+		PoolTTL:         DefaultPoolTTL,
+		PoolIdleTimeout: DefaultPoolIdleTimeout,
+		TracerProvider:  otel.GetTracerProvider(),
+		DrainTimeout:    DefaultDrainTimeout,
 	}
 
 	for _, o := range options {
@@ -134,8 +217,10 @@ func newOptions(options ...Option) Options {
 		panic("client.Options.CodecType is nil")
 	}
 
-	opts.newCodec = dubbogoClientConfigMap[opts.CodecType].newCodec
-	opts.Transport = dubbogoClientConfigMap[opts.CodecType].newTransport()
+	if opts.newCodec == nil {
+		opts.newCodec = dubbogoClientConfigMap[opts.CodecType].newCodec
+	}
+	opts.Transport = dubbogoClientConfigMap[opts.CodecType].newTransport(transport.TLSConfig(opts.TLSConfig))
 
 	return opts
 }
@@ -147,6 +232,14 @@ func CodecType(t codec.CodecType) Option {
 	}
 }
 
+// Codec overrides the default codec of the CodecType, e.g.
+// hessian.NewHTTPCodecWithVersion(hessian.HESSIAN_1) to call hessian 1.0 servlets.
+func Codec(c codec.NewCodec) Option {
+	return func(o *Options) {
+		o.newCodec = c
+	}
+}
+
 // PoolSize sets the connection pool size
 func PoolSize(d int) Option {
 	return func(o *Options) {
@@ -161,6 +254,34 @@ func PoolTTL(d time.Duration) Option {
 	}
 }
 
+// PoolMinIdle sets the min idle connections of every provider address
+func PoolMinIdle(n int) Option {
+	return func(o *Options) {
+		o.PoolMinIdle = n
+	}
+}
+
+// PoolMaxActive sets the max open connections of every provider address
+func PoolMaxActive(n int) Option {
+	return func(o *Options) {
+		o.PoolMaxActive = n
+	}
+}
+
+// PoolIdleTimeout sets the max idle time of a pooled connection
+func PoolIdleTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.PoolIdleTimeout = d
+	}
+}
+
+// PoolWaitTimeout sets the max wait for a free connection
+func PoolWaitTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.PoolWaitTimeout = d
+	}
+}
+
 // Registry to find nodes for a given service
 func Registry(r registry.Registry) Option {
 	return func(o *Options) {
@@ -175,6 +296,28 @@ func Transport(t transport.Transport) Option {
 	}
 }
 
+// Application sets the name of the consumer application
+func Application(name string) Option {
+	return func(o *Options) {
+		o.Application = name
+	}
+}
+
+// Credential sets the access key & secret key which sign the requests
+func Credential(accessKey, secretKey string) Option {
+	return func(o *Options) {
+		o.AccessKey = accessKey
+		o.SecretKey = secretKey
+	}
+}
+
+// TLSConfig enables tls of the transport, with the client certificate in mtls
+func TLSConfig(conf *tls.Config) Option {
+	return func(o *Options) {
+		o.TLSConfig = conf
+	}
+}
+
 // Select is used to select a node to route a request to
 func Selector(s selector.Selector) Option {
 	return func(o *Options) {
@@ -198,9 +341,93 @@ func RequestTimeout(d time.Duration) Option {
 	}
 }
 
+// MethodCallOptions sets the call options of @method of @service, which override
+// the Options.CallOptions
+func MethodCallOptions(service, method string, opts ...CallOption) Option {
+	return func(o *Options) {
+		if o.MethodCallOptions == nil {
+			o.MethodCallOptions = make(map[string]map[string][]CallOption)
+		}
+		if o.MethodCallOptions[service] == nil {
+			o.MethodCallOptions[service] = make(map[string][]CallOption)
+		}
+		o.MethodCallOptions[service][method] = append(o.MethodCallOptions[service][method], opts...)
+	}
+}
+
 // Transport dial timeout
 func DialTimeout(d time.Duration) Option {
 	return func(o *Options) {
 		o.CallOptions.DialTimeout = d
 	}
 }
+
+// Filters appends @filters to the default filter chain. The first filter is the outermost.
+func Filters(filters ...Filter) Option {
+	return func(o *Options) {
+		o.CallOptions.Filters = append(o.CallOptions.Filters, filters...)
+	}
+}
+
+// TracerProvider sets the provider of call spans, such as sdktrace.NewTracerProvider(...)
+func TracerProvider(tp trace.TracerProvider) Option {
+	return func(o *Options) {
+		o.TracerProvider = tp
+	}
+}
+
+// Breaker sets the circuit breakers of providers
+func Breaker(b *breaker.Group) Option {
+	return func(o *Options) {
+		o.Breaker = b
+	}
+}
+
+// Limiter sets the adaptive concurrency limiters of providers
+func Limiter(l *limiter.Group) Option {
+	return func(o *Options) {
+		o.Limiter = l
+	}
+}
+
+// Mock sets the mock implementation of @service
+func Mock(service string, impl interface{}) Option {
+	return func(o *Options) {
+		if o.Mocks == nil {
+			o.Mocks = make(map[string]interface{})
+		}
+		o.Mocks[service] = impl
+	}
+}
+
+// ServiceConfigs sets the static configs of the services, such as the mock
+func ServiceConfigs(confs ...registry.ServiceConfig) Option {
+	return func(o *Options) {
+		if o.ServiceConfigs == nil {
+			o.ServiceConfigs = make(map[string]registry.ServiceConfig)
+		}
+		for _, conf := range confs {
+			o.ServiceConfigs[conf.Key()] = conf
+		}
+	}
+}
+
+// Cache caches the results of @method of @service in the client
+func Cache(service, method string, conf CacheConfig) Option {
+	return func(o *Options) {
+		if o.Caches == nil {
+			o.Caches = make(map[string]map[string]CacheConfig)
+		}
+		if o.Caches[service] == nil {
+			o.Caches[service] = make(map[string]CacheConfig)
+		}
+		o.Caches[service][method] = conf
+	}
+}
+
+// DrainTimeout sets the max wait for the in-flight calls at Close
+func DrainTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.DrainTimeout = d
+	}
+}
@@ -18,6 +18,7 @@ package client
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -31,7 +32,9 @@ import (
 
 import (
 	"github.com/AlexStocks/dubbogo/codec"
+	"github.com/AlexStocks/dubbogo/codec/jsonrpc"
 	"github.com/AlexStocks/dubbogo/common"
+	"github.com/AlexStocks/dubbogo/metrics"
 	"github.com/AlexStocks/dubbogo/registry"
 	"github.com/AlexStocks/dubbogo/selector"
 	"github.com/AlexStocks/dubbogo/transport"
@@ -39,6 +42,7 @@ import (
 
 const (
 	CLEAN_CHANNEL_SIZE = 64
+	drainInterval      = 10 * time.Millisecond
 )
 
 //////////////////////////////////////////////
@@ -49,15 +53,21 @@ type empty struct{}
 
 // thread safe
 type rpcClient struct {
-	ID   int64
-	once sync.Once
-	opts Options
-	pool *pool
+	ID     int64
+	once   sync.Once
+	opts   Options
+	pool   *pool
+	caches map[string]map[string]*resultCache // service name -> method name -> results
 
 	// gc goroutine
 	done chan empty
 	wg   sync.WaitGroup
 	gcCh chan interface{}
+
+	// in-flight calls
+	sync.Mutex
+	closing bool
+	pending int
 }
 
 func newRPCClient(opt ...Option) Client {
@@ -65,13 +75,24 @@ func newRPCClient(opt ...Option) Client {
 
 	t := time.Now()
 	rc := &rpcClient{
-		ID:   int64(uint32(t.Second() * t.Nanosecond() * common.Goid())),
-		opts: opts,
-		pool: newPool(opts.PoolSize, opts.PoolTTL),
-		done: make(chan empty),
-		gcCh: make(chan interface{}, CLEAN_CHANNEL_SIZE),
+		ID:     int64(uint32(t.Second() * t.Nanosecond() * common.Goid())),
+		opts:   opts,
+		pool:   newPool(opts),
+		caches: newResultCaches(opts.Caches),
+		done:   make(chan empty),
+		gcCh:   make(chan interface{}, CLEAN_CHANNEL_SIZE),
 	}
 	log.Info("client initial ID:%d", rc.ID)
+	// close the connections to the removed providers, and drop their breakers & limiters
+	if n, ok := opts.Selector.(selector.RemoveNotifier); ok {
+		n.OnRemove(rc.pool.remove)
+		if opts.Breaker != nil {
+			n.OnRemove(opts.Breaker.Remove)
+		}
+		if opts.Limiter != nil {
+			n.OnRemove(opts.Limiter.Remove)
+		}
+	}
 	rc.wg.Add(1)
 	go rc.gc()
 
@@ -94,7 +115,7 @@ LOOP:
 		case obj = <-c.gcCh:
 			switch obj.(type) {
 			case *rpcStream:
-				obj.(*rpcStream).Close() // stream.Close()->rpcCodec.Close->poolConn.Close->httpTransportClient.Close
+				obj.(*rpcStream).Close() // stream.Close()->rpcCodec.Close, the connection is owned by the pool
 			default:
 				log.Warn("illegal type of gc obj:%+v", obj)
 			}
@@ -109,6 +130,9 @@ func (r *rpcClient) next(request Request, opts CallOptions) (selector.Next, erro
 	}
 
 	// get next nodes from the selector
+	if s, ok := r.opts.Selector.(selector.MethodSelector); ok {
+		return s.SelectMethod(request.ServiceConfig(), request.Method(), opts.SelectMode)
+	}
 	return r.opts.Selector.Select(request.ServiceConfig())
 }
 
@@ -125,17 +149,11 @@ func (c *rpcClient) call(ctx context.Context, reqID int64, service registry.Serv
 	req Request, rsp interface{}, opts CallOptions) error {
 
 	reqTimeout := opts.RequestTimeout
-	if len(service.Query.Get("timeout")) != 0 {
-		if timeout, err := strconv.Atoi(service.Query.Get("timeout")); err == nil {
-			timeoutDuration := time.Duration(timeout) * time.Millisecond
-			if timeoutDuration < reqTimeout {
-				reqTimeout = timeoutDuration
-			}
-		}
-	}
 	if reqTimeout <= 0 {
 		reqTimeout = DefaultRequestTimeout
 	}
+	ctx, cancel := context.WithTimeout(ctx, reqTimeout)
+	defer cancel()
 
 	// 创建 transport package
 	pkg := &transport.Package{}
@@ -159,13 +177,23 @@ func (c *rpcClient) call(ctx context.Context, reqID int64, service registry.Serv
 		gerr  error
 		topts *transport.Options
 	)
-	conn, err := c.pool.getConn(
-		c.opts.CodecType.String(),
-		service.Location,
-		c.opts.Transport,
-		transport.WithTimeout(opts.DialTimeout),
-		transport.WithPath(service.Path),
-	)
+	conn, err := c.pool.getConn(ctx, c.opts.CodecType.String(), service.Location, service.Path,
+		c.opts.Transport, opts.DialTimeout)
+	for err == nil && conn.pending {
+		// the provider has sent the event on the idle connection, which is not reused
+		if newRPCCodec(pkg, conn, c.opts.newCodec).ReadEvent() {
+			c.markReadonly(&service)
+		}
+		c.pool.release(conn, errPendingRead)
+		conn, err = c.pool.getConn(ctx, c.opts.CodecType.String(), service.Location, service.Path,
+			c.opts.Transport, opts.DialTimeout)
+	}
+	if err == errPoolTimeout {
+		return common.NewError("dubbogo.client", fmt.Sprintf("Error sending request: %v", err), 429)
+	}
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return common.NewError("dubbogo.client", fmt.Sprintf("%v", err), 408)
+	}
 	if err != nil {
 		return common.InternalServerError("dubbogo.client", fmt.Sprintf("Error sending request: %v", err))
 	}
@@ -174,22 +202,21 @@ func (c *rpcClient) call(ctx context.Context, reqID int64, service registry.Serv
 	topts.Timeout = reqTimeout
 
 	stream := &rpcStream{
-		seq:        reqID,
-		context:    ctx,
-		serviceURL: service,
-		request:    req,
-		closed:     make(chan struct{}),
-		codec:      newRPCCodec(pkg, conn, c.opts.newCodec),
+		seq:         reqID,
+		context:     ctx,
+		serviceURL:  service,
+		request:     req,
+		closed:      make(chan struct{}),
+		codec:       newRPCCodec(pkg, conn, c.opts.newCodec),
+		attachments: c.attachments(&service),
+		sign:        c.signer(&service, req),
 	}
 
 	defer func() {
-		// defer execution of release
-		if req.Stream() {
-			// 只缓存长连接
-			log.Debug("store connection:{protocol:%s, location:%s, conn:%#v}, gerr:%#v",
-				req.Protocol(), service.Location, conn, gerr)
-			c.pool.release(req.Protocol(), service.Location, conn, gerr)
-		}
+		// defer execution of release, the connection is closed if the call fails
+		log.Debug("release connection:{protocol:%s, location:%s, conn:%#v}, gerr:%#v",
+			req.Protocol(), service.Location, conn, gerr)
+		c.pool.release(conn, gerr)
 
 		c.gcCh <- stream
 	}()
@@ -235,6 +262,11 @@ func (c *rpcClient) call(ctx context.Context, reqID int64, service registry.Serv
 	select {
 	case err := <-ch:
 		gerr = err
+		if err == nil && stream.codec.Readonly() {
+			// the provider is shutting down, so its connection should not be reused
+			gerr = errReadonly
+			c.markReadonly(&service)
+		}
 		return jerrors.Trace(err)
 	case <-ctx.Done():
 		gerr = ctx.Err()
@@ -242,19 +274,56 @@ func (c *rpcClient) call(ctx context.Context, reqID int64, service registry.Serv
 	}
 }
 
+// attachments of the requests to the provider @service, such as the token it publishes.
+func (c *rpcClient) attachments(service *registry.ServiceURL) map[string]string {
+	attachments := make(map[string]string, 2)
+	if token := service.Query.Get(common.TOKEN_KEY); len(token) != 0 {
+		attachments[common.TOKEN_KEY] = token
+	}
+	if len(c.opts.Application) != 0 {
+		attachments[common.APPLICATION_KEY] = c.opts.Application
+	}
+	return attachments
+}
+
+// signer returns the codec.Message.Sign of the requests @req to the provider @service which
+// publishes "sign=true". Every message of a stream is signed with a new timestamp & nonce.
+func (c *rpcClient) signer(service *registry.ServiceURL, req Request) func(string, string) map[string]string {
+	if service.Query.Get(common.SIGN_KEY) != "true" || len(c.opts.AccessKey) == 0 {
+		return nil
+	}
+
+	accessKey, secretKey := c.opts.AccessKey, c.opts.SecretKey
+	return func(method, digest string) map[string]string {
+		timestamp := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		nonce := common.NewNonce()
+		return map[string]string{
+			common.ACCESS_KEY_KEY: accessKey,
+			common.TIMESTAMP_KEY:  timestamp,
+			common.NONCE_KEY:      nonce,
+			common.SIGNATURE_KEY:  common.Sign(secretKey, accessKey, serviceName(req), method, digest, timestamp, nonce),
+		}
+	}
+}
+
+// markReadonly stops the selector selecting the provider @service which has sent the readonly event
+func (c *rpcClient) markReadonly(service *registry.ServiceURL) {
+	log.Warn("provider %s of service %s is readonly", service.Location, service.Path)
+	c.pool.remove(service.Location)
+	if m, ok := c.opts.Selector.(selector.ReadonlyMarker); ok {
+		m.MarkReadonly(service)
+	}
+}
+
 // 流程
 // 1 从selector中根据service选择一个provider，具体的来说，就是next函数对象;
 // 2 构造call函数;
 //   2.1 调用next函数返回provider的serviceurl;
 //   2.2 调用rpcClient.call()
 // 3 根据重试次数的设定，循环调用call，直到有一次成功或者重试
-func (c *rpcClient) Call(ctx context.Context, request Request, response interface{}, opts ...CallOption) error {
+func (c *rpcClient) retryCall(ctx context.Context, request Request, response interface{}, opts ...CallOption) error {
 	reqID := atomic.AddInt64(&c.ID, 1)
-	// make a copy of call opts
-	callOpts := c.opts.CallOptions
-	for _, opt := range opts {
-		opt(&callOpts)
-	}
+	callOpts := c.callOptions(request, opts...)
 
 	// get next nodes selection func from the selector
 	next, err := c.next(request, callOpts)
@@ -268,18 +337,13 @@ func (c *rpcClient) Call(ctx context.Context, request Request, response interfac
 	}
 
 	// check if we already have a deadline
-	d, ok := ctx.Deadline()
-	log.Debug("ctx:%#v, d:%#v, ok:%v", ctx, d, ok)
-	if !ok {
-		// no deadline so we create a new one
-		log.Debug("create timeout context, timeout:%v", callOpts.RequestTimeout)
-		ctx, _ = context.WithTimeout(ctx, callOpts.RequestTimeout)
-	} else {
+	if d, ok := ctx.Deadline(); ok {
 		// got a deadline so no need to setup context
 		// but we need to set the timeout we pass along
-		opt := WithRequestTimeout(d.Sub(time.Now()))
-		log.Debug("WithRequestTimeout:%#v", d.Sub(time.Now()))
-		opt(&callOpts)
+		if timeout := d.Sub(time.Now()); callOpts.RequestTimeout <= 0 || timeout < callOpts.RequestTimeout {
+			log.Debug("WithRequestTimeout:%#v", timeout)
+			WithRequestTimeout(timeout)(&callOpts)
+		}
 	}
 
 	select {
@@ -288,34 +352,81 @@ func (c *rpcClient) Call(ctx context.Context, request Request, response interfac
 	default:
 	}
 
-	call := func(i int) error {
-		// select next node
-		serviceURL, err := next(reqID)
-		if err != nil {
-			log.Error("selector.next(request{%#v}, reqID{%d}) = error{%#v}", request, reqID, err)
-			if err == selector.ErrNotFound {
-				return common.NotFound("dubbogo.client", err.Error())
+	var (
+		gerr    error
+		retries = callOpts.Retries
+		invoke  CallFunc
+	)
+	if retries <= 0 {
+		retries = DefaultRetries
+	}
+	call := func(i int, serviceURL *registry.ServiceURL) error {
+		var release func(error)
+		if c.opts.Limiter != nil {
+			var err error
+			if release, err = c.opts.Limiter.Acquire(serviceName(request), serviceURL); err != nil {
+				log.Warn("reqID{%d}, @i{%d}, provider %s: %v", reqID, i, serviceURL.Location, err)
+				return common.NewError("dubbogo.client", err.Error(), http.StatusTooManyRequests)
 			}
+		}
 
-			return common.InternalServerError("dubbogo.client", err.Error())
+		var done func(error)
+		if c.opts.Breaker != nil {
+			var err error
+			if done, err = c.opts.Breaker.Acquire(serviceName(request), serviceURL); err != nil {
+				log.Warn("reqID{%d}, @i{%d}, provider %s: %v", reqID, i, serviceURL.Location, err)
+				if release != nil {
+					release(err) // the call never reaches the node, the limiter only frees its slot
+				}
+				return common.NewError("dubbogo.client", err.Error(), http.StatusServiceUnavailable)
+			}
 		}
 
-		err = c.call(ctx, reqID, *serviceURL, request, response, callOpts)
+		start := time.Now()
+		actx, span := c.startAttemptSpan(ctx, request, i, serviceURL)
+		err := invoke(actx, *serviceURL, request, response)
+		endSpan(span, err)
+		if done != nil {
+			done(err)
+		}
+		if release != nil {
+			release(err)
+		}
+		metrics.ObserveClient(serviceName(request), request.Method(), serviceURL.Location, start, err)
+		if r, ok := c.opts.Selector.(selector.Reporter); ok {
+			r.Report(request.ServiceConfig(), serviceURL, time.Since(start), err)
+		}
 		log.Debug("@i{%d}, call(ID{%v}, ctx{%v}, serviceURL{%s}, request{%v}, response{%v}) = err{%v}",
 			i, reqID, ctx, serviceURL, request, response, jerrors.ErrorStack(err))
 		return jerrors.Trace(err)
 	}
 
-	var (
-		gerr error
-		ch   chan error
-	)
-	ch = make(chan error, callOpts.Retries)
-	for i := 0; i < callOpts.Retries; i++ {
-		var index = i
-		go func() {
-			ch <- call(index)
-		}()
+	for i := 0; i < retries; i++ {
+		// select next node
+		serviceURL, err := next(reqID)
+		if err != nil {
+			log.Error("selector.next(request{%#v}, reqID{%d}) = error{%#v}", request, reqID, err)
+			if err == selector.ErrNotFound {
+				gerr = common.NotFound("dubbogo.client", err.Error())
+			} else {
+				gerr = common.InternalServerError("dubbogo.client", err.Error())
+			}
+			continue
+		}
+
+		// the timeout & retries of the method are published by the first selected provider
+		if invoke == nil {
+			callOpts = methodCallOptions(callOpts, serviceURL, request.Method())
+			retries = callOpts.Retries
+			invoke = c.chain(callOpts, func(ctx context.Context, serviceURL registry.ServiceURL, req Request, rsp interface{}) error {
+				return c.call(ctx, reqID, serviceURL, req, rsp, callOpts)
+			})
+		}
+
+		ch := make(chan error, 1)
+		go func(index int) {
+			ch <- call(index, serviceURL)
+		}(i)
 
 		select {
 		case <-ctx.Done():
@@ -334,6 +445,97 @@ func (c *rpcClient) Call(ctx context.Context, request Request, response interfac
 	return gerr
 }
 
+// callOptions makes a copy of the client call options, overridden by the options of the
+// method of @request and then @opts of the call.
+func (c *rpcClient) callOptions(request Request, opts ...CallOption) CallOptions {
+	callOpts := c.opts.CallOptions
+	for _, opt := range c.opts.MethodCallOptions[serviceName(request)][request.Method()] {
+		opt(&callOpts)
+	}
+	for _, opt := range opts {
+		opt(&callOpts)
+	}
+
+	return callOpts
+}
+
+// methodCallOptions resolves the timeout & retries of @method by the params of the provider
+// @url if they are not set in @opts by the client, and the defaults are used if neither of
+// them sets it.
+func methodCallOptions(opts CallOptions, url *registry.ServiceURL, method string) CallOptions {
+	if opts.RequestTimeout <= 0 {
+		if timeout, err := strconv.Atoi(url.MethodParam(method, "timeout")); err == nil && timeout > 0 {
+			opts.RequestTimeout = time.Duration(timeout) * time.Millisecond
+		} else {
+			opts.RequestTimeout = DefaultRequestTimeout
+		}
+	}
+	if opts.Retries <= 0 {
+		if retries, err := strconv.Atoi(url.MethodParam(method, "retries")); err == nil && retries >= 0 {
+			opts.Retries = retries + 1
+		} else {
+			opts.Retries = DefaultRetries
+		}
+	}
+
+	return opts
+}
+
+// Call invokes @request in the client span of the call, or its mock if the service
+// config forces it, or the call fails by a RpcException. The cached results of the methods skip the providers.
+func (c *rpcClient) Call(ctx context.Context, request Request, response interface{}, opts ...CallOption) error {
+	c.Lock()
+	if c.closing {
+		c.Unlock()
+		return common.NewError("dubbogo.client", "client is closed", http.StatusServiceUnavailable)
+	}
+	c.pending++
+	c.Unlock()
+	defer func() {
+		c.Lock()
+		c.pending--
+		c.Unlock()
+	}()
+
+	ctx, span := c.startCallSpan(ctx, request)
+	var err error
+	if m := c.mock(request); m != nil && m.force {
+		err = c.invokeMock(ctx, m, request, response)
+	} else if err = c.cachedCall(ctx, request, response, func() error {
+		return c.retryCall(ctx, request, response, opts...)
+	}); err != nil && m != nil && mockable(err) {
+		log.Warn("call(service:%s, method:%s) = error{%v}, mock:%q", serviceName(request), request.Method(), err, m.action)
+		err = c.invokeMock(ctx, m, request, response)
+	}
+	endSpan(span, err)
+	return err
+}
+
+// chain wraps @fn with the filters of @opts, the first filter is the outermost.
+func (c *rpcClient) chain(opts CallOptions, fn CallFunc) CallFunc {
+	for i := len(opts.Filters) - 1; i >= 0; i-- {
+		filter, next := opts.Filters[i], fn
+		fn = func(ctx context.Context, serviceURL registry.ServiceURL, req Request, rsp interface{}) error {
+			return filter(ctx, serviceURL, req, rsp, next)
+		}
+	}
+	return fn
+}
+
+// BatchCall sends @batch as one jsonrpc 2.0 batch request. The result of every
+// call is set to its Reply or Error, and the returned error is the error of the
+// whole batch.
+func (c *rpcClient) BatchCall(ctx context.Context, group, version, service string, batch jsonrpc.Batch, opts ...CallOption) error {
+	if c.opts.CodecType != codec.CODECTYPE_JSONRPC {
+		return jerrors.Errorf("codec %s does not support batch call", c.opts.CodecType)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	return jerrors.Trace(c.Call(ctx, c.NewRequest(group, version, service, "", batch), batch, opts...))
+}
+
 func (c *rpcClient) Options() Options {
 	return c.opts
 }
@@ -346,14 +548,43 @@ func (c *rpcClient) NewRequest(group, version, service, method string, args inte
 	return newRPCRequest(group, codecType, version, service, method, args, codec2ContentType[codecType], reqOpts...)
 }
 
+// PoolStats returns the stats of the connection pools of the provider addresses
+func (c *rpcClient) PoolStats() map[string]PoolStats {
+	return c.pool.stats()
+}
+
 func (c *rpcClient) String() string {
 	return "dubbogo-client"
 }
 
+// drain waits for the in-flight calls until @deadline, and returns the number of the
+// unfinished ones.
+func (c *rpcClient) drain(deadline time.Time) int {
+	for {
+		c.Lock()
+		n := c.pending
+		c.Unlock()
+		if n == 0 || !time.Now().Before(deadline) {
+			return n
+		}
+		time.Sleep(drainInterval)
+	}
+}
+
+// Close rejects new calls, waits for the in-flight ones until Options.DrainTimeout,
+// and then closes the connections, the selector and the registry.
 func (c *rpcClient) Close() {
-	close(c.done) // notify gc() to close transport connection
-	c.wg.Wait()
 	c.once.Do(func() {
+		c.Lock()
+		c.closing = true
+		c.Unlock()
+		if n := c.drain(time.Now().Add(c.opts.DrainTimeout)); 0 < n {
+			log.Warn("client closes with %d in-flight calls", n)
+		}
+
+		close(c.done) // notify gc() to close transport connection
+		c.wg.Wait()
+		c.pool.close()
 		if c.opts.Selector != nil {
 			c.opts.Selector.Close()
 			c.opts.Selector = nil
@@ -23,6 +23,7 @@ package client
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -32,6 +33,7 @@ import (
 
 import (
 	"github.com/AlexStocks/dubbogo/codec"
+	"github.com/AlexStocks/dubbogo/common"
 	"github.com/AlexStocks/dubbogo/transport"
 )
 
@@ -49,7 +51,9 @@ func (e serverError) Error() string {
 
 // errShutdown holds the specific error for closing/closed connections
 var (
-	errShutdown = errors.New("connection is shut down")
+	errShutdown    = errors.New("connection is shut down")
+	errReadonly    = errors.New("provider is readonly")
+	errPendingRead = errors.New("unread data on the idle connection")
 )
 
 type rpcCodec struct {
@@ -58,6 +62,9 @@ type rpcCodec struct {
 
 	pkg *transport.Package
 	buf *readWriteCloser
+
+	// readonly is set if the provider has sent the readonly event in graceful shutdown
+	readonly bool
 }
 
 type readWriteCloser struct {
@@ -69,6 +76,7 @@ type clientCodec interface {
 	WriteRequest(req *request, args interface{}) error
 	ReadResponseHeader(*response) error
 	ReadResponseBody(interface{}) error
+	Readonly() bool
 
 	Close() error
 }
@@ -80,6 +88,9 @@ type request struct {
 	ServiceMethod string // format: "Service.Method"
 	Seq           int64  // sequence number chosen by client
 	Timeout       time.Duration
+	Header        map[string]string // attachments, such as the trace context
+	// Sign returns the signature attachments of the method & the digest of the encoded args
+	Sign func(method, argsDigest string) map[string]string
 }
 
 type response struct {
@@ -127,10 +138,14 @@ func (c *rpcCodec) WriteRequest(req *request, args interface{}) error {
 		Timeout:     req.Timeout,
 		Type:        codec.Request,
 		Header:      map[string]string{},
+		Sign:        req.Sign,
+	}
+	for k, v := range req.Header {
+		m.Header[k] = v
 	}
-	// Serialization
+	// Serialization, whose error is the fault of the caller rather than the provider
 	if err := c.codec.Write(m, args); err != nil {
-		return jerrors.Trace(err)
+		return common.BadRequest("dubbogo.client", fmt.Sprintf("encode request: %v", err))
 	}
 	// get binary stream
 	c.pkg.Body = c.buf.wbuf.Bytes()
@@ -159,7 +174,11 @@ func (c *rpcCodec) ReadResponseHeader(r *response) error {
 			return jerrors.Trace(err)
 		}
 		c.buf.rbuf.Write(p.Body)
+		cm.Header = p.Header // grpc status is in the http/2 trailers
 		err = c.codec.ReadHeader(&cm, codec.Response)
+		if cm.Header[common.DUBBO_EVENT_HEADER] == common.READONLY_EVENT {
+			c.readonly = true
+		}
 		if err != codec.ErrHeaderNotEnough {
 			break
 		}
@@ -172,6 +191,28 @@ func (c *rpcCodec) ReadResponseHeader(r *response) error {
 	return jerrors.Trace(err)
 }
 
+// ReadEvent reads the unsolicited packages of the provider on the idle connection, and
+// reports whether it has sent the readonly event.
+func (c *rpcCodec) ReadEvent() bool {
+	var (
+		p  transport.Package
+		cm codec.Message
+	)
+
+	c.buf.rbuf.Reset()
+	if err := c.client.Recv(&p); err != nil {
+		return false
+	}
+	c.buf.rbuf.Write(p.Body)
+	c.codec.ReadHeader(&cm, codec.Response)
+	return cm.Header[common.DUBBO_EVENT_HEADER] == common.READONLY_EVENT
+}
+
+// Readonly reports whether the provider has sent the readonly event
+func (c *rpcCodec) Readonly() bool {
+	return c.readonly
+}
+
 func (c *rpcCodec) ReadResponseBody(b interface{}) error {
 	var (
 		err error
@@ -194,8 +235,8 @@ func (c *rpcCodec) ReadResponseBody(b interface{}) error {
 	return nil
 }
 
+// Close releases the buffers, and the connection is returned to the pool by the client
 func (c *rpcCodec) Close() error {
 	c.buf.Close()
-	c.codec.Close()
-	return c.client.Close()
+	return c.codec.Close()
 }
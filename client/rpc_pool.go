@@ -16,118 +16,444 @@
 package client
 
 import (
-	"strings"
+	"context"
 	"sync"
 	"time"
 )
 
 import (
+	log "github.com/AlexStocks/log4go"
 	jerrors "github.com/juju/errors"
 )
 
 import (
+	"github.com/AlexStocks/dubbogo/metrics"
 	"github.com/AlexStocks/dubbogo/transport"
 )
 
+var (
+	// DefaultPoolEvictInterval is the interval of the background eviction of the pool
+	DefaultPoolEvictInterval = 10 * time.Second
+
+	errPoolClosed  = jerrors.New("connection pool is closed")
+	errPoolTimeout = jerrors.New("connection pool wait timeout")
+)
+
+// PoolStats of the connections to a provider address
+type PoolStats struct {
+	Active    int // open connections, idle or in use
+	Idle      int
+	Waiting   int // calls waiting for a free connection
+	Hits      int64
+	Misses    int64
+	Timeouts  int64 // calls timed out waiting for a free connection
+	Evictions int64
+}
+
+// PoolStatsReporter is implemented by the client which pools its connections. The key
+// of the stats is "protocol://address/path".
+type PoolStatsReporter interface {
+	PoolStats() map[string]PoolStats
+}
+
 type poolConn struct {
-	once *sync.Once
 	transport.Client
-	created int64 // 为0，则说明没有被创建或者被销毁了
+	cp       *connPool
+	created  time.Time
+	returned time.Time // the time it became idle
+	pending  bool      // the idle connection has received the unsolicited packages
+	once     sync.Once
 }
 
-func (p *poolConn) Close() error {
-	err := jerrors.Errorf("close poolConn{%#v} again", p)
-	p.once.Do(func() {
-		p.Client.Close()
-		p.created = 0
-		err = nil
+func (c *poolConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		err = c.Client.Close()
 	})
-	return err
+	return jerrors.Trace(err)
+}
+
+// valid checks the connection by transport.Validator before it is reused. The open one
+// with unread data is valid, whose pending packages are read by the client at first.
+func (c *poolConn) valid() bool {
+	if p, ok := c.Client.(transport.Pender); ok && p.Pending() {
+		c.pending = true
+		return true
+	}
+	c.pending = false
+	if v, ok := c.Client.(transport.Validator); ok {
+		return v.Valid()
+	}
+	return true
+}
+
+// connPool holds the connections to a provider address of a service path.
+type connPool struct {
+	protocol string
+	addr     string
+	path     string
+	tr       transport.Transport
+
+	idle    []*poolConn // lifo
+	active  int         // open connections, idle or in use
+	waiting int
+	notify  chan struct{} // closed when a connection is released
+	removed bool          // the provider has gone
+	used    time.Time
+	stats   PoolStats
+}
+
+// signal wakes up the waiters. It should be called with lock.
+func (cp *connPool) signal() {
+	if 0 < cp.waiting {
+		close(cp.notify)
+		cp.notify = make(chan struct{})
+	}
+}
+
+// gauge updates the metrics of the connections. It should be called with lock.
+func (cp *connPool) gauge() {
+	metrics.PoolConns.WithLabelValues(cp.addr, cp.protocol).Set(float64(len(cp.idle)))
+	metrics.PoolActiveConns.WithLabelValues(cp.addr, cp.protocol).Set(float64(cp.active))
+}
+
+func (cp *connPool) dial(timeout time.Duration) (*poolConn, error) {
+	// if @tr is httpTransport, then c is httpTransportClient.
+	// if @tr is tcpTransport, then c is tcpTransportClient.
+	c, err := cp.tr.Dial(cp.addr, transport.WithTimeout(timeout), transport.WithPath(cp.path))
+	if err != nil {
+		return nil, jerrors.Trace(err)
+	}
+	return &poolConn{Client: c, cp: cp, created: time.Now()}, nil
 }
 
+// pool of the connections to providers. Every provider address of a service path has
+// MaxActive connections at most, in which MaxIdle ones are kept idle for IdleTimeout,
+// and MinIdle ones are kept by the background eviction. A connection is closed after
+// MaxLifetime. The calls wait for a free connection until WaitTimeout or their deadline.
 type pool struct {
-	size int   // 从line 92可见，size是[]*poolConn数组的size
-	ttl  int64 // 从line 61 可见，ttl是每个poolConn的有效期时间. pool对象会在getConn时执行ttl检查
+	maxIdle     int
+	minIdle     int
+	maxActive   int
+	idleTimeout time.Duration
+	maxLifetime time.Duration
+	waitTimeout time.Duration
 
 	sync.Mutex
-	conns map[string][]*poolConn // 从[]*poolConn 可见key是连接地址，而value是对应这个地址的连接数组
+	pools  map[string]*connPool // "protocol://address/path" -> pool
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
 }
 
-func newPool(size int, ttl time.Duration) *pool {
-	return &pool{
-		size:  size,
-		ttl:   int64(ttl.Seconds()),
-		conns: make(map[string][]*poolConn),
+func newPool(opts Options) *pool {
+	p := &pool{
+		maxIdle:     opts.PoolSize,
+		minIdle:     opts.PoolMinIdle,
+		maxActive:   opts.PoolMaxActive,
+		idleTimeout: opts.PoolIdleTimeout,
+		maxLifetime: opts.PoolTTL,
+		waitTimeout: opts.PoolWaitTimeout,
+		pools:       make(map[string]*connPool),
+		done:        make(chan struct{}),
 	}
+	if p.maxIdle < p.minIdle {
+		p.maxIdle = p.minIdle
+	}
+	if 0 < p.maxActive && p.maxActive < p.maxIdle {
+		p.maxIdle = p.maxActive
+	}
+
+	p.wg.Add(1)
+	go p.run()
+	return p
 }
 
-func (p *pool) getConn(protocol, addr string, tr transport.Transport, opts ...transport.DialOption) (*poolConn, error) {
-	p.Lock()
-	var builder strings.Builder
+func poolKey(protocol, addr, path string) string {
+	return protocol + "://" + addr + "/" + path
+}
 
-	builder.WriteString(addr)
-	builder.WriteString("@")
-	builder.WriteString(protocol)
+// expired reports whether @conn should not be reused any more
+func (p *pool) expired(conn *poolConn, now time.Time) bool {
+	if 0 < p.maxLifetime && p.maxLifetime <= now.Sub(conn.created) {
+		return true
+	}
+	return 0 < p.idleTimeout && p.idleTimeout <= now.Sub(conn.returned)
+}
 
-	key := builder.String()
+// getConn borrows a connection to @addr, which should be returned by release. It waits
+// for a free connection if there are maxActive ones until waitTimeout or the deadline of @ctx.
+func (p *pool) getConn(ctx context.Context, protocol, addr, path string, tr transport.Transport,
+	dialTimeout time.Duration) (*poolConn, error) {
 
-	conns := p.conns[key]
-	now := time.Now().Unix()
+	var (
+		timer <-chan time.Time
+		key   = poolKey(protocol, addr, path)
+	)
+	if 0 < p.waitTimeout {
+		t := time.NewTimer(p.waitTimeout)
+		defer t.Stop()
+		timer = t.C
+	}
 
-	for len(conns) > 0 {
-		conn := conns[len(conns)-1]
-		conns = conns[:len(conns)-1]
-		p.conns[key] = conns
+	p.Lock()
+	for {
+		if p.closed {
+			p.Unlock()
+			return nil, errPoolClosed
+		}
+		cp, ok := p.pools[key]
+		if !ok {
+			cp = &connPool{protocol: protocol, addr: addr, path: path, tr: tr, notify: make(chan struct{})}
+			p.pools[key] = cp
+		}
+		cp.used = time.Now()
 
-		if d := now - conn.created; d > p.ttl {
-			conn.Client.Close()
+		// the latest idle connection
+		if n := len(cp.idle); 0 < n {
+			conn := cp.idle[n-1]
+			cp.idle = cp.idle[:n-1]
+			p.Unlock()
+			if !p.expired(conn, time.Now()) && conn.valid() {
+				p.Lock()
+				cp.stats.Hits++
+				cp.gauge()
+				p.Unlock()
+				metrics.PoolHits.WithLabelValues(addr, protocol).Inc()
+				return conn, nil
+			}
+			conn.Close()
+			p.Lock()
+			p.evicted(cp)
 			continue
 		}
 
+		if p.maxActive <= 0 || cp.active < p.maxActive {
+			cp.active++
+			cp.stats.Misses++
+			cp.gauge()
+			p.Unlock()
+			metrics.PoolMisses.WithLabelValues(addr, protocol).Inc()
+
+			conn, err := cp.dial(dialTimeout)
+			if err != nil {
+				p.Lock()
+				cp.active--
+				cp.signal()
+				cp.gauge()
+				p.Unlock()
+				return nil, jerrors.Trace(err)
+			}
+			return conn, nil
+		}
+
+		// wait for a free connection
+		notify := cp.notify
+		cp.waiting++
+		p.Unlock()
+		var err error
+		select {
+		case <-notify:
+		case <-timer:
+			err = errPoolTimeout
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		p.Lock()
+		cp.waiting--
+		if err == context.Canceled {
+			p.Unlock()
+			return nil, err
+		}
+		if err != nil {
+			cp.stats.Timeouts++
+			p.Unlock()
+			metrics.PoolWaitTimeouts.WithLabelValues(addr, protocol).Inc()
+			log.Warn("wait for a free connection to %s(active:%d) = error:%v", key, p.maxActive, err)
+			return nil, err
+		}
+	}
+}
+
+// evicted counts a closed connection of @cp. It should be called with lock.
+func (p *pool) evicted(cp *connPool) {
+	cp.active--
+	cp.stats.Evictions++
+	cp.signal()
+	cp.gauge()
+	metrics.PoolEvictions.WithLabelValues(cp.addr, cp.protocol).Inc()
+}
+
+// release returns @conn to the pool, or closes it if the call fails by @err.
+func (p *pool) release(conn *poolConn, err error) {
+	if conn == nil {
+		return
+	}
+
+	cp := conn.cp
+	conn.returned = time.Now()
+	p.Lock()
+	if err == nil && !p.closed && !cp.removed && len(cp.idle) < p.maxIdle && !p.expired(conn, conn.returned) {
+		cp.idle = append(cp.idle, conn)
+		cp.signal()
+		cp.gauge()
 		p.Unlock()
+		return
+	}
 
-		return conn, nil
+	if cp.removed || p.closed {
+		cp.active--
+		cp.signal()
+		p.Unlock()
+	} else if err != nil {
+		cp.active--
+		cp.signal()
+		cp.gauge()
+		p.Unlock()
+	} else {
+		p.evicted(cp)
+		p.Unlock()
 	}
+	conn.Close()
+}
+
+// remove closes the connections to @addr, whose provider has gone
+func (p *pool) remove(addr string) {
+	var conns []*poolConn
 
+	p.Lock()
+	for key, cp := range p.pools {
+		if cp.addr != addr {
+			continue
+		}
+		conns = append(conns, cp.idle...)
+		cp.active -= len(cp.idle)
+		cp.idle = nil
+		cp.removed = true
+		cp.signal()
+		delete(p.pools, key)
+		metrics.PoolConns.DeleteLabelValues(cp.addr, cp.protocol)
+		metrics.PoolActiveConns.DeleteLabelValues(cp.addr, cp.protocol)
+	}
 	p.Unlock()
 
-	// create new conn
-	// if @tr is httpTransport, then c is httpTransportClient.
-	// if @tr is tcpTransport, then c is tcpTransportClient.
-	c, err := tr.Dial(addr, opts...)
-	if err != nil {
-		return nil, jerrors.Trace(err)
+	for _, conn := range conns {
+		conn.Close()
 	}
-	return &poolConn{&sync.Once{}, c, time.Now().Unix()}, nil
 }
 
-func (p *pool) release(protocol, addr string, conn *poolConn, err error) {
-	if conn == nil || conn.created == 0 {
-		return
+// evict closes the expired idle connections, and the pools unused in idleTimeout.
+// It returns the pools which have less than minIdle connections.
+func (p *pool) evict(now time.Time) []*connPool {
+	var (
+		conns  []*poolConn
+		refill []*connPool
+	)
+
+	p.Lock()
+	for key, cp := range p.pools {
+		idle := cp.idle[:0]
+		for i, conn := range cp.idle {
+			// the earlier connections are kept for minIdle at first
+			if p.expired(conn, now) && (p.minIdle < len(cp.idle)-i || (0 < p.maxLifetime &&
+				p.maxLifetime <= now.Sub(conn.created))) {
+				conns = append(conns, conn)
+				p.evicted(cp)
+				continue
+			}
+			idle = append(idle, conn)
+		}
+		for i := len(idle); i < len(cp.idle); i++ {
+			cp.idle[i] = nil
+		}
+		cp.idle = idle
+		cp.gauge()
+
+		if cp.active == 0 && cp.waiting == 0 && p.minIdle == 0 &&
+			0 < p.idleTimeout && p.idleTimeout <= now.Sub(cp.used) {
+			delete(p.pools, key)
+			metrics.PoolConns.DeleteLabelValues(cp.addr, cp.protocol)
+			metrics.PoolActiveConns.DeleteLabelValues(cp.addr, cp.protocol)
+			continue
+		}
+		if len(cp.idle) < p.minIdle && (p.maxActive <= 0 || cp.active < p.maxActive) {
+			cp.active++
+			refill = append(refill, cp)
+		}
 	}
+	p.Unlock()
 
-	// don't store the conn if it has error
-	if err != nil {
-		conn.Close() // 须经过(poolConn)Close，以防止多次close transport client
-		return
+	for _, conn := range conns {
+		conn.Close()
 	}
+	return refill
+}
 
-	var builder strings.Builder
+// run evicts the idle connections and keeps minIdle ones every DefaultPoolEvictInterval
+func (p *pool) run() {
+	defer p.wg.Done()
 
-	builder.WriteString(addr)
-	builder.WriteString("@")
-	builder.WriteString(protocol)
+	ticker := time.NewTicker(DefaultPoolEvictInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-ticker.C:
+			for _, cp := range p.evict(now) {
+				conn, err := cp.dial(DefaultPoolEvictInterval)
+				if err != nil {
+					log.Warn("dial %s to keep idle connections = error:%v", cp.addr, err)
+					p.Lock()
+					cp.active--
+					cp.signal()
+					cp.gauge()
+					p.Unlock()
+					continue
+				}
+				p.release(conn, nil)
+			}
+		}
+	}
+}
 
-	key := builder.String()
+// stats of the pools
+func (p *pool) stats() map[string]PoolStats {
+	p.Lock()
+	defer p.Unlock()
+
+	stats := make(map[string]PoolStats, len(p.pools))
+	for key, cp := range p.pools {
+		s := cp.stats
+		s.Active, s.Idle, s.Waiting = cp.active, len(cp.idle), cp.waiting
+		stats[key] = s
+	}
+	return stats
+}
+
+// close closes the idle connections, and the borrowed ones are closed when released
+func (p *pool) close() {
+	var conns []*poolConn
 
-	// otherwise put it back for reuse
 	p.Lock()
-	conns := p.conns[key]
-	if len(conns) >= p.size {
+	if p.closed {
 		p.Unlock()
-		conn.Client.Close()
 		return
 	}
-	p.conns[key] = append(conns, conn)
+	p.closed = true
+	for _, cp := range p.pools {
+		conns = append(conns, cp.idle...)
+		cp.active -= len(cp.idle)
+		cp.idle = nil
+		cp.signal()
+		cp.gauge()
+	}
+	p.pools = make(map[string]*connPool)
 	p.Unlock()
+
+	close(p.done)
+	p.wg.Wait()
+	for _, conn := range conns {
+		conn.Close()
+	}
 }
@@ -31,6 +31,7 @@ import (
 )
 
 import (
+	"github.com/AlexStocks/dubbogo/common"
 	"github.com/AlexStocks/dubbogo/registry"
 )
 
@@ -44,6 +45,10 @@ type rpcStream struct {
 	request    Request
 	codec      clientCodec
 	context    context.Context
+	// attachments of the requests, such as the token of the provider
+	attachments map[string]string
+	// sign signs every request, nil if the provider does not verify the signature
+	sign func(method, argsDigest string) map[string]string
 }
 
 func (r *rpcStream) isClosed() bool {
@@ -84,7 +89,14 @@ func (r *rpcStream) Send(args interface{}, timeout time.Duration) error {
 		Seq:           seq,
 		ServiceMethod: r.request.Method(),
 		Timeout:       timeout,
+		Header:        make(map[string]string),
+		Sign:          r.sign,
 	}
+	for k, v := range r.attachments {
+		req.Header[k] = v
+	}
+	// the trace context of the call attempt
+	common.TracePropagator.Inject(r.context, common.TraceCarrier(req.Header))
 
 	if err := r.codec.WriteRequest(&req, args); err != nil {
 		r.err = err
@@ -0,0 +1,88 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"strconv"
+)
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/common"
+	"github.com/AlexStocks/dubbogo/registry"
+)
+
+// the interface of @req
+func serviceName(req Request) string {
+	if conf, ok := req.ServiceConfig().(*registry.ServiceConfig); ok {
+		return conf.Service
+	}
+	return ""
+}
+
+// span name: "interface/method"
+func spanName(req Request) string {
+	if service := serviceName(req); len(service) != 0 {
+		return service + "/" + req.Method()
+	}
+	return req.Method()
+}
+
+// startCallSpan starts the client span of a Call, whose children are the spans of its attempts.
+func (c *rpcClient) startCallSpan(ctx context.Context, req Request) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("rpc.system", c.opts.CodecType.String()),
+		attribute.String("rpc.method", req.Method()),
+	}
+	if conf, ok := req.ServiceConfig().(*registry.ServiceConfig); ok {
+		attrs = append(attrs,
+			attribute.String("rpc.service", conf.Service),
+			attribute.String("dubbo.group", conf.Group),
+			attribute.String("dubbo.version", conf.Version),
+		)
+	}
+
+	return c.opts.TracerProvider.Tracer(common.TRACER_NAME).Start(ctx, spanName(req),
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// startAttemptSpan starts the span of the @i-th attempt to call the provider @serviceURL.
+// Its context is injected into the request header or the dubbo attachments.
+func (c *rpcClient) startAttemptSpan(ctx context.Context, req Request, i int, serviceURL *registry.ServiceURL) (context.Context, trace.Span) {
+	port, _ := strconv.Atoi(serviceURL.Port)
+	return c.opts.TracerProvider.Tracer(common.TRACER_NAME).Start(ctx, spanName(req)+" attempt",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.Int("dubbogo.attempt", i),
+			attribute.String("server.address", serviceURL.Ip),
+			attribute.Int("server.port", port),
+			attribute.String("dubbogo.location", serviceURL.Location),
+		),
+	)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -16,6 +16,8 @@
 package codec
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"io"
 	"time"
@@ -48,6 +50,27 @@ type Codec interface {
 	String() string
 }
 
+// Batcher is implemented by the codec which may decode several requests from
+// one package, such as the jsonrpc 2.0 batch request.
+type Batcher interface {
+	// More reports whether there are requests of the current package left.
+	More() bool
+}
+
+// Eventer is implemented by the codec of dubbo frames, whose provider sends the
+// events to the consumers on the open connections, such as the readonly event.
+type Eventer interface {
+	// WriteEvent writes the oneway event request of @event.
+	WriteEvent(event string) error
+}
+
+// Buffer is implemented by the codec which may read ahead the messages of a stream
+// into its own buffer, such as triple.
+type Buffer interface {
+	// Buffered reports whether there are messages left in the buffer of the codec.
+	Buffered() bool
+}
+
 type Message struct {
 	ID          int64
 	Version     string
@@ -59,4 +82,32 @@ type Message struct {
 	Error       string
 	Header      map[string]string
 	BodyLen     int
+
+	// ArgsDigest is the digest of the encoded args of a request, which is set by the
+	// codec in Write, or in ReadHeader to verify the signature of the request.
+	ArgsDigest string
+	// Sign returns the signature attachments of the request of @method & @argsDigest, which
+	// is called by the codec in Write before the attachments are encoded.
+	Sign func(method, argsDigest string) map[string]string
+}
+
+// Digest returns the hex sha256 digest of @b
+func Digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// DigestArgs sets the digest of the encoded args @args of the request @m, and adds the
+// signature attachments of m.Sign to m.Header.
+func (m *Message) DigestArgs(args []byte) {
+	m.ArgsDigest = Digest(args)
+	if m.Sign == nil {
+		return
+	}
+	if m.Header == nil {
+		m.Header = make(map[string]string)
+	}
+	for k, v := range m.Sign(m.Method, m.ArgsDigest) {
+		m.Header[k] = v
+	}
 }
@@ -24,6 +24,7 @@ const (
 	TRANSPORTTYPE_BEGIN TransportType = iota
 	TRANSPORT_TCP
 	TRANSPORT_HTTP
+	TRANSPORT_HTTP2
 	TRANSPORTTYPE_UNKNOWN
 )
 
@@ -31,6 +32,7 @@ var transportTypeStrings = [...]string{
 	"",
 	"TCP",
 	"HTTP",
+	"HTTP2",
 	"",
 }
 
@@ -65,6 +67,10 @@ const (
 	CODECTYPE_BEGIN CodecType = iota
 	CODECTYPE_JSONRPC
 	CODECTYPE_DUBBO
+	CODECTYPE_HESSIAN
+	CODECTYPE_PROTOBUF
+	CODECTYPE_THRIFT
+	CODECTYPE_TRIPLE
 	CODECTYPE_UNKNOWN
 )
 
@@ -72,6 +78,10 @@ var codecTypeStrings = [...]string{
 	"",
 	"jsonrpc",
 	"dubbo",
+	"hessian",
+	"protobuf",
+	"thrift",
+	"tri",
 	"",
 }
 
@@ -15,9 +15,16 @@
 package hessian
 
 import (
+	"bytes"
+	"encoding/binary"
 	"testing"
 )
 
+import (
+	"github.com/AlexStocks/dubbogo/codec"
+	"github.com/AlexStocks/dubbogo/common"
+)
+
 // go test -v  codec_test.go encode.go   const.go  pojo.go codec.go
 // go test -v -run TestPackUint16
 
@@ -56,3 +63,133 @@ func TestPackInt64(t *testing.T) {
 		t.Fatalf("v:0X%d, pack-unpack value:0X%x\n", v, r)
 	}
 }
+
+type testBuffer struct {
+	bytes.Buffer
+}
+
+func (b *testBuffer) Close() error {
+	return nil
+}
+
+func TestHTTPCodec(t *testing.T) {
+	var (
+		err error
+		rsp string
+		buf testBuffer
+		m   codec.Message
+	)
+
+	for _, v := range []Version{HESSIAN_1, HESSIAN_2} {
+		buf.Reset()
+		c := NewHTTPCodecWithVersion(v)(&buf)
+		m = codec.Message{ID: 1, Type: codec.Request, Method: "hello", Header: map[string]string{}}
+		if err = c.Write(&m, []interface{}{"world"}); err != nil {
+			t.Fatalf("%s: Write() = %v", v, err)
+		}
+		if m.Header["Content-Type"] != HTTP_CONTENT_TYPE {
+			t.Errorf("%s: Content-Type = %q", v, m.Header["Content-Type"])
+		}
+
+		// the servlet replies "hello, world"
+		buf.Reset()
+		e := NewEncoderWithVersion(v)
+		if v == HESSIAN_1 {
+			e.Append([]byte{V1_REPLY, V1_MAJOR_VERSION, V1_MINOR_VERSION})
+			e.Encode("hello, world")
+			e.Append([]byte{V1_END})
+		} else {
+			e.Append([]byte{V2_CALL_ENVELOPE, V2_MAJOR_VERSION, V2_MINOR_VERSION, V2_REPLY})
+			e.Encode("hello, world")
+		}
+		buf.Write(e.Buffer())
+
+		m = codec.Message{}
+		if err = c.ReadHeader(&m, codec.Response); err != nil || m.Error != "" || m.ID != 1 {
+			t.Fatalf("%s: ReadHeader() = %v, message:%+v", v, err, m)
+		}
+		if err = c.ReadBody(&rsp); err != nil || rsp != "hello, world" {
+			t.Errorf("%s: ReadBody() = %q, %v", v, rsp, err)
+		}
+	}
+
+	// hessian 1.0 fault
+	buf.Reset()
+	c := NewHTTPCodecWithVersion(HESSIAN_1)(&buf)
+	e := NewEncoderWithVersion(HESSIAN_1)
+	e.Append([]byte{V1_REPLY, V1_MAJOR_VERSION, V1_MINOR_VERSION, V1_FAULT})
+	e.Encode("code")
+	e.Encode("ServiceException")
+	e.Encode("message")
+	e.Encode("no such method")
+	e.Append([]byte{V1_END, V1_END})
+	buf.Write(e.Buffer())
+	m = codec.Message{}
+	if err = c.ReadHeader(&m, codec.Response); err != nil || m.Error == "" {
+		t.Errorf("ReadHeader(fault) = %v, message:%+v", err, m)
+	}
+	t.Logf("fault: %s", m.Error)
+}
+
+func TestGetJavaTypeDesc(t *testing.T) {
+	types := map[string]string{
+		"int":                                   "I",
+		"long[]":                                "[J",
+		"java.lang.String":                      "Ljava/lang/String;",
+		"java.util.Map<java.lang.String, Long>": "Ljava/util/Map;",
+		"java.util.List<java.lang.String>[]":    "[Ljava/util/List;",
+		"com.ikurento.user.User[][]":            "[[Lcom/ikurento/user/User;",
+	}
+	for typ, desc := range types {
+		if d := getJavaTypeDesc(typ); d != desc {
+			t.Errorf("getJavaTypeDesc(%s) = %s, want %s", typ, d, desc)
+		}
+	}
+}
+
+// the readonly event of the provider in graceful shutdown precedes the response
+func TestReadonlyEvent(t *testing.T) {
+	var (
+		err error
+		rsp string
+		buf testBuffer
+	)
+
+	pack := func(flag, status byte, values ...interface{}) {
+		e := NewEncoder()
+		for _, v := range values {
+			e.Encode(v)
+		}
+		header := [HEADER_LENGTH]byte{MAGIC_HIGH, MAGIC_LOW, flag, status}
+		binary.BigEndian.PutUint64(header[4:], 1)
+		binary.BigEndian.PutUint32(header[12:], uint32(len(e.Buffer())))
+		buf.Write(header[:])
+		buf.Write(e.Buffer())
+	}
+	pack(FLAG_REQUEST|FLAG_EVENT|0x02, 0, common.READONLY_EVENT)
+	pack(FLAG_TWOWAY|0x02, Response_OK, RESPONSE_VALUE, "hello")
+
+	c := NewCodec(&buf)
+	m := codec.Message{}
+	if err = c.ReadHeader(&m, codec.Response); err != nil || m.ID != 1 {
+		t.Fatalf("ReadHeader() = %v, message:%+v", err, m)
+	}
+	if m.Header[common.DUBBO_EVENT_HEADER] != common.READONLY_EVENT {
+		t.Errorf("header:%v, the readonly event is lost", m.Header)
+	}
+	if err = c.ReadBody(&rsp); err != nil || rsp != "hello" {
+		t.Errorf("ReadBody() = %q, %v", rsp, err)
+	}
+
+	// the body length of the event is beyond DEFAULT_LEN
+	for _, bodyLen := range []uint32{DEFAULT_LEN + 1, 0xffffffff} {
+		header := [HEADER_LENGTH]byte{MAGIC_HIGH, MAGIC_LOW, FLAG_REQUEST | FLAG_EVENT | 0x02}
+		binary.BigEndian.PutUint32(header[12:], bodyLen)
+		buf.Write(header[:])
+		c = NewCodec(&buf)
+		if err = c.ReadHeader(&codec.Message{}, codec.Response); err != codec.ErrIllegalPackage {
+			t.Errorf("ReadHeader(event body length:%d) = %v", bodyLen, err)
+		}
+		buf.Reset()
+	}
+}
@@ -19,6 +19,53 @@ const (
 	flag = byte(128)
 )
 
+//////////////////////////////////////////
+// hessian protocol version
+//////////////////////////////////////////
+
+type Version int
+
+const (
+	HESSIAN_2 Version = iota // default
+	HESSIAN_1
+)
+
+var versionStrings = [...]string{
+	"hessian2",
+	"hessian1",
+}
+
+func (v Version) String() string {
+	if HESSIAN_2 <= v && v <= HESSIAN_1 {
+		return versionStrings[v]
+	}
+
+	return ""
+}
+
+// hessian 1.0 bytecodes. 'N', 'T', 'F', 'I', 'L', 'D', 'S', 'B' and 'M' are the same as hessian 2.0.
+const (
+	V1_CALL          = byte('c')
+	V1_REPLY         = byte('r')
+	V1_FAULT         = byte('f')
+	V1_METHOD        = byte('m')
+	V1_HEADER        = byte('H')
+	V1_END           = byte('z')
+	V1_DATE          = byte('d')
+	V1_STRING_CHUNK  = byte('s')
+	V1_XML           = byte('X')
+	V1_XML_CHUNK     = byte('x')
+	V1_BINARY_CHUNK  = byte('b')
+	V1_LIST          = byte('V')
+	V1_TYPE          = byte('t')
+	V1_LENGTH        = byte('l')
+	V1_REF           = byte('R')
+	V1_REMOTE        = byte('r')
+	V1_CHUNK_SIZE    = 0x8000
+	V1_MAJOR_VERSION = byte(0x01)
+	V1_MINOR_VERSION = byte(0x00)
+)
+
 const (
 	TAG_READ        = int32(-1)
 	ASCII_GAP       = 32
@@ -33,6 +33,7 @@ import (
 )
 
 type Decoder struct {
+	version       Version
 	reader        *bufio.Reader
 	refs          []interface{}
 	classInfoList []classInfo
@@ -44,7 +45,16 @@ var (
 )
 
 func NewDecoder(b []byte) *Decoder {
-	return &Decoder{reader: bufio.NewReader(bytes.NewReader(b))}
+	return NewDecoderWithVersion(b, HESSIAN_2)
+}
+
+// NewDecoderWithVersion returns a Decoder which decodes @b in hessian protocol @v.
+func NewDecoderWithVersion(b []byte, v Version) *Decoder {
+	return &Decoder{version: v, reader: bufio.NewReader(bytes.NewReader(b))}
+}
+
+func (d *Decoder) Version() Version {
+	return d.version
 }
 
 /////////////////////////////////////////
@@ -150,6 +160,10 @@ func (d *Decoder) Decode() (interface{}, error) {
 		tag byte
 	)
 
+	if d.version == HESSIAN_1 {
+		return d.decodeV1()
+	}
+
 	tag, err = d.readByte()
 	if err == io.EOF {
 		return nil, err
@@ -239,19 +253,19 @@ func (d *Decoder) decInt32(flag int32) (int32, error) {
 	switch {
 	//direct integer
 	case tag >= 0x80 && tag <= 0xbf:
-		return int32(tag - BC_INT_ZERO), nil
+		return int32(tag) - int32(BC_INT_ZERO), nil
 
 	case tag >= 0xc0 && tag <= 0xcf:
 		if _, err = io.ReadFull(d.reader, buf[:1]); err != nil {
 			return 0, jerrors.Trace(err)
 		}
-		return int32(tag-BC_INT_BYTE_ZERO)<<8 + int32(buf[0]), nil
+		return (int32(tag)-int32(BC_INT_BYTE_ZERO))<<8 + int32(buf[0]), nil
 
 	case tag >= 0xd0 && tag <= 0xd7:
 		if _, err = io.ReadFull(d.reader, buf[:2]); err != nil {
 			return 0, jerrors.Trace(err)
 		}
-		return int32(tag-BC_INT_SHORT_ZERO)<<16 + int32(buf[0])<<8 + int32(buf[1]), nil
+		return (int32(tag)-int32(BC_INT_SHORT_ZERO))<<16 + int32(buf[0])<<8 + int32(buf[1]), nil
 
 	case tag == BC_INT:
 		if _, err := io.ReadFull(d.reader, buf[:4]); err != nil {
@@ -300,21 +314,21 @@ func (d *Decoder) decInt64(flag int32) (int64, error) {
 
 		// direct integer
 	case tag >= 0x80 && tag <= 0xbf:
-		return int64(tag - BC_INT_ZERO), nil
+		return int64(tag) - int64(BC_INT_ZERO), nil
 
 		// byte int
 	case tag >= 0xc0 && tag <= 0xcf:
 		if _, err = io.ReadFull(d.reader, buf[:1]); err != nil {
 			return 0, jerrors.Trace(err)
 		}
-		return int64(tag-BC_INT_BYTE_ZERO)<<8 + int64(buf[0]), nil
+		return (int64(tag)-int64(BC_INT_BYTE_ZERO))<<8 + int64(buf[0]), nil
 
 		// short int
 	case tag >= 0xd0 && tag <= 0xd7:
 		if _, err = io.ReadFull(d.reader, buf[:2]); err != nil {
 			return 0, jerrors.Trace(err)
 		}
-		return int64(tag-BC_INT_SHORT_ZERO)<<16 + int64(buf[0])<<8 + int64(buf[1]), nil
+		return (int64(tag)-int64(BC_INT_SHORT_ZERO))<<16 + int64(buf[0])<<8 + int64(buf[1]), nil
 
 	case tag == BC_DOUBLE_BYTE:
 		tag, _ = d.readByte()
@@ -328,30 +342,32 @@ func (d *Decoder) decInt64(flag int32) (int64, error) {
 		return int64(int(buf[0])<<8 + int(buf[1])), nil
 
 	case tag == BC_INT: // 'I'
-		i32, err := d.decInt32(TAG_READ)
+		i32, err := d.decInt32(int32(tag))
 		return int64(i32), err
 
 	case tag == BC_LONG_INT: // x59
-		i32, err := d.decInt32(TAG_READ)
-		return int64(i32), err
+		if _, err = io.ReadFull(d.reader, buf[:4]); err != nil {
+			return 0, jerrors.Trace(err)
+		}
+		return int64(int32(buf[0])<<24 + int32(buf[1])<<16 + int32(buf[2])<<8 + int32(buf[3])), nil
 
 		// direct long
 	case tag >= 0xd8 && tag <= 0xef:
-		return int64(tag - BC_LONG_ZERO), nil
+		return int64(tag) - int64(BC_LONG_ZERO), nil
 
 		// byte long
 	case tag >= 0xf0 && tag <= 0xff:
 		if _, err = io.ReadFull(d.reader, buf[:1]); err != nil {
 			return 0, jerrors.Trace(err)
 		}
-		return int64(tag-BC_LONG_BYTE_ZERO)<<8 + int64(buf[0]), nil
+		return (int64(tag)-int64(BC_LONG_BYTE_ZERO))<<8 + int64(buf[0]), nil
 
 		// short long
 	case tag >= 0x38 && tag <= 0x3f: // ['8',  '?']
 		if _, err := io.ReadFull(d.reader, buf[:2]); err != nil {
 			return 0, jerrors.Trace(err)
 		}
-		return int64(tag-BC_LONG_SHORT_ZERO)<<16 + int64(buf[0])<<8 + int64(buf[1]), nil
+		return (int64(tag)-int64(BC_LONG_SHORT_ZERO))<<16 + int64(buf[0])<<8 + int64(buf[1]), nil
 		// return int64(tag-BC_LONG_SHORT_ZERO)<<16 + int64(buf[0])*256 + int64(buf[1]), nil
 
 	case tag == BC_LONG: // 'L'
@@ -0,0 +1,654 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// decode hessian stream into typed go value directly
+
+package hessian
+
+import (
+	"reflect"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+/////////////////////////////////////////
+// tag class
+/////////////////////////////////////////
+
+func isIntTag(tag byte) bool {
+	return (0x80 <= tag && tag <= 0xbf) || (0xc0 <= tag && tag <= 0xcf) ||
+		(0xd0 <= tag && tag <= 0xd7) || tag == BC_INT
+}
+
+func isLongTag(tag byte) bool {
+	return (0xd8 <= tag && tag <= 0xef) || (0xf0 <= tag && tag <= 0xff) ||
+		(0x38 <= tag && tag <= 0x3f) || tag == BC_LONG_INT || tag == BC_LONG
+}
+
+func isDoubleTag(tag byte) bool {
+	return tag == BC_DOUBLE_ZERO || tag == BC_DOUBLE_ONE || tag == BC_DOUBLE_BYTE ||
+		tag == BC_DOUBLE_SHORT || tag == BC_DOUBLE_MILL || tag == BC_DOUBLE
+}
+
+func isDateTag(tag byte) bool {
+	return tag == BC_DATE || tag == BC_DATE_MINUTE
+}
+
+func isStringTag(tag byte) bool {
+	return (BC_STRING_DIRECT <= tag && tag <= STRING_DIRECT_MAX) || (0x30 <= tag && tag <= 0x33) ||
+		tag == BC_STRING_CHUNK || tag == BC_STRING
+}
+
+func isBinaryTag(tag byte) bool {
+	return (0x20 <= tag && tag <= 0x2f) || (BC_BINARY_SHORT <= tag && tag <= 0x37) ||
+		tag == BC_BINARY_CHUNK || tag == BC_BINARY
+}
+
+func isListTag(tag byte) bool {
+	return (BC_LIST_DIRECT <= tag && tag <= 0x7f) || tag == BC_LIST_FIXED || tag == BC_LIST_VARIABLE ||
+		tag == BC_LIST_FIXED_UNTYPED || tag == BC_LIST_VARIABLE_UNTYPED
+}
+
+func isMapTag(tag byte) bool {
+	return tag == BC_MAP || tag == BC_MAP_UNTYPED
+}
+
+func isObjectTag(tag byte) bool {
+	return tag == BC_OBJECT_DEF || tag == BC_OBJECT ||
+		(BC_OBJECT_DIRECT <= tag && tag <= (BC_OBJECT_DIRECT+OBJECT_DIRECT_MAX))
+}
+
+// the hessian type name of @tag, used in error messages
+func tagTypeName(tag byte) string {
+	switch {
+	case tag == BC_NULL:
+		return "null"
+	case tag == BC_TRUE || tag == BC_FALSE:
+		return "boolean"
+	case isIntTag(tag):
+		return "int"
+	case isLongTag(tag):
+		return "long"
+	case isDoubleTag(tag):
+		return "double"
+	case isDateTag(tag):
+		return "date"
+	case isStringTag(tag):
+		return "string"
+	case isBinaryTag(tag):
+		return "binary"
+	case isListTag(tag):
+		return "list"
+	case isMapTag(tag):
+		return "map"
+	case isObjectTag(tag):
+		return "object"
+	case tag == BC_REF:
+		return "ref"
+	}
+
+	return "unknown"
+}
+
+func errIncompatible(tag byte, typ reflect.Type) error {
+	return jerrors.Errorf("hessian: can not decode %s(tag:%#x) into go value of type %s",
+		tagTypeName(tag), tag, typ.String())
+}
+
+/////////////////////////////////////////
+// DecodeValue
+/////////////////////////////////////////
+
+// DecodeValue decodes the next hessian value into @v directly.
+// If @v is a pointer it will be allocated if necessary. Numbers can be widened
+// (e.g. int to int64 or float64), and a hessian null sets @v to its zero value.
+// An error is returned if the hessian type can not be stored in @v.
+func (d *Decoder) DecodeValue(v reflect.Value) error {
+	if !v.IsValid() {
+		return jerrors.New("hessian: DecodeValue(invalid value)")
+	}
+
+	if !v.CanSet() {
+		if v.Kind() != reflect.Ptr || v.IsNil() {
+			return jerrors.Errorf("hessian: DecodeValue(non-settable %s)", v.Type().String())
+		}
+		v = v.Elem()
+	}
+
+	if d.version == HESSIAN_1 {
+		i, err := d.decodeV1()
+		if err != nil {
+			return jerrors.Trace(err)
+		}
+		return jerrors.Trace(assignValue(v, i))
+	}
+
+	tag, err := d.readByte()
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+
+	return jerrors.Trace(d.decValue(tag, v))
+}
+
+func (d *Decoder) decValue(tag byte, v reflect.Value) error {
+	if tag == BC_NULL {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if tag == BC_REF {
+		ref, err := d.decRef(int32(tag))
+		if err != nil {
+			return jerrors.Trace(err)
+		}
+		return jerrors.Trace(assignValue(v, *(ref.(*interface{}))))
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decValue(tag, v.Elem())
+
+	case reflect.Interface:
+		if d.unreadByte() != nil {
+			return jerrors.Errorf("hessian: can not unread tag:%#x", tag)
+		}
+		i, err := d.Decode()
+		if err != nil {
+			return jerrors.Trace(err)
+		}
+		return jerrors.Trace(assignValue(v, i))
+
+	case reflect.Bool:
+		switch tag {
+		case BC_TRUE:
+			v.SetBool(true)
+		case BC_FALSE:
+			v.SetBool(false)
+		default:
+			return errIncompatible(tag, v.Type())
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !isIntTag(tag) && !isLongTag(tag) {
+			if isObjectTag(tag) && v.Type().Implements(javaEnumType) {
+				return jerrors.Trace(d.decEnumValue(tag, v))
+			}
+			return errIncompatible(tag, v.Type())
+		}
+		i64, err := d.decInt64(int32(tag))
+		if err != nil {
+			return jerrors.Trace(err)
+		}
+		if v.OverflowInt(i64) {
+			return jerrors.Errorf("hessian: value %d overflows go type %s", i64, v.Type().String())
+		}
+		v.SetInt(i64)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if !isIntTag(tag) && !isLongTag(tag) {
+			return errIncompatible(tag, v.Type())
+		}
+		i64, err := d.decInt64(int32(tag))
+		if err != nil {
+			return jerrors.Trace(err)
+		}
+		if i64 < 0 || v.OverflowUint(uint64(i64)) {
+			return jerrors.Errorf("hessian: value %d overflows go type %s", i64, v.Type().String())
+		}
+		v.SetUint(uint64(i64))
+
+	case reflect.Float32, reflect.Float64:
+		switch {
+		case isDoubleTag(tag):
+			f, err := d.decDouble(int32(tag))
+			if err != nil {
+				return jerrors.Trace(err)
+			}
+			v.SetFloat(f.(float64))
+		case isIntTag(tag), isLongTag(tag):
+			i64, err := d.decInt64(int32(tag))
+			if err != nil {
+				return jerrors.Trace(err)
+			}
+			v.SetFloat(float64(i64))
+		default:
+			return errIncompatible(tag, v.Type())
+		}
+
+	case reflect.String:
+		if !isStringTag(tag) {
+			return errIncompatible(tag, v.Type())
+		}
+		s, err := d.decString(int32(tag))
+		if err != nil {
+			return jerrors.Trace(err)
+		}
+		v.SetString(s)
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 && isBinaryTag(tag) {
+			b, err := d.decBinary(int32(tag))
+			if err != nil {
+				return jerrors.Trace(err)
+			}
+			if v.Kind() == reflect.Array {
+				reflect.Copy(v, reflect.ValueOf(b))
+			} else {
+				v.SetBytes(b)
+			}
+			return nil
+		}
+		if !isListTag(tag) {
+			return errIncompatible(tag, v.Type())
+		}
+		return jerrors.Trace(d.decListValue(tag, v))
+
+	case reflect.Map:
+		if !isMapTag(tag) {
+			return errIncompatible(tag, v.Type())
+		}
+		return jerrors.Trace(d.decMapValue(tag, v))
+
+	case reflect.Struct:
+		switch {
+		case v.Type() == timeType:
+			if !isDateTag(tag) {
+				return errIncompatible(tag, v.Type())
+			}
+			t, err := d.decDate(int32(tag))
+			if err != nil {
+				return jerrors.Trace(err)
+			}
+			v.Set(reflect.ValueOf(t))
+		case isObjectTag(tag):
+			return jerrors.Trace(d.decObjectValue(tag, v))
+		case isMapTag(tag):
+			return jerrors.Trace(d.decMapValue(tag, v))
+		default:
+			return errIncompatible(tag, v.Type())
+		}
+
+	default:
+		return jerrors.Errorf("hessian: unsupported go type %s", v.Type().String())
+	}
+
+	return nil
+}
+
+// decode list into slice or array @v
+func (d *Decoder) decListValue(tag byte, v reflect.Value) error {
+	var (
+		size     int
+		variable bool
+	)
+
+	switch {
+	case BC_LIST_DIRECT <= tag && tag <= 0x77:
+		d.decType() // 忽略
+		size = int(tag - BC_LIST_DIRECT)
+	case BC_LIST_DIRECT_UNTYPED <= tag && tag <= 0x7f:
+		size = int(tag - BC_LIST_DIRECT_UNTYPED)
+	case tag == BC_LIST_FIXED, tag == BC_LIST_FIXED_UNTYPED:
+		if tag == BC_LIST_FIXED {
+			d.decType() // 忽略
+		}
+		i32, err := d.decInt32(TAG_READ)
+		if err != nil {
+			return jerrors.Trace(err)
+		}
+		if size = int(i32); size < 0 {
+			return jerrors.Errorf("hessian: illegal list length %d", size)
+		}
+	case tag == BC_LIST_VARIABLE, tag == BC_LIST_VARIABLE_UNTYPED:
+		if tag == BC_LIST_VARIABLE {
+			d.decType() // 忽略
+		}
+		variable = true
+	}
+
+	if v.Kind() == reflect.Slice {
+		// every element takes one byte at least, so the slice is preallocated by the buffered
+		// bytes at most, and it grows with the decoded elements
+		n := size
+		if l := d.len(); l < n {
+			n = l
+		}
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+	} else if !variable && v.Len() < size {
+		return jerrors.Errorf("hessian: list length %d is larger than go array %s", size, v.Type().String())
+	}
+	d.appendRefs(v)
+
+	for i := 0; variable || i < size; i++ {
+		elemTag, err := d.readByte()
+		if err != nil {
+			return jerrors.Trace(err)
+		}
+		if variable && elemTag == BC_END {
+			break
+		}
+		if v.Kind() == reflect.Slice && v.Len() <= i {
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+		}
+		if v.Kind() == reflect.Array && v.Len() <= i {
+			return jerrors.Errorf("hessian: list is longer than go array %s", v.Type().String())
+		}
+		if err = d.decValue(elemTag, v.Index(i)); err != nil {
+			return jerrors.Annotatef(err, "decode list element %d", i)
+		}
+	}
+
+	return nil
+}
+
+// decode map into go map or go struct @v
+func (d *Decoder) decMapValue(tag byte, v reflect.Value) error {
+	var (
+		err    error
+		keyTag byte
+		key    reflect.Value
+		value  reflect.Value
+	)
+
+	if tag == BC_MAP {
+		d.decType() // 忽略
+	}
+
+	if v.Kind() == reflect.Map && v.IsNil() {
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+	d.appendRefs(v)
+
+	for {
+		if keyTag, err = d.readByte(); err != nil {
+			return jerrors.Trace(err)
+		}
+		if keyTag == BC_END {
+			break
+		}
+
+		if v.Kind() == reflect.Struct {
+			var (
+				name  string
+				index int
+				vTag  byte
+			)
+			if name, err = d.decString(int32(keyTag)); err != nil {
+				return jerrors.Annotatef(err, "decode field name of %s", v.Type().String())
+			}
+			if vTag, err = d.readByte(); err != nil {
+				return jerrors.Trace(err)
+			}
+			if index, err = findField(name, v.Type()); err != nil {
+				// unknown field, discard its value
+				d.unreadByte()
+				if _, err = d.Decode(); err != nil {
+					return jerrors.Trace(err)
+				}
+				continue
+			}
+			if err = d.decValue(vTag, v.Field(index)); err != nil {
+				return jerrors.Annotatef(err, "decode field %s of %s", name, v.Type().String())
+			}
+			continue
+		}
+
+		key = reflect.New(v.Type().Key()).Elem()
+		if err = d.decValue(keyTag, key); err != nil {
+			return jerrors.Annotatef(err, "decode key of %s", v.Type().String())
+		}
+		value = reflect.New(v.Type().Elem()).Elem()
+		if err = d.DecodeValue(value); err != nil {
+			return jerrors.Annotatef(err, "decode value of %s[%v]", v.Type().String(), key.Interface())
+		}
+		v.SetMapIndex(key, value)
+	}
+
+	return nil
+}
+
+// decode object into go struct @v
+func (d *Decoder) decObjectValue(tag byte, v reflect.Value) error {
+	var (
+		err   error
+		idx   int32
+		index int
+		vTag  byte
+		cls   classInfo
+	)
+
+	switch {
+	case tag == BC_OBJECT_DEF:
+		clsDef, err := d.decClassDef()
+		if err != nil {
+			return jerrors.Annotate(err, "decObjectValue->decClassDef")
+		}
+		d.appendClsDef(clsDef.(classInfo))
+		if tag, err = d.readByte(); err != nil {
+			return jerrors.Trace(err)
+		}
+		return d.decValue(tag, v)
+
+	case tag == BC_OBJECT:
+		if idx, err = d.decInt32(TAG_READ); err != nil {
+			return jerrors.Trace(err)
+		}
+
+	default:
+		idx = int32(tag - BC_OBJECT_DIRECT)
+	}
+
+	if int(idx) < 0 || len(d.classInfoList) <= int(idx) {
+		return jerrors.Errorf("illegal class index @idx %d", idx)
+	}
+	cls = d.classInfoList[idx]
+
+	d.appendRefs(v)
+	for i := range cls.fieldNameList {
+		if vTag, err = d.readByte(); err != nil {
+			return jerrors.Trace(err)
+		}
+		if index, err = findField(cls.fieldNameList[i], v.Type()); err != nil {
+			// the go struct does not have this java field, discard its value
+			d.unreadByte()
+			if _, err = d.Decode(); err != nil {
+				return jerrors.Trace(err)
+			}
+			continue
+		}
+		if err = d.decValue(vTag, v.Field(index)); err != nil {
+			return jerrors.Annotatef(err, "decode field %s of %s", cls.fieldNameList[i], cls.javaName)
+		}
+	}
+
+	return nil
+}
+
+// decode java enum object into go JavaEnum value @v
+func (d *Decoder) decEnumValue(tag byte, v reflect.Value) error {
+	var (
+		err error
+		idx int32
+		e   JavaEnum
+	)
+
+	switch {
+	case tag == BC_OBJECT_DEF:
+		clsDef, err := d.decClassDef()
+		if err != nil {
+			return jerrors.Annotate(err, "decEnumValue->decClassDef")
+		}
+		d.appendClsDef(clsDef.(classInfo))
+		if tag, err = d.readByte(); err != nil {
+			return jerrors.Trace(err)
+		}
+		return d.decEnumValue(tag, v)
+
+	case tag == BC_OBJECT:
+		if idx, err = d.decInt32(TAG_READ); err != nil {
+			return jerrors.Trace(err)
+		}
+
+	default:
+		idx = int32(tag - BC_OBJECT_DIRECT)
+	}
+
+	if int(idx) < 0 || len(d.classInfoList) <= int(idx) {
+		return jerrors.Errorf("illegal class index @idx %d", idx)
+	}
+	if e, err = d.decEnum(d.classInfoList[idx].javaName, TAG_READ); err != nil {
+		return jerrors.Trace(err)
+	}
+	v.SetInt(int64(e))
+
+	return nil
+}
+
+// assignValue stores the value @in which has been decoded by Decoder.Decode into @v.
+func assignValue(v reflect.Value, in interface{}) error {
+	var (
+		iv reflect.Value
+	)
+
+	if in == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if rv, ok := in.(reflect.Value); ok {
+		iv = rv
+	} else {
+		iv = reflect.ValueOf(in)
+	}
+	for iv.Kind() == reflect.Interface && !iv.IsNil() {
+		iv = iv.Elem()
+	}
+
+	if iv.Type().AssignableTo(v.Type()) {
+		v.Set(iv)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if iv.Kind() == reflect.Ptr {
+			if iv.IsNil() {
+				v.Set(reflect.Zero(v.Type()))
+				return nil
+			}
+			iv = iv.Elem()
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return assignValue(v.Elem(), iv)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch iv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if v.OverflowInt(iv.Int()) {
+				return jerrors.Errorf("hessian: value %d overflows go type %s", iv.Int(), v.Type().String())
+			}
+			v.SetInt(iv.Int())
+			return nil
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch iv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if iv.Int() < 0 || v.OverflowUint(uint64(iv.Int())) {
+				return jerrors.Errorf("hessian: value %d overflows go type %s", iv.Int(), v.Type().String())
+			}
+			v.SetUint(uint64(iv.Int()))
+			return nil
+		}
+
+	case reflect.Float32, reflect.Float64:
+		switch iv.Kind() {
+		case reflect.Float32, reflect.Float64:
+			v.SetFloat(iv.Float())
+			return nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			v.SetFloat(float64(iv.Int()))
+			return nil
+		}
+
+	case reflect.Struct:
+		if iv.Kind() == reflect.Ptr && !iv.IsNil() && iv.Elem().Type().AssignableTo(v.Type()) {
+			v.Set(iv.Elem())
+			return nil
+		}
+		if iv.Kind() == reflect.Map {
+			// fill the struct fields by the map keys
+			for _, k := range iv.MapKeys() {
+				name, ok := k.Interface().(string)
+				if !ok {
+					continue
+				}
+				index, err := findField(name, v.Type())
+				if err != nil {
+					continue
+				}
+				if err = assignValue(v.Field(index), iv.MapIndex(k).Interface()); err != nil {
+					return jerrors.Annotatef(err, "field %s", name)
+				}
+			}
+			return nil
+		}
+
+	case reflect.Slice:
+		if iv.Kind() == reflect.Slice || iv.Kind() == reflect.Array {
+			s := reflect.MakeSlice(v.Type(), iv.Len(), iv.Len())
+			for i := 0; i < iv.Len(); i++ {
+				if err := assignValue(s.Index(i), iv.Index(i).Interface()); err != nil {
+					return jerrors.Annotatef(err, "list element %d", i)
+				}
+			}
+			v.Set(s)
+			return nil
+		}
+
+	case reflect.Map:
+		if iv.Kind() == reflect.Map {
+			m := reflect.MakeMap(v.Type())
+			for _, k := range iv.MapKeys() {
+				key := reflect.New(v.Type().Key()).Elem()
+				if err := assignValue(key, k.Interface()); err != nil {
+					return jerrors.Annotatef(err, "map key %v", k.Interface())
+				}
+				value := reflect.New(v.Type().Elem()).Elem()
+				if err := assignValue(value, iv.MapIndex(k).Interface()); err != nil {
+					return jerrors.Annotatef(err, "map value of key %v", k.Interface())
+				}
+				m.SetMapIndex(key, value)
+			}
+			v.Set(m)
+			return nil
+		}
+	}
+
+	return jerrors.Errorf("hessian: can not assign value of type %s to go value of type %s",
+		iv.Type().String(), v.Type().String())
+}
@@ -33,18 +33,29 @@ import (
 // array object struct
 
 type Encoder struct {
+	version       Version
 	classInfoList []classInfo
 	buffer        []byte
 }
 
 func NewEncoder() *Encoder {
+	return NewEncoderWithVersion(HESSIAN_2)
+}
+
+// NewEncoderWithVersion returns an Encoder which encodes values in hessian protocol @v.
+func NewEncoderWithVersion(v Version) *Encoder {
 	var buffer = make([]byte, 64)
 
 	return &Encoder{
-		buffer: buffer[:0],
+		version: v,
+		buffer:  buffer[:0],
 	}
 }
 
+func (e *Encoder) Version() Version {
+	return e.version
+}
+
 func (e *Encoder) Buffer() []byte {
 	return e.buffer[:]
 }
@@ -55,6 +66,10 @@ func (e *Encoder) Append(buf []byte) {
 
 // If @v can not be encoded, the return value is nil. At present only struct may can not be encoded.
 func (e *Encoder) Encode(v interface{}) error {
+	if e.version == HESSIAN_1 {
+		return e.encodeV1(v)
+	}
+
 	if v == nil {
 		e.buffer = encNull(e.buffer)
 		return nil
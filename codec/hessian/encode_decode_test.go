@@ -596,3 +596,211 @@ func TestEncStruct(t *testing.T) {
 
 	reflect.DeepEqual(w, res)
 }
+
+func TestDecodeValueWiden(t *testing.T) {
+	var (
+		err error
+		e   *Encoder
+		d   *Decoder
+		i64 int64
+		f64 float64
+		pi  *int
+	)
+
+	e = NewEncoder()
+	e.Encode(int32(2017))
+	e.Encode(int32(100))
+	e.Encode(int64(-300))
+	d = NewDecoder(e.Buffer())
+	if err = d.DecodeValue(reflect.ValueOf(&i64)); err != nil || i64 != 2017 {
+		t.Errorf("DecodeValue(int64) = %v, %v", i64, err)
+	}
+	if err = d.DecodeValue(reflect.ValueOf(&f64)); err != nil || f64 != 100 {
+		t.Errorf("DecodeValue(float64) = %v, %v", f64, err)
+	}
+	if err = d.DecodeValue(reflect.ValueOf(&pi)); err != nil || pi == nil || *pi != -300 {
+		t.Errorf("DecodeValue(*int) = %v, %v", pi, err)
+	}
+
+	e = NewEncoder()
+	e.Encode(nil)
+	d = NewDecoder(e.Buffer())
+	if err = d.DecodeValue(reflect.ValueOf(&pi)); err != nil || pi != nil {
+		t.Errorf("DecodeValue(null) = %v, %v", pi, err)
+	}
+}
+
+func TestDecodeValueStruct(t *testing.T) {
+	var (
+		w   WorkerInfo
+		res WorkerInfo
+		err error
+		e   *Encoder
+		d   *Decoder
+	)
+
+	e = NewEncoder()
+	w = WorkerInfo{
+		Name:           "Trump",
+		Addrress:       "W,D.C.",
+		Age:            72,
+		Salary:         21000.03,
+		Payload:        map[string]int32{"Number": 2017061118},
+		FalimyMemebers: []string{"m1", "m2", "m3"},
+		Dpt: Department{
+			Name: "Adm",
+		},
+	}
+	e.Encode(w)
+
+	d = NewDecoder(e.Buffer())
+	if err = d.DecodeValue(reflect.ValueOf(&res)); err != nil {
+		t.Fatalf("DecodeValue() = %v", err)
+	}
+	if !reflect.DeepEqual(w, res) {
+		t.Errorf("DecodeValue() = %#v, want %#v", res, w)
+	}
+}
+
+func TestDecodeValueListMap(t *testing.T) {
+	var (
+		err  error
+		e    *Encoder
+		d    *Decoder
+		list []int64
+		m    map[int64]string
+	)
+
+	e = NewEncoder()
+	e.Encode([]interface{}{int32(1), int64(2), int32(3)})
+	e.Encode(map[int]string{0: "hello", 1: "world"})
+
+	d = NewDecoder(e.Buffer())
+	if err = d.DecodeValue(reflect.ValueOf(&list)); err != nil {
+		t.Fatalf("DecodeValue([]int64) = %v", err)
+	}
+	if !reflect.DeepEqual(list, []int64{1, 2, 3}) {
+		t.Errorf("DecodeValue([]int64) = %v", list)
+	}
+	if err = d.DecodeValue(reflect.ValueOf(&m)); err != nil {
+		t.Fatalf("DecodeValue(map[int64]string) = %v", err)
+	}
+	if !reflect.DeepEqual(m, map[int64]string{0: "hello", 1: "world"}) {
+		t.Errorf("DecodeValue(map[int64]string) = %v", m)
+	}
+}
+
+func TestDecodeValueIncompatible(t *testing.T) {
+	var (
+		err error
+		e   *Encoder
+		d   *Decoder
+		i   int32
+		u   uint8
+	)
+
+	e = NewEncoder()
+	e.Encode("hello")
+	d = NewDecoder(e.Buffer())
+	if err = d.DecodeValue(reflect.ValueOf(&i)); err == nil {
+		t.Errorf("DecodeValue(string into int32) should fail")
+	}
+	t.Logf("DecodeValue(string into int32) = %v", err)
+
+	e = NewEncoder()
+	e.Encode(int32(1024))
+	d = NewDecoder(e.Buffer())
+	if err = d.DecodeValue(reflect.ValueOf(&u)); err == nil {
+		t.Errorf("DecodeValue(1024 into uint8) should fail")
+	}
+	t.Logf("DecodeValue(1024 into uint8) = %v", err)
+}
+
+func TestHessian1EncDec(t *testing.T) {
+	var (
+		err  error
+		e    *Encoder
+		d    *Decoder
+		res  interface{}
+		w    WorkerInfo
+		rw   WorkerInfo
+		list []interface{}
+	)
+
+	e = NewEncoderWithVersion(HESSIAN_1)
+	list = []interface{}{int32(100), int64(-300), 10.001, "hello, 世界😀", []byte{0, 2, 4}, true, nil}
+	if err = e.Encode(list); err != nil {
+		t.Fatalf("Encode(%v) = %v", list, err)
+	}
+	d = NewDecoderWithVersion(e.Buffer(), HESSIAN_1)
+	if res, err = d.Decode(); err != nil {
+		t.Fatalf("Decode() = %v", err)
+	}
+	if !reflect.DeepEqual(list, res) {
+		t.Errorf("Decode() = %#v, want %#v", res, list)
+	}
+
+	e = NewEncoderWithVersion(HESSIAN_1)
+	w = WorkerInfo{
+		Name:           "Trump",
+		Addrress:       "W,D.C.",
+		Age:            72,
+		Salary:         21000.03,
+		Payload:        map[string]int32{"Number": 2017061118},
+		FalimyMemebers: []string{"m1", "m2", "m3"},
+		Dpt: Department{
+			Name: "Adm",
+		},
+	}
+	if err = e.Encode(w); err != nil {
+		t.Fatalf("Encode(%v) = %v", w, err)
+	}
+	d = NewDecoderWithVersion(e.Buffer(), HESSIAN_1)
+	if err = d.DecodeValue(reflect.ValueOf(&rw)); err != nil {
+		t.Fatalf("DecodeValue() = %v", err)
+	}
+	if !reflect.DeepEqual(w, rw) {
+		t.Errorf("DecodeValue() = %#v, want %#v", rw, w)
+	}
+}
+
+func TestHessian1ListLength(t *testing.T) {
+	// a huge length is only a capacity hint
+	b := append([]byte{V1_LIST, V1_LENGTH}, PackInt32(0x7fffffff)...)
+	b = append(b, BC_TRUE, V1_END)
+	res, err := NewDecoderWithVersion(b, HESSIAN_1).Decode()
+	if err != nil || !reflect.DeepEqual(res, []interface{}{true}) {
+		t.Errorf("Decode(huge length) = %#v, %v", res, err)
+	}
+
+	b = append([]byte{V1_LIST, V1_LENGTH}, PackInt32(-1)...)
+	b = append(b, V1_END)
+	if res, err = NewDecoderWithVersion(b, HESSIAN_1).Decode(); err == nil {
+		t.Errorf("Decode(negative length) = %#v", res)
+	}
+}
+
+func TestDecodeValueListLength(t *testing.T) {
+	var (
+		err error
+		bs  []bool
+	)
+
+	b := append([]byte{BC_LIST_FIXED_UNTYPED, BC_INT}, PackInt32(2)...)
+	b = append(b, BC_TRUE, BC_FALSE)
+	if err = NewDecoder(b).DecodeValue(reflect.ValueOf(&bs)); err != nil || !reflect.DeepEqual(bs, []bool{true, false}) {
+		t.Errorf("DecodeValue(list) = %#v, %v", bs, err)
+	}
+
+	// a huge length is capped by the buffered bytes, and fails at the missing elements
+	b = append([]byte{BC_LIST_FIXED_UNTYPED, BC_INT}, PackInt32(0x7fffffff)...)
+	b = append(b, BC_TRUE)
+	if err = NewDecoder(b).DecodeValue(reflect.ValueOf(&bs)); err == nil {
+		t.Errorf("DecodeValue(huge length) = %#v", bs)
+	}
+
+	b = append([]byte{BC_LIST_FIXED_UNTYPED, BC_INT}, PackInt32(-1)...)
+	if err = NewDecoder(b).DecodeValue(reflect.ValueOf(&bs)); err == nil {
+		t.Errorf("DecodeValue(negative length) = %#v", bs)
+	}
+}
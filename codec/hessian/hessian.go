@@ -16,6 +16,7 @@ package hessian
 
 import (
 	"bufio"
+	"encoding/binary"
 	"io"
 )
 
@@ -26,6 +27,7 @@ import (
 
 import (
 	"github.com/AlexStocks/dubbogo/codec"
+	"github.com/AlexStocks/dubbogo/common"
 )
 
 type hessianCodec struct {
@@ -67,6 +69,15 @@ func (h *hessianCodec) ReadHeader(m *codec.Message, mt codec.MessageType) error
 		if err != nil { // this is impossible
 			return jerrors.Trace(err)
 		}
+		// the events sent by the provider, such as the readonly event, come before the response
+		for buf[2]&(FLAG_REQUEST|FLAG_EVENT) == FLAG_REQUEST|FLAG_EVENT {
+			if err = h.readEvent(m, buf); err != nil {
+				return err
+			}
+			if buf, err = h.reader.Peek(HEADER_LENGTH); err != nil {
+				return codec.ErrHeaderNotEnough
+			}
+		}
 		_, err = h.reader.Discard(HEADER_LENGTH)
 		if err != nil { // this is impossible
 			return jerrors.Trace(err)
@@ -97,6 +108,30 @@ func (h *hessianCodec) ReadHeader(m *codec.Message, mt codec.MessageType) error
 	return nil
 }
 
+// readEvent discards the event request in @header sent by the provider. The readonly
+// event is set in m.Header[common.DUBBO_EVENT_HEADER].
+func (h *hessianCodec) readEvent(m *codec.Message, header []byte) error {
+	bodyLen := int(int32(binary.BigEndian.Uint32(header[12:])))
+	if bodyLen < 0 || DEFAULT_LEN < bodyLen {
+		return codec.ErrIllegalPackage
+	}
+	buf, err := h.reader.Peek(HEADER_LENGTH + bodyLen)
+	if err != nil {
+		return codec.ErrHeaderNotEnough
+	}
+
+	event, _ := NewDecoder(buf[HEADER_LENGTH:]).Decode()
+	log.Info("got event %v from the provider", event)
+	if event == common.READONLY_EVENT {
+		if m.Header == nil {
+			m.Header = make(map[string]string)
+		}
+		m.Header[common.DUBBO_EVENT_HEADER] = common.READONLY_EVENT
+	}
+	_, err = h.reader.Discard(HEADER_LENGTH + bodyLen)
+	return jerrors.Trace(err)
+}
+
 func (h *hessianCodec) ReadBody(ret interface{}) error {
 	switch h.mt {
 	case codec.Request:
@@ -0,0 +1,602 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// hessian 1.0 serialization, ref: http://hessian.caucho.com/doc/hessian-1.0-spec.xtp
+
+package hessian
+
+import (
+	"io"
+	"math"
+	"reflect"
+	"time"
+	"unicode/utf16"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+/////////////////////////////////////////
+// encode
+/////////////////////////////////////////
+
+// hessian 1.0 has no compact bytecodes, every value is written in its long form.
+func (e *Encoder) encodeV1(v interface{}) error {
+	if v == nil {
+		e.buffer = encByte(e.buffer, BC_NULL)
+		return nil
+	}
+
+	switch val := v.(type) {
+	case bool:
+		e.buffer = encBool(val, e.buffer)
+
+	case int8:
+		e.buffer = encInt32V1(int32(val), e.buffer)
+
+	case int16:
+		e.buffer = encInt32V1(int32(val), e.buffer)
+
+	case int32:
+		e.buffer = encInt32V1(val, e.buffer)
+
+	case uint8:
+		e.buffer = encInt32V1(int32(val), e.buffer)
+
+	case uint16:
+		e.buffer = encInt32V1(int32(val), e.buffer)
+
+	case int:
+		// the same as hessian 2.0, int is encoded as long
+		e.buffer = encInt64V1(int64(val), e.buffer)
+
+	case int64:
+		e.buffer = encInt64V1(val, e.buffer)
+
+	case uint32:
+		e.buffer = encInt64V1(int64(val), e.buffer)
+
+	case time.Time:
+		e.buffer = encByte(e.buffer, V1_DATE)
+		e.buffer = append(e.buffer, PackInt64(val.UnixNano()/1e6)...)
+
+	case float32:
+		e.buffer = encDoubleV1(float64(val), e.buffer)
+
+	case float64:
+		e.buffer = encDoubleV1(val, e.buffer)
+
+	case string:
+		e.buffer = encStringV1(val, BC_STRING, V1_STRING_CHUNK, e.buffer)
+
+	case []byte:
+		e.buffer = encBinaryV1(val, e.buffer)
+
+	case map[interface{}]interface{}:
+		return e.encMapV1(reflect.ValueOf(val))
+
+	default:
+		if p, ok := v.(POJOEnum); ok {
+			return e.encEnumV1(p)
+		}
+
+		vv := reflect.ValueOf(v)
+		if vv.Kind() == reflect.Ptr {
+			if vv.IsNil() {
+				e.buffer = encByte(e.buffer, BC_NULL)
+				return nil
+			}
+			return e.encodeV1(vv.Elem().Interface())
+		}
+
+		switch vv.Kind() {
+		case reflect.Struct:
+			if p, ok := v.(POJO); ok {
+				return e.encStructV1(p)
+			}
+			return jerrors.Errorf("struct type not Support! %s is not a instance of POJO", vv.Type().String())
+		case reflect.Slice, reflect.Array:
+			return e.encListV1(vv)
+		case reflect.Map:
+			return e.encMapV1(vv)
+		default:
+			return jerrors.Errorf("type not Support! %s", vv.Kind().String())
+		}
+	}
+
+	return nil
+}
+
+// ::= 'I' b32 b24 b16 b8
+func encInt32V1(v int32, b []byte) []byte {
+	b = encByte(b, BC_INT)
+	return append(b, PackInt32(v)...)
+}
+
+// ::= 'L' b64 b56 b48 b40 b32 b24 b16 b8
+func encInt64V1(v int64, b []byte) []byte {
+	b = encByte(b, BC_LONG)
+	return append(b, PackInt64(v)...)
+}
+
+// ::= 'D' b64 b56 b48 b40 b32 b24 b16 b8
+func encDoubleV1(v float64, b []byte) []byte {
+	b = encByte(b, BC_DOUBLE)
+	return append(b, PackFloat64(v)...)
+}
+
+// java writes every utf-16 code unit as utf-8, so a character out of the BMP
+// is written as two 3-byte surrogates.
+func encUTF16Unit(u uint16, b []byte) []byte {
+	switch {
+	case u < 0x80:
+		return append(b, byte(u))
+	case u < 0x800:
+		return append(b, byte(0xc0|(u>>6)), byte(0x80|(u&0x3f)))
+	default:
+		return append(b, byte(0xe0|(u>>12)), byte(0x80|((u>>6)&0x3f)), byte(0x80|(u&0x3f)))
+	}
+}
+
+// the length of string is the number of java chars(utf-16 code units)
+// ::= ('s' b16 b8 utf-8-data)* 'S' b16 b8 utf-8-data
+func encStringV1(v string, final byte, chunk byte, b []byte) []byte {
+	var (
+		n     int
+		units = utf16.Encode([]rune(v))
+	)
+
+	for len(units) > V1_CHUNK_SIZE {
+		n = V1_CHUNK_SIZE
+		// do not split a surrogate pair
+		if tail := units[n-1]; 0xd800 <= tail && tail <= 0xdbff {
+			n--
+		}
+		b = encByte(b, chunk)
+		b = append(b, PackUint16(uint16(n))...)
+		for _, u := range units[:n] {
+			b = encUTF16Unit(u, b)
+		}
+		units = units[n:]
+	}
+
+	b = encByte(b, final)
+	b = append(b, PackUint16(uint16(len(units)))...)
+	for _, u := range units {
+		b = encUTF16Unit(u, b)
+	}
+
+	return b
+}
+
+// ::= ('b' b16 b8 binary-data)* 'B' b16 b8 binary-data
+func encBinaryV1(v []byte, b []byte) []byte {
+	for len(v) > V1_CHUNK_SIZE {
+		b = encByte(b, V1_BINARY_CHUNK)
+		b = append(b, PackUint16(uint16(V1_CHUNK_SIZE))...)
+		b = append(b, v[:V1_CHUNK_SIZE]...)
+		v = v[V1_CHUNK_SIZE:]
+	}
+
+	b = encByte(b, BC_BINARY)
+	b = append(b, PackUint16(uint16(len(v)))...)
+	return append(b, v...)
+}
+
+// ::= 't' b16 b8 type-string
+func encTypeV1(typ string, b []byte) []byte {
+	return encStringV1(typ, V1_TYPE, V1_TYPE, b)
+}
+
+// ::= 'V' type? length? object* 'z'
+func (e *Encoder) encListV1(v reflect.Value) error {
+	var err error
+
+	e.buffer = encByte(e.buffer, V1_LIST, V1_LENGTH)
+	e.buffer = append(e.buffer, PackInt32(int32(v.Len()))...)
+	for i := 0; i < v.Len(); i++ {
+		if err = e.encodeV1(v.Index(i).Interface()); err != nil {
+			return jerrors.Annotatef(err, "list element %d", i)
+		}
+	}
+	e.buffer = encByte(e.buffer, V1_END)
+
+	return nil
+}
+
+// ::= 'M' type? (object object)* 'z'
+func (e *Encoder) encMapV1(v reflect.Value) error {
+	var err error
+
+	e.buffer = encByte(e.buffer, BC_MAP)
+	for _, k := range v.MapKeys() {
+		if err = e.encodeV1(k.Interface()); err != nil {
+			return jerrors.Annotatef(err, "map key %v", k.Interface())
+		}
+		if err = e.encodeV1(v.MapIndex(k).Interface()); err != nil {
+			return jerrors.Annotatef(err, "map value of key %v", k.Interface())
+		}
+	}
+	e.buffer = encByte(e.buffer, V1_END)
+
+	return nil
+}
+
+// java object is written as a typed map whose keys are the field names
+func (e *Encoder) encStructV1(v POJO) error {
+	var (
+		ok     bool
+		idx    int
+		err    error
+		clsDef classInfo
+	)
+
+	idx, ok = checkPOJORegistry(typeof(v))
+	if !ok {
+		idx = RegisterPOJO(v)
+	}
+	if _, clsDef, err = getStructDefByIndex(idx); err != nil {
+		return jerrors.Trace(err)
+	}
+
+	vv := reflect.ValueOf(v)
+	e.buffer = encByte(e.buffer, BC_MAP)
+	e.buffer = encTypeV1(v.JavaClassName(), e.buffer)
+	for i := 0; i < vv.NumField() && i < len(clsDef.fieldNameList); i++ {
+		e.buffer = encStringV1(clsDef.fieldNameList[i], BC_STRING, V1_STRING_CHUNK, e.buffer)
+		if err = e.encodeV1(vv.Field(i).Interface()); err != nil {
+			return jerrors.Annotatef(err, "field %s of %s", clsDef.fieldNameList[i], v.JavaClassName())
+		}
+	}
+	e.buffer = encByte(e.buffer, V1_END)
+
+	return nil
+}
+
+// java enum is written as a typed map with only one key "name"
+func (e *Encoder) encEnumV1(v POJOEnum) error {
+	e.buffer = encByte(e.buffer, BC_MAP)
+	e.buffer = encTypeV1(v.JavaClassName(), e.buffer)
+	e.buffer = encStringV1("name", BC_STRING, V1_STRING_CHUNK, e.buffer)
+	e.buffer = encStringV1(v.String(), BC_STRING, V1_STRING_CHUNK, e.buffer)
+	e.buffer = encByte(e.buffer, V1_END)
+
+	return nil
+}
+
+/////////////////////////////////////////
+// decode
+/////////////////////////////////////////
+
+func (d *Decoder) decodeV1() (interface{}, error) {
+	tag, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.decV1(tag)
+}
+
+func (d *Decoder) decV1(tag byte) (interface{}, error) {
+	var (
+		err error
+		buf [8]byte
+	)
+
+	switch tag {
+	case BC_NULL:
+		return nil, nil
+
+	case BC_TRUE:
+		return true, nil
+
+	case BC_FALSE:
+		return false, nil
+
+	case BC_INT:
+		if _, err = io.ReadFull(d.reader, buf[:4]); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		return UnpackInt32(buf[:4]), nil
+
+	case BC_LONG:
+		if _, err = io.ReadFull(d.reader, buf[:8]); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		return UnpackInt64(buf[:8]), nil
+
+	case BC_DOUBLE:
+		if _, err = io.ReadFull(d.reader, buf[:8]); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		return math.Float64frombits(uint64(UnpackInt64(buf[:8]))), nil
+
+	case V1_DATE:
+		if _, err = io.ReadFull(d.reader, buf[:8]); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		ms := UnpackInt64(buf[:8])
+		return time.Unix(ms/1000, ms%1000*1e6), nil
+
+	case BC_STRING, V1_STRING_CHUNK, V1_XML, V1_XML_CHUNK:
+		return d.decStringV1(tag)
+
+	case BC_BINARY, V1_BINARY_CHUNK:
+		return d.decBinaryV1(tag)
+
+	case V1_LIST:
+		return d.decListV1()
+
+	case BC_MAP:
+		return d.decMapV1()
+
+	case V1_REF:
+		if _, err = io.ReadFull(d.reader, buf[:4]); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		i := int(UnpackInt32(buf[:4]))
+		if i < 0 || len(d.refs) <= i {
+			return nil, ErrIllegalRefIndex
+		}
+		return d.refs[i], nil
+
+	default:
+		return nil, jerrors.Errorf("hessian 1.0 invalid type tag: %#x", tag)
+	}
+}
+
+// read @n java chars which are encoded in utf-8
+func (d *Decoder) readUTF16Units(n int, units []uint16) ([]uint16, error) {
+	var (
+		err error
+		ch  byte
+		buf [3]byte
+		r   rune
+	)
+
+	for i := 0; i < n; i++ {
+		if ch, err = d.readByte(); err != nil {
+			return units, jerrors.Trace(err)
+		}
+
+		switch {
+		case ch < 0x80:
+			units = append(units, uint16(ch))
+
+		case ch&0xe0 == 0xc0:
+			if _, err = io.ReadFull(d.reader, buf[:1]); err != nil {
+				return units, jerrors.Trace(err)
+			}
+			units = append(units, uint16(ch&0x1f)<<6|uint16(buf[0]&0x3f))
+
+		case ch&0xf0 == 0xe0:
+			if _, err = io.ReadFull(d.reader, buf[:2]); err != nil {
+				return units, jerrors.Trace(err)
+			}
+			units = append(units, uint16(ch&0x0f)<<12|uint16(buf[0]&0x3f)<<6|uint16(buf[1]&0x3f))
+
+		case ch&0xf8 == 0xf0:
+			// standard utf-8 4-byte sequence which is two java chars
+			if _, err = io.ReadFull(d.reader, buf[:3]); err != nil {
+				return units, jerrors.Trace(err)
+			}
+			r = rune(ch&0x07)<<18 | rune(buf[0]&0x3f)<<12 | rune(buf[1]&0x3f)<<6 | rune(buf[2]&0x3f)
+			r1, r2 := utf16.EncodeRune(r)
+			units = append(units, uint16(r1), uint16(r2))
+			i++
+
+		default:
+			return units, jerrors.Errorf("hessian 1.0 bad utf-8 encoding byte: %#x", ch)
+		}
+	}
+
+	return units, nil
+}
+
+// ::= ('s' b16 b8 utf-8-data)* 'S' b16 b8 utf-8-data
+// ::= ('x' b16 b8 utf-8-data)* 'X' b16 b8 utf-8-data
+func (d *Decoder) decStringV1(tag byte) (string, error) {
+	var (
+		err   error
+		buf   [2]byte
+		units []uint16
+	)
+
+	for {
+		if _, err = io.ReadFull(d.reader, buf[:2]); err != nil {
+			return "", jerrors.Trace(err)
+		}
+		if units, err = d.readUTF16Units(int(UnpackUint16(buf[:2])), units); err != nil {
+			return "", jerrors.Trace(err)
+		}
+		if tag != V1_STRING_CHUNK && tag != V1_XML_CHUNK {
+			break
+		}
+		if tag, err = d.readByte(); err != nil {
+			return "", jerrors.Trace(err)
+		}
+	}
+
+	return string(utf16.Decode(units)), nil
+}
+
+// ::= ('b' b16 b8 binary-data)* 'B' b16 b8 binary-data
+func (d *Decoder) decBinaryV1(tag byte) ([]byte, error) {
+	var (
+		err  error
+		l    int
+		buf  [2]byte
+		data []byte
+	)
+
+	for {
+		if _, err = io.ReadFull(d.reader, buf[:2]); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		l = int(UnpackUint16(buf[:2]))
+		data = append(data, make([]byte, l)...)
+		if _, err = io.ReadFull(d.reader, data[len(data)-l:]); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		if tag != V1_BINARY_CHUNK {
+			break
+		}
+		if tag, err = d.readByte(); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+	}
+
+	return data, nil
+}
+
+// ::= 't' b16 b8 type-string
+// the type is optional, "" is returned if it does not exist.
+func (d *Decoder) decTypeV1() (string, error) {
+	tag, err := d.readByte()
+	if err != nil {
+		return "", jerrors.Trace(err)
+	}
+	if tag != V1_TYPE {
+		return "", jerrors.Trace(d.unreadByte())
+	}
+
+	return d.decStringV1(V1_TYPE)
+}
+
+// check whether the next byte is the end of list/map or not
+func (d *Decoder) isEndV1() (bool, error) {
+	tag, err := d.readByte()
+	if err != nil {
+		return false, jerrors.Trace(err)
+	}
+	if tag == V1_END {
+		return true, nil
+	}
+
+	return false, jerrors.Trace(d.unreadByte())
+}
+
+// ::= 'V' type? length? object* 'z'
+func (d *Decoder) decListV1() (interface{}, error) {
+	var (
+		err  error
+		end  bool
+		tag  byte
+		buf  [4]byte
+		idx  int
+		item interface{}
+		list []interface{}
+	)
+
+	if _, err = d.decTypeV1(); err != nil {
+		return nil, jerrors.Trace(err)
+	}
+	if tag, err = d.readByte(); err != nil {
+		return nil, jerrors.Trace(err)
+	}
+	if tag == V1_LENGTH {
+		if _, err = io.ReadFull(d.reader, buf[:4]); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		n := int(UnpackInt32(buf[:4]))
+		if n < 0 {
+			return nil, jerrors.Errorf("hessian 1.0 illegal list length %d", n)
+		}
+		// every element takes one byte at least, so the capacity is capped by the buffered bytes
+		if l := d.len(); l < n {
+			n = l
+		}
+		list = make([]interface{}, 0, n)
+	} else if err = d.unreadByte(); err != nil {
+		return nil, jerrors.Trace(err)
+	}
+
+	idx = d.appendRefs(nil)
+	for {
+		if end, err = d.isEndV1(); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		if end {
+			break
+		}
+		if item, err = d.decodeV1(); err != nil {
+			return nil, jerrors.Annotatef(err, "list element %d", len(list))
+		}
+		list = append(list, item)
+	}
+	d.refs[idx] = list
+
+	return list, nil
+}
+
+// ::= 'M' type? (object object)* 'z'
+// a map whose type has been registered by RegisterPOJO/RegisterJavaEnum is decoded into go struct/enum.
+func (d *Decoder) decMapV1() (interface{}, error) {
+	var (
+		err   error
+		ok    bool
+		end   bool
+		idx   int
+		typ   string
+		key   interface{}
+		value interface{}
+		info  structInfo
+		m     map[interface{}]interface{}
+	)
+
+	if typ, err = d.decTypeV1(); err != nil {
+		return nil, jerrors.Trace(err)
+	}
+	if len(typ) != 0 {
+		info, ok = getStructInfo(typ)
+	}
+
+	m = make(map[interface{}]interface{})
+	idx = d.appendRefs(m)
+	for {
+		if end, err = d.isEndV1(); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		if end {
+			break
+		}
+		if key, err = d.decodeV1(); err != nil {
+			return nil, jerrors.Annotate(err, "map key")
+		}
+		if value, err = d.decodeV1(); err != nil {
+			return nil, jerrors.Annotatef(err, "map value of key %v", key)
+		}
+		m[key] = value
+	}
+
+	if !ok {
+		return m, nil
+	}
+
+	if info.typ.Implements(javaEnumType) {
+		name, _ := m["name"].(string)
+		enumValue := info.inst.(POJOEnum).EnumValue(name)
+		d.refs[idx] = enumValue
+		return enumValue, nil
+	}
+
+	inst := reflect.New(info.typ).Elem()
+	if err = assignValue(inst, m); err != nil {
+		return nil, jerrors.Annotatef(err, "decode java object %s", typ)
+	}
+	d.refs[idx] = inst
+
+	return inst, nil
+}
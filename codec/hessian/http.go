@@ -0,0 +1,255 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// hessian rpc over http, which is used to call a plain java HessianServlet.
+
+package hessian
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/codec"
+)
+
+const (
+	HTTP_CONTENT_TYPE = "application/x-hessian"
+
+	V2_CALL_ENVELOPE = byte('H')
+	V2_CALL          = byte('C')
+	V2_REPLY         = byte('R')
+	V2_FAULT         = byte('F')
+	V2_MAJOR_VERSION = byte(0x02)
+	V2_MINOR_VERSION = byte(0x00)
+)
+
+type httpCodec struct {
+	version Version
+	mt      codec.MessageType
+	rwc     io.ReadWriteCloser
+	seq     int64
+	decoder *Decoder
+}
+
+// NewHTTPCodec returns a hessian 2.0 http client codec.
+func NewHTTPCodec(rwc io.ReadWriteCloser) codec.Codec {
+	return &httpCodec{
+		version: HESSIAN_2,
+		rwc:     rwc,
+	}
+}
+
+// NewHTTPCodecWithVersion returns a codec.NewCodec which creates http client codecs
+// in hessian protocol @v, e.g. HESSIAN_1 for legacy hessian 1.0 servlets.
+func NewHTTPCodecWithVersion(v Version) codec.NewCodec {
+	return func(rwc io.ReadWriteCloser) codec.Codec {
+		return &httpCodec{
+			version: v,
+			rwc:     rwc,
+		}
+	}
+}
+
+func (h *httpCodec) Close() error {
+	return h.rwc.Close()
+}
+
+func (h *httpCodec) String() string {
+	return "hessian-http-codec"
+}
+
+// hessian 1.0 call ::= 'c' x01 x00 'm' b16 b8 method-string (object)* 'z'
+// hessian 2.0 call ::= 'H' x02 x00 'C' string int value*
+func (h *httpCodec) Write(m *codec.Message, a interface{}) error {
+	var (
+		err     error
+		ok      bool
+		args    []interface{}
+		encoder *Encoder
+	)
+
+	switch m.Type {
+	case codec.Request:
+	case codec.Response:
+		return jerrors.New("hessian http codec does not support server side")
+	default:
+		return jerrors.Errorf("Unrecognised message type: %v", m.Type)
+	}
+
+	if a != nil {
+		if args, ok = a.([]interface{}); !ok {
+			return jerrors.Errorf("@a is not of type: []interface{}")
+		}
+	}
+
+	encoder = NewEncoderWithVersion(h.version)
+	switch h.version {
+	case HESSIAN_1:
+		encoder.Append([]byte{V1_CALL, V1_MAJOR_VERSION, V1_MINOR_VERSION})
+		encoder.Append(encStringV1(m.Method, V1_METHOD, V1_METHOD, nil))
+	default:
+		encoder.Append([]byte{V2_CALL_ENVELOPE, V2_MAJOR_VERSION, V2_MINOR_VERSION, V2_CALL})
+		encoder.Append(encString(m.Method, nil))
+		encoder.Append(encInt32(int32(len(args)), nil))
+	}
+	for i := range args {
+		if err = encoder.Encode(args[i]); err != nil {
+			return jerrors.Annotatef(err, "encode arg %d", i)
+		}
+	}
+	if h.version == HESSIAN_1 {
+		encoder.Append([]byte{V1_END})
+	}
+
+	h.seq = m.ID
+	m.Header["Content-Type"] = HTTP_CONTENT_TYPE
+	_, err = h.rwc.Write(encoder.Buffer())
+
+	return jerrors.Trace(err)
+}
+
+// hessian 1.0 reply ::= 'r' x01 x00 header* (object | fault) 'z'
+// hessian 2.0 reply ::= 'H' x02 x00 ('R' value | 'F' map)
+// old hessian 2.0 servlets reply 'r' x02 x00 ('R' value | 'F' map) instead.
+func (h *httpCodec) ReadHeader(m *codec.Message, mt codec.MessageType) error {
+	var (
+		err   error
+		buf   []byte
+		tag   byte
+		fault interface{}
+	)
+
+	h.mt = mt
+	switch mt {
+	case codec.Response:
+	case codec.Request:
+		return jerrors.New("hessian http codec does not support server side")
+	default:
+		return jerrors.Errorf("Unrecognised message type: %v", mt)
+	}
+
+	if buf, err = ioutil.ReadAll(h.rwc); err != nil {
+		return jerrors.Trace(err)
+	}
+	if len(buf) == 0 {
+		return codec.ErrHeaderNotEnough
+	}
+
+	m.ID = h.seq
+	m.Type = codec.Response
+	switch {
+	case len(buf) >= 3 && (buf[0] == V2_CALL_ENVELOPE || buf[0] == V1_REPLY) && buf[1] == V2_MAJOR_VERSION:
+		h.decoder = NewDecoderWithVersion(buf[3:], HESSIAN_2)
+	case len(buf) >= 3 && buf[0] == V1_REPLY && buf[1] == V1_MAJOR_VERSION:
+		h.decoder = NewDecoderWithVersion(buf[3:], HESSIAN_1)
+	case buf[0] == V2_REPLY || buf[0] == V2_FAULT:
+		h.decoder = NewDecoderWithVersion(buf, HESSIAN_2)
+	default:
+		return codec.ErrIllegalPackage
+	}
+
+	if tag, err = h.decoder.readByte(); err != nil {
+		return jerrors.Trace(err)
+	}
+	if h.decoder.version == HESSIAN_1 {
+		// skip the reply headers
+		for tag == V1_HEADER {
+			if _, err = h.decoder.decStringV1(BC_STRING); err != nil {
+				return jerrors.Trace(err)
+			}
+			if _, err = h.decoder.decodeV1(); err != nil {
+				return jerrors.Trace(err)
+			}
+			if tag, err = h.decoder.readByte(); err != nil {
+				return jerrors.Trace(err)
+			}
+		}
+		if tag == V1_FAULT {
+			fault, err = h.decoder.decFaultV1()
+		} else {
+			err = h.decoder.unreadByte()
+		}
+	} else {
+		switch tag {
+		case V2_REPLY:
+		case V2_FAULT:
+			fault, err = h.decoder.Decode()
+		default:
+			// 'r' x02 x00 value
+			err = h.decoder.unreadByte()
+		}
+	}
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+
+	if fault != nil {
+		m.Error = faultString(fault)
+	}
+
+	return nil
+}
+
+func (h *httpCodec) ReadBody(ret interface{}) error {
+	if h.mt != codec.Response || h.decoder == nil || ret == nil {
+		return nil
+	}
+
+	return jerrors.Trace(h.decoder.DecodeValue(reflect.ValueOf(ret)))
+}
+
+// fault ::= 'f' (object object)*, the keys are "code", "message" and "detail".
+func (d *Decoder) decFaultV1() (interface{}, error) {
+	var (
+		err   error
+		end   bool
+		key   interface{}
+		value interface{}
+		m     = make(map[interface{}]interface{})
+	)
+
+	for {
+		if end, err = d.isEndV1(); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		if end {
+			break
+		}
+		if key, err = d.decodeV1(); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		if value, err = d.decodeV1(); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		m[key] = value
+	}
+
+	return m, nil
+}
+
+func faultString(fault interface{}) string {
+	if m, ok := fault.(map[interface{}]interface{}); ok {
+		return fmt.Sprintf("hessian fault{code:%v, message:%v}", m["code"], m["message"])
+	}
+
+	return fmt.Sprintf("hessian fault:%+v", fault)
+}
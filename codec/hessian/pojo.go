@@ -255,6 +255,16 @@ func getStructDefByIndex(idx int) (reflect.Type, classInfo, error) {
 	return s.typ, cls, nil
 }
 
+// NewPOJO returns a new instance of the go struct registered for java class @javaName.
+func NewPOJO(javaName string) (POJO, bool) {
+	s, ok := getStructInfo(javaName)
+	if !ok {
+		return nil, false
+	}
+	p, ok := reflect.New(s.typ).Interface().(POJO)
+	return p, ok
+}
+
 // Create a new instance by its struct name is @goName.
 // the return value is nil if @o has been registered.
 func createInstance(goName string) interface{} {
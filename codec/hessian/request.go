@@ -153,6 +153,56 @@ func getArgsTypeList(args []interface{}) (string, error) {
 	return types, nil
 }
 
+// TypedArgs is the args of a dubbo request whose java types are given explicitly
+// rather than deduced from the go values, such as "int", "java.lang.Integer",
+// "java.util.List<java.lang.String>" & "com.ikurento.user.User[]".
+type TypedArgs struct {
+	Types []string
+	Args  []interface{}
+}
+
+var javaPrimitiveTypeDesc = map[string]string{
+	"void":    "V",
+	"boolean": "Z",
+	"byte":    "B",
+	"char":    "C",
+	"short":   "S",
+	"int":     "I",
+	"long":    "J",
+	"float":   "F",
+	"double":  "D",
+}
+
+// getJavaTypeDesc returns the descriptor of @javaType, eg: "[I" of "int[]" and
+// "Ljava/util/List;" of "java.util.List<java.lang.String>".
+func getJavaTypeDesc(javaType string) string {
+	javaType = strings.TrimSpace(javaType)
+	if i := strings.Index(javaType, "<"); i != -1 { // generic type is erased
+		javaType = javaType[:i] + javaType[strings.LastIndex(javaType, ">")+1:]
+	}
+	if strings.HasSuffix(javaType, "[]") {
+		return "[" + getJavaTypeDesc(strings.TrimSuffix(javaType, "[]"))
+	}
+	if desc, ok := javaPrimitiveTypeDesc[javaType]; ok {
+		return desc
+	}
+
+	return "L" + strings.Replace(javaType, ".", "/", -1) + ";"
+}
+
+func getTypedArgsTypeList(args *TypedArgs) (string, error) {
+	if len(args.Types) != len(args.Args) {
+		return "", jerrors.Errorf("%d arg types for %d args", len(args.Types), len(args.Args))
+	}
+
+	var types string
+	for _, typ := range args.Types {
+		types += getJavaTypeDesc(typ)
+	}
+
+	return types, nil
+}
+
 // dubbo-remoting/dubbo-remoting-api/src/main/java/com/alibaba/dubbo/remoting/exchange/codec/ExchangeCodec.java
 // v2.5.4 line 204 encodeRequest
 func packRequest(m *codec.Message, a interface{}, w io.Writer) error {
@@ -166,10 +216,14 @@ func packRequest(m *codec.Message, a interface{}, w io.Writer) error {
 		ok            bool
 		args          []interface{}
 		pkgLen        int
+		start         int
 		serviceParams map[string]string
 	)
 
-	if args, ok = a.([]interface{}); !ok {
+	typedArgs, _ := a.(*TypedArgs)
+	if typedArgs != nil {
+		args = typedArgs.Args
+	} else if args, ok = a.([]interface{}); !ok {
 		return jerrors.Errorf("@b is not of type: []interface{}")
 	}
 
@@ -207,14 +261,20 @@ func packRequest(m *codec.Message, a interface{}, w io.Writer) error {
 	encoder.Encode(m.Method)
 
 	// args = args type list + args value list
-	types, err = getArgsTypeList(args)
+	if typedArgs != nil {
+		types, err = getTypedArgsTypeList(typedArgs)
+	} else {
+		types, err = getArgsTypeList(args)
+	}
 	if err != nil {
 		return jerrors.Annotatef(err, " PackRequest(args:%+v)", args)
 	}
 	encoder.Encode(types)
+	start = len(encoder.Buffer())
 	for _, v := range args {
 		encoder.Encode(v)
 	}
+	m.DigestArgs(encoder.Buffer()[start:])
 
 	serviceParams = make(map[string]string)
 	serviceParams[PATH_KEY] = m.ServicePath
@@ -225,6 +285,10 @@ func packRequest(m *codec.Message, a interface{}, w io.Writer) error {
 	if m.Timeout != 0 {
 		serviceParams[TIMEOUT_KEY] = strconv.Itoa(int(m.Timeout / time.Millisecond))
 	}
+	// attachments, such as the trace context
+	for k, v := range m.Header {
+		serviceParams[k] = v
+	}
 
 	encoder.Encode(serviceParams)
 
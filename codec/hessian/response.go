@@ -43,6 +43,11 @@ const (
 	RESPONSE_NULL_VALUE     int32 = 2
 )
 
+var (
+	// ErrNullResponse is returned when the java method returns null or void.
+	ErrNullResponse = jerrors.New("Received null")
+)
+
 // hessian decode respone
 func unpackResponseHeaer(buf []byte, m *codec.Message) error {
 	// length := len(buf)
@@ -85,8 +90,8 @@ func unpackResponseHeaer(buf []byte, m *codec.Message) error {
 	m.ID = int64(binary.BigEndian.Uint64(buf[4:]))
 
 	// Header{body len}
-	m.BodyLen = int(binary.BigEndian.Uint32(buf[12:]))
-	if m.BodyLen < 0 {
+	m.BodyLen = int(int32(binary.BigEndian.Uint32(buf[12:])))
+	if m.BodyLen < 0 || DEFAULT_LEN < m.BodyLen {
 		return codec.ErrIllegalPackage
 	}
 
@@ -111,14 +116,10 @@ func unpackResponseBody(buf []byte, ret interface{}) error {
 		return jerrors.Errorf("got exception: %+v", expt)
 
 	case RESPONSE_VALUE:
-		rsp, err := decoder.Decode()
-		if err != nil {
-			return jerrors.Trace(err)
-		}
-		return jerrors.Trace(ReflectResponse(rsp, ret))
+		return jerrors.Trace(decoder.DecodeValue(reflect.ValueOf(ret)))
 
 	case RESPONSE_NULL_VALUE:
-		return jerrors.New("Received null")
+		return ErrNullResponse
 	}
 
 	return nil
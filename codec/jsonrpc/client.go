@@ -16,6 +16,7 @@ package jsonrpc
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"reflect"
 	"sync"
@@ -46,8 +47,26 @@ type clientCodec struct {
 
 	sync.Mutex
 	pending map[int64]string
+
+	// batch request
+	batch    Batch
+	batchIDs map[int64]int // request id -> index of its call in batch
+	batchRsp []clientBatchResponse
+}
+
+// Call is one method call of a Batch. A call without Reply is a notification,
+// which is not replied by the server.
+type Call struct {
+	Method string
+	Params interface{}
+	Reply  interface{}
+	Error  error
 }
 
+// Batch is a jsonrpc 2.0 batch request. Its calls are sent in one request, and
+// the responses are mapped back to the calls by request id.
+type Batch []*Call
+
 type clientRequest struct {
 	Version string      `json:"jsonrpc"`
 	Method  string      `json:"method"`
@@ -62,6 +81,22 @@ type clientResponse struct {
 	Error   *Error           `json:"error,omitempty"`
 }
 
+type clientBatchRequest struct {
+	Version string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+	ID      *int64      `json:"id,omitempty"` // notification has no id
+	// the signature of every call, which can not share the http header of the batch
+	Attachments map[string]string `json:"attachments,omitempty"`
+}
+
+type clientBatchResponse struct {
+	Version string           `json:"jsonrpc"`
+	ID      *int64           `json:"id"`
+	Result  *json.RawMessage `json:"result,omitempty"`
+	Error   *Error           `json:"error,omitempty"`
+}
+
 func (r *clientResponse) reset() {
 	r.Version = ""
 	r.ID = 0
@@ -78,10 +113,9 @@ func newClientCodec(conn io.ReadWriteCloser) *clientCodec {
 	}
 }
 
-func (c *clientCodec) Write(m *codec.Message, param interface{}) error {
-	// If return error: it will be returned as is for this call.
-	// Allow param to be only Array, Slice, Map or Struct.
-	// When param is nil or uninitialized Map or Slice - omit "params".
+// checkParam allows param to be only Array, Slice, Map or Struct.
+// When param is nil or uninitialized Map or Slice - omit "params".
+func checkParam(param interface{}) (interface{}, error) {
 	if param != nil {
 		switch k := reflect.TypeOf(param).Kind(); k {
 		case reflect.Map:
@@ -109,17 +143,42 @@ func (c *clientCodec) Write(m *codec.Message, param interface{}) error {
 				}
 			case reflect.Array, reflect.Struct:
 			default:
-				return NewError(errInternal.Code, "unsupported param type: Ptr to "+k.String())
+				return nil, NewError(errInternal.Code, "unsupported param type: Ptr to "+k.String())
 			}
 		default:
-			return NewError(errInternal.Code, "unsupported param type: "+k.String())
+			return nil, NewError(errInternal.Code, "unsupported param type: "+k.String())
 		}
 	}
 
+	return param, nil
+}
+
+func (c *clientCodec) Write(m *codec.Message, param interface{}) error {
+	// If return error: it will be returned as is for this call.
+	if batch, ok := param.(Batch); ok {
+		return c.writeBatch(m, batch)
+	}
+
+	param, err := checkParam(param)
+	if err != nil {
+		return err
+	}
+
 	c.req.Version = VERSION
 	c.req.Method = m.Method
 	// c.req.Params = b
 	c.req.Params = param
+	if param != nil {
+		// the encoded params are signed as they are sent
+		raw, err := json.Marshal(param)
+		if err != nil {
+			return NewError(errInternal.Code, err.Error())
+		}
+		c.req.Params = json.RawMessage(raw)
+		m.DigestArgs(raw)
+	} else {
+		m.DigestArgs(nil)
+	}
 	c.req.ID = m.ID & MAX_JSONRPC_ID
 	c.Lock()
 	// c.pending[m.ID] = m.Method // 此处如果用m.ID会导致error: can not find method of response id 280698512
@@ -129,7 +188,115 @@ func (c *clientCodec) Write(m *codec.Message, param interface{}) error {
 	return c.enc.Encode(&c.req)
 }
 
+// the ids of the calls in @batch are m.ID, m.ID+1, ..., and every call is signed by m.Sign
+func (c *clientCodec) writeBatch(m *codec.Message, batch Batch) error {
+	if len(batch) == 0 {
+		return NewError(errInternal.Code, "empty batch")
+	}
+
+	reqs := make([]clientBatchRequest, 0, len(batch))
+	c.batchIDs = make(map[int64]int, len(batch))
+	for i, call := range batch {
+		params, err := checkParam(call.Params)
+		if err != nil {
+			return err
+		}
+		req := clientBatchRequest{Version: VERSION, Method: call.Method, Params: params}
+		if m.Sign != nil {
+			var raw []byte
+			if params != nil {
+				if raw, err = json.Marshal(params); err != nil {
+					return NewError(errInternal.Code, err.Error())
+				}
+				req.Params = json.RawMessage(raw)
+			}
+			req.Attachments = m.Sign(call.Method, codec.Digest(raw))
+		}
+		if call.Reply != nil {
+			id := (m.ID + int64(i)) & MAX_JSONRPC_ID
+			req.ID = &id
+			c.batchIDs[id] = i
+		}
+		call.Error = nil
+		reqs = append(reqs, req)
+	}
+	c.batch = batch
+
+	return c.enc.Encode(reqs)
+}
+
+func (c *clientCodec) readBatchHeader(m *codec.Message) error {
+	m.Error = ""
+	m.ID = 0
+	c.batchRsp = c.batchRsp[:0]
+	if len(c.batchIDs) == 0 {
+		// the server replies nothing to a batch of notifications
+		return nil
+	}
+
+	var raw json.RawMessage
+	if err := c.dec.Decode(&raw); err != nil {
+		if err == io.EOF {
+			return err
+		}
+		return NewError(errInternal.Code, err.Error())
+	}
+	if len(raw) == 0 || raw[0] != '[' {
+		// the whole batch is rejected, such as a parse error
+		c.resp.reset()
+		if err := json.Unmarshal(raw, &c.resp); err != nil {
+			return NewError(errInternal.Code, err.Error())
+		}
+		if c.resp.Error == nil {
+			return NewError(errInternal.Code, "batch response is not an array")
+		}
+		m.Error = c.resp.Error.Error()
+		return nil
+	}
+	if err := json.Unmarshal(raw, &c.batchRsp); err != nil {
+		return NewError(errInternal.Code, err.Error())
+	}
+
+	return nil
+}
+
+// readBatchBody sets the reply or error of every call in c.batch.
+func (c *clientCodec) readBatchBody() error {
+	for _, rsp := range c.batchRsp {
+		if rsp.ID == nil {
+			log.Warn("batch response without id, error:%v", rsp.Error)
+			continue
+		}
+		i, ok := c.batchIDs[*rsp.ID]
+		if !ok {
+			log.Warn("can not find the call of batch response id %d", *rsp.ID)
+			continue
+		}
+		delete(c.batchIDs, *rsp.ID)
+
+		call := c.batch[i]
+		switch {
+		case rsp.Error != nil:
+			call.Error = rsp.Error
+		case rsp.Result != nil:
+			if err := json.Unmarshal(*rsp.Result, call.Reply); err != nil {
+				call.Error = NewError(errInternal.Code, err.Error())
+			}
+		}
+	}
+	for id, i := range c.batchIDs {
+		c.batch[i].Error = NewError(errInternal.Code, fmt.Sprintf("no response of request id %d", id))
+	}
+	c.batchIDs = nil
+
+	return nil
+}
+
 func (c *clientCodec) ReadHeader(m *codec.Message) error {
+	if c.batch != nil {
+		return c.readBatchHeader(m)
+	}
+
 	c.resp.reset()
 	if err := c.dec.Decode(&c.resp); err != nil {
 		if err == io.EOF {
@@ -162,6 +329,12 @@ func (c *clientCodec) ReadHeader(m *codec.Message) error {
 }
 
 func (c *clientCodec) ReadBody(x interface{}) error {
+	if c.batch != nil {
+		if x == nil { // the whole batch failed
+			return nil
+		}
+		return c.readBatchBody()
+	}
 	if x == nil || c.resp.Result == nil {
 		return nil
 	}
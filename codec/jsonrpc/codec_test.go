@@ -0,0 +1,145 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/codec"
+)
+
+type buffer struct {
+	bytes.Buffer
+}
+
+func (b *buffer) Close() error {
+	return nil
+}
+
+var header = map[string]string{"Path": "/UserProvider", "HttpMethod": "POST"}
+
+func TestBatch(t *testing.T) {
+	var (
+		err    error
+		buf    buffer
+		m      codec.Message
+		arg    []string
+		name   string
+		age    int
+		client = NewCodec(&buf)
+		server = NewCodec(&buf)
+		batch  = Batch{
+			{Method: "GetName", Params: []string{"A003"}, Reply: &name},
+			{Method: "Ping", Params: []string{"A003"}}, // notification
+			{Method: "GetAge", Params: []string{"A004"}, Reply: &age},
+		}
+	)
+
+	m = codec.Message{ID: 100, Type: codec.Request}
+	if err = client.Write(&m, batch); err != nil {
+		t.Fatalf("client.Write(batch) = %v", err)
+	}
+
+	// serve the batch request by request
+	var seqs []int64
+	for i := 0; i < len(batch); i++ {
+		m = codec.Message{Header: header}
+		if err = server.ReadHeader(&m, codec.Request); err != nil {
+			t.Fatalf("server.ReadHeader() = %v", err)
+		}
+		if m.Method != batch[i].Method {
+			t.Errorf("request %d method:%s", i, m.Method)
+		}
+		if err = server.ReadBody(&arg); err != nil {
+			t.Fatalf("server.ReadBody() = %v", err)
+		}
+		seqs = append(seqs, m.ID)
+		if more := server.(codec.Batcher).More(); more != (i < len(batch)-1) {
+			t.Errorf("More() after request %d = %v", i, more)
+		}
+	}
+	// reply in the reverse order, and nothing is written before the last reply
+	buf.Reset()
+	if err = server.Write(&codec.Message{ID: seqs[2], Type: codec.Response, Error: "user A004 not found"}, nil); err != nil {
+		t.Fatalf("server.Write() = %v", err)
+	}
+	if err = server.Write(&codec.Message{ID: seqs[1], Type: codec.Response}, nil); err != nil {
+		t.Fatalf("server.Write() = %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("batch response is written before the last reply: %s", buf.String())
+	}
+	if err = server.Write(&codec.Message{ID: seqs[0], Type: codec.Response}, "Alex"); err != nil {
+		t.Fatalf("server.Write() = %v", err)
+	}
+	var rsps []json.RawMessage
+	if err = json.Unmarshal(buf.Bytes(), &rsps); err != nil || len(rsps) != 2 {
+		t.Fatalf("batch response:%s, err:%v", buf.String(), err)
+	}
+
+	m = codec.Message{}
+	if err = client.ReadHeader(&m, codec.Response); err != nil || m.Error != "" {
+		t.Fatalf("client.ReadHeader() = %v, error:%s", err, m.Error)
+	}
+	if err = client.ReadBody(batch); err != nil {
+		t.Fatalf("client.ReadBody() = %v", err)
+	}
+	if batch[0].Error != nil || name != "Alex" {
+		t.Errorf("GetName() = %v, name:%s", batch[0].Error, name)
+	}
+	if batch[1].Error != nil {
+		t.Errorf("Ping() = %v", batch[1].Error)
+	}
+	if batch[2].Error == nil || ServerError(batch[2].Error).Code != errServer.Code {
+		t.Errorf("GetAge() = %v", batch[2].Error)
+	}
+}
+
+func TestBatchInvalid(t *testing.T) {
+	var (
+		err    error
+		buf    buffer
+		m      codec.Message
+		server = NewCodec(&buf)
+	)
+
+	buf.WriteString(`[1, {"jsonrpc":"2.0","method":"Ping"}]`)
+	for i := 0; i < 2; i++ {
+		m = codec.Message{Header: header}
+		if err = server.ReadHeader(&m, codec.Request); err != nil {
+			t.Fatalf("server.ReadHeader() = %v", err)
+		}
+		if err = server.Write(&codec.Message{ID: m.ID, Type: codec.Response}, nil); err != nil {
+			t.Fatalf("server.Write() = %v", err)
+		}
+	}
+	var rsps []clientBatchResponse
+	if err = json.Unmarshal(buf.Bytes(), &rsps); err != nil || len(rsps) != 1 ||
+		rsps[0].ID != nil || rsps[0].Error == nil || rsps[0].Error.Code != errRequest.Code {
+		t.Errorf("batch response:%s, err:%v", buf.String(), err)
+	}
+
+	// empty batch
+	buf.Reset()
+	buf.WriteString(`[]`)
+	m = codec.Message{Header: header}
+	if err = server.ReadHeader(&m, codec.Request); err == nil {
+		t.Errorf("server.ReadHeader(empty batch) should fail")
+	}
+}
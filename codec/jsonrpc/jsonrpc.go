@@ -79,6 +79,11 @@ func (j *jsonCodec) ReadBody(b interface{}) error {
 	return nil
 }
 
+// More reports whether there are requests of the current batch left.
+func (j *jsonCodec) More() bool {
+	return j.s.More()
+}
+
 func NewCodec(rwc io.ReadWriteCloser) codec.Codec {
 	return &jsonCodec{
 		rwc: rwc,
@@ -48,6 +48,14 @@ type serverCodec struct {
 	mutex   sync.Mutex
 	seq     int64
 	pending map[int64]*json.RawMessage
+
+	// batch request. Its requests are read one by one, and the responses are
+	// written as an array after the last request has been replied.
+	inBatch   bool
+	batch     []json.RawMessage // requests which have not been read
+	unreplied int               // requests of the batch which have been read but not replied
+	batchRsp  []serverResponse
+	invalid   map[int64]struct{} // invalid requests of the batch
 }
 
 // serverRequest represents a JSON-RPC request received by the server.
@@ -60,6 +68,8 @@ type serverRequest struct {
 	Params *json.RawMessage `json:"params"`
 	// The request id. MUST be a string, number or null.
 	ID *json.RawMessage `json:"id"`
+	// The attachments of a request of a batch, such as its signature.
+	Attachments map[string]string `json:"attachments"`
 }
 
 // serverResponse represents a JSON-RPC response returned by the server.
@@ -81,7 +91,6 @@ type serverResponse struct {
 var (
 	null    = json.RawMessage([]byte("null"))
 	Version = "2.0"
-	// BatchMethod = "JSONRPC2.Batch"
 )
 
 // NewServerCodec returns a new rpc.ServerCodec using JSON-RPC 2.0 on conn,
@@ -101,6 +110,7 @@ func newServerCodec(conn io.ReadWriteCloser, srv interface{}) *serverCodec {
 		c:       conn,
 		srv:     srv,
 		pending: make(map[int64]*json.RawMessage),
+		invalid: make(map[int64]struct{}),
 	}
 }
 
@@ -113,12 +123,13 @@ func (r *serverRequest) reset() {
 	if r.ID != nil {
 		*r.ID = (*r.ID)[:0]
 	}
+	r.Attachments = nil
 }
 
 func (r *serverRequest) UnmarshalJSON(raw []byte) error {
 	r.reset()
-	type req *serverRequest
-	if err := json.Unmarshal(raw, req(r)); err != nil {
+	type req serverRequest
+	if err := json.Unmarshal(raw, (*req)(r)); err != nil {
 		return jerrors.New("bad request")
 	}
 
@@ -131,6 +142,7 @@ func (r *serverRequest) UnmarshalJSON(raw []byte) error {
 	}
 	_, okID := o["id"]
 	_, okParams := o["params"]
+	delete(o, "attachments")
 	if len(o) == 3 && !(okID || okParams) || len(o) == 4 && !(okID && okParams) || len(o) > 4 {
 		return jerrors.New("bad request")
 	}
@@ -169,30 +181,68 @@ func (c *serverCodec) ReadHeader(m *codec.Message) error {
 	// So, try to send error reply to client before returning error.
 	var raw json.RawMessage
 	c.req.reset()
-	if err := c.dec.Decode(&raw); err != nil {
-		c.encLock.Lock()
-		c.enc.Encode(serverResponse{Version: Version, ID: &null, Error: errParse})
-		c.encLock.Unlock()
-		return err
-	}
-	// if len(raw) > 0 && raw[0] == '[' {
-	// 	c.req.Version = Version
-	// 	c.req.Method = BatchMethod
-	// 	c.req.Params = &raw
-	// 	c.req.ID = &null
-	// } else
-	if err := json.Unmarshal(raw, &c.req); err != nil {
-		if err.Error() == "bad request" {
+	if len(c.batch) != 0 {
+		raw, c.batch = c.batch[0], c.batch[1:]
+	} else {
+		if err := c.dec.Decode(&raw); err != nil {
 			c.encLock.Lock()
-			c.enc.Encode(serverResponse{Version: Version, ID: &null, Error: errRequest})
+			c.enc.Encode(serverResponse{Version: Version, ID: &null, Error: errParse})
 			c.encLock.Unlock()
+			return err
+		}
+		c.inBatch = false
+		if len(raw) > 0 && raw[0] == '[' {
+			if err := json.Unmarshal(raw, &c.batch); err != nil || len(c.batch) == 0 {
+				c.batch = nil
+				c.encLock.Lock()
+				c.enc.Encode(serverResponse{Version: Version, ID: &null, Error: errRequest})
+				c.encLock.Unlock()
+				return errRequest
+			}
+			c.inBatch = true
+			c.unreplied = 0
+			c.batchRsp = c.batchRsp[:0]
+			raw, c.batch = c.batch[0], c.batch[1:]
 		}
-		return err
+	}
+
+	var invalid bool
+	if err := json.Unmarshal(raw, &c.req); err != nil {
+		if !c.inBatch {
+			if err.Error() == "bad request" {
+				c.encLock.Lock()
+				c.enc.Encode(serverResponse{Version: Version, ID: &null, Error: errRequest})
+				c.encLock.Unlock()
+			}
+			return err
+		}
+		// an invalid request of a batch gets its error response in the batch response,
+		// so the following requests can still be served.
+		invalid = true
+		c.req.reset()
+		c.req.ID = &null
 	}
 
 	m.Method = c.req.Method
 	m.Target = m.Header["Path"] // get Path in http_transport.go:Recv:line 242
+	if len(c.req.Attachments) != 0 {
+		// the attachments of a request of a batch override the shared http header
+		header := make(map[string]string, len(m.Header)+len(c.req.Attachments))
+		for k, v := range m.Header {
+			header[k] = v
+		}
+		for k, v := range c.req.Attachments {
+			header[k] = v
+		}
+		m.Header = header
+	}
+	if c.req.Params != nil {
+		m.ArgsDigest = codec.Digest(*c.req.Params)
+	} else {
+		m.ArgsDigest = codec.Digest(nil)
+	}
 	if m.Header["HttpMethod"] != "POST" {
+		c.batch = nil
 		return errMethod
 	}
 
@@ -202,6 +252,12 @@ func (c *serverCodec) ReadHeader(m *codec.Message) error {
 	c.mutex.Lock()
 	c.seq++
 	c.pending[c.seq] = c.req.ID
+	if invalid {
+		c.invalid[c.seq] = struct{}{}
+	}
+	if c.inBatch {
+		c.unreplied++
+	}
 	c.req.ID = nil
 	m.ID = c.seq
 	c.mutex.Unlock()
@@ -209,6 +265,11 @@ func (c *serverCodec) ReadHeader(m *codec.Message) error {
 	return nil
 }
 
+// More reports whether there are requests of the current batch left.
+func (c *serverCodec) More() bool {
+	return len(c.batch) != 0
+}
+
 // ReadRequest fills the request object for the RPC method.
 //
 // ReadRequest parses request parameters in two supported forms in
@@ -239,19 +300,6 @@ func (c *serverCodec) ReadBody(x interface{}) error {
 
 	// 在这里把请求参数json 字符串转换成了相应的struct
 	params = []byte(*c.req.Params)
-	// if c.req.Method == BatchMethod {
-	// 	return jerrors.Errorf("batch request is not allowed")
-	// 	/*
-	// 		arg := x.(*BatchArg)
-	// 		arg.srv = c.srv
-	// 		if err := json.Unmarshal(*c.req.Params, &arg.reqs); err != nil {
-	// 			return NewError(errParams.Code, err.Error())
-	// 		}
-	// 		if len(arg.reqs) == 0 {
-	// 			return errRequest
-	// 		}
-	// 	*/
-	// } else
 	if err = json.Unmarshal(*c.req.Params, x); err != nil {
 		// Note: if c.request.Params is nil it's not an error, it's an optional member.
 		// JSON params structured object. Unmarshal to the args object.
@@ -289,34 +337,53 @@ func (c *serverCodec) Write(m *codec.Message, x interface{}) error {
 		return jerrors.New("invalid sequence number in response")
 	}
 	delete(c.pending, m.ID)
-	c.mutex.Unlock()
-
-	if b == nil {
-		// Notification. Do not respond.
-		return nil
+	_, invalid := c.invalid[m.ID]
+	delete(c.invalid, m.ID)
+	if c.inBatch {
+		c.unreplied--
 	}
+	c.mutex.Unlock()
 
-	var resp serverResponse = serverResponse{Version: Version, ID: b, Result: x}
-	if m.Error == "" {
-		if x == nil {
-			resp.Result = &null
+	if b != nil { // Notification has no response.
+		resp := serverResponse{Version: Version, ID: b}
+		if invalid {
+			resp.Error = errRequest
+		} else if m.Error == "" {
+			if x == nil {
+				resp.Result = &null
+			} else {
+				resp.Result = x
+			}
+		} else if m.Error[0] == '{' && m.Error[len(m.Error)-1] == '}' {
+			// Well& this check for '{'&'}' isn't too strict, but I
+			// suppose we're trusting our own RPC methods (this way they
+			// can force sending wrong reply or many replies instead
+			// of one) and normal errors won't be formatted this way.
+			raw := json.RawMessage(m.Error)
+			resp.Error = &raw
 		} else {
-			resp.Result = x
+			raw := json.RawMessage(newError(m.Error).Error())
+			resp.Error = &raw
 		}
-	} else if m.Error[0] == '{' && m.Error[len(m.Error)-1] == '}' {
-		// Well& this check for '{'&'}' isn't too strict, but I
-		// suppose we're trusting our own RPC methods (this way they
-		// can force sending wrong reply or many replies instead
-		// of one) and normal errors won't be formatted this way.
-		raw := json.RawMessage(m.Error)
-		resp.Error = &raw
-	} else {
-		raw := json.RawMessage(newError(m.Error).Error())
-		resp.Error = &raw
+
+		if !c.inBatch {
+			c.encLock.Lock()
+			err = c.enc.Encode(resp) // 把resp通过enc关联的conn发送给client
+			c.encLock.Unlock()
+			return err
+		}
+		c.batchRsp = append(c.batchRsp, resp)
+	}
+
+	// write the batch response after the last request has been replied.
+	// If all requests of the batch are notifications, nothing is written.
+	if !c.inBatch || len(c.batch) != 0 || c.unreplied != 0 || len(c.batchRsp) == 0 {
+		return nil
 	}
 	c.encLock.Lock()
-	err = c.enc.Encode(resp) // 把resp通过enc关联的conn发送给client
+	err = c.enc.Encode(c.batchRsp)
 	c.encLock.Unlock()
+	c.batchRsp = c.batchRsp[:0]
 
 	return err
 }
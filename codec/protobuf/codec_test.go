@@ -0,0 +1,116 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protobuf
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+import (
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/codec"
+)
+
+type buffer struct {
+	bytes.Buffer
+}
+
+func (b *buffer) Close() error {
+	return nil
+}
+
+func TestRequestResponse(t *testing.T) {
+	var (
+		err    error
+		buf    buffer
+		pkg    []byte
+		m      codec.Message
+		arg    wrapperspb.StringValue
+		rsp    wrapperspb.Int64Value
+		client = NewCodec(&buf)
+		server = NewCodec(&buf)
+	)
+
+	// client -> server
+	m = codec.Message{
+		ID:          1024,
+		Type:        codec.Request,
+		Target:      "com.ikurento.user.UserProvider",
+		ServicePath: "com.ikurento.user.UserProvider",
+		Version:     "1.0.0",
+		Method:      "GetUser",
+		Timeout:     3 * time.Second,
+		Header:      map[string]string{"token": "dubbogo"},
+	}
+	if err = client.Write(&m, []interface{}{wrapperspb.String("A003")}); err != nil {
+		t.Fatalf("client.Write() = %v", err)
+	}
+
+	// the request arrives in two packages
+	pkg = append(pkg, buf.Bytes()...)
+	buf.Reset()
+	buf.Write(pkg[:10])
+	m = codec.Message{}
+	if err = server.ReadHeader(&m, codec.Request); err != codec.ErrHeaderNotEnough {
+		t.Fatalf("server.ReadHeader(half package) = %v", err)
+	}
+	buf.Write(pkg[10:])
+	if err = server.ReadHeader(&m, codec.Request); err != nil {
+		t.Fatalf("server.ReadHeader() = %v", err)
+	}
+	if m.ID != 1024 || m.Target != "com.ikurento.user.UserProvider" || m.Method != "GetUser" || m.Version != "1.0.0" {
+		t.Errorf("server.ReadHeader() message = %+v", m)
+	}
+	if m.Header["token"] != "dubbogo" || m.Header["timeout"] != "3000" {
+		t.Errorf("server.ReadHeader() attachments = %v", m.Header)
+	}
+	if err = server.ReadBody(&arg); err != nil || arg.GetValue() != "A003" {
+		t.Errorf("server.ReadBody() = %v, arg:%v", err, arg.GetValue())
+	}
+
+	// server -> client
+	buf.Reset()
+	m = codec.Message{ID: 1024, Type: codec.Response}
+	if err = server.Write(&m, wrapperspb.Int64(20180808)); err != nil {
+		t.Fatalf("server.Write() = %v", err)
+	}
+	m = codec.Message{}
+	if err = client.ReadHeader(&m, codec.Response); err != nil || m.ID != 1024 {
+		t.Fatalf("client.ReadHeader() = %v, message:%+v", err, m)
+	}
+	if err = client.ReadBody(&rsp); err != nil || rsp.GetValue() != 20180808 {
+		t.Errorf("client.ReadBody() = %v, rsp:%v", err, rsp.GetValue())
+	}
+
+	// service error
+	buf.Reset()
+	m = codec.Message{ID: 1025, Type: codec.Response, Error: "user not found"}
+	if err = server.Write(&m, nil); err != nil {
+		t.Fatalf("server.Write(error) = %v", err)
+	}
+	m = codec.Message{}
+	if err = client.ReadHeader(&m, codec.Response); err != nil {
+		t.Fatalf("client.ReadHeader() = %v", err)
+	}
+	if err = client.ReadBody(&rsp); err == nil {
+		t.Errorf("client.ReadBody() should return the service error")
+	}
+	t.Logf("client.ReadBody() = %v", err)
+}
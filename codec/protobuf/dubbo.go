@@ -0,0 +1,390 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// dubbo frame whose body is serialized by dubbo-serialization-protobuf:
+// every object is a varint length delimited protobuf message, and string/int
+// are wrapped in google.protobuf.StringValue/Int32Value.
+
+package protobuf
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/codec"
+	"github.com/AlexStocks/dubbogo/codec/hessian"
+)
+
+const (
+	// org.apache.dubbo.common.serialize.Constants.PROTOBUF_SERIALIZATION_ID
+	SERIALIZATION_ID = byte(22)
+
+	DUBBO_VERSION = "2.0.2"
+
+	RESPONSE_WITH_EXCEPTION                  int32 = 0
+	RESPONSE_VALUE                           int32 = 1
+	RESPONSE_NULL_VALUE                      int32 = 2
+	RESPONSE_WITH_EXCEPTION_WITH_ATTACHMENTS int32 = 3
+	RESPONSE_VALUE_WITH_ATTACHMENTS          int32 = 4
+	RESPONSE_NULL_VALUE_WITH_ATTACHMENTS     int32 = 5
+)
+
+// If a generated message implements JavaClass, its java class name is used in the
+// parameter type description of dubbo request. Otherwise the protobuf full name is used.
+type JavaClass interface {
+	JavaClassName() string
+}
+
+type header struct {
+	request bool
+	event   bool
+	status  byte
+	id      int64
+	bodyLen int
+}
+
+/////////////////////////////////////////
+// delimited value
+/////////////////////////////////////////
+
+func appendMessage(b []byte, m proto.Message) ([]byte, error) {
+	buf, err := proto.Marshal(m)
+	if err != nil {
+		return b, jerrors.Trace(err)
+	}
+
+	return protowire.AppendBytes(b, buf), nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b, _ = appendMessage(b, wrapperspb.String(s))
+	return b
+}
+
+func appendInt32(b []byte, i int32) []byte {
+	b, _ = appendMessage(b, wrapperspb.Int32(i))
+	return b
+}
+
+// org.apache.dubbo.common.serialize.protobuf.support.wrapper.MapValue.Map
+// message Map { map<string, string> attachments = 1; }
+func appendAttachments(b []byte, attachments map[string]string) []byte {
+	var m []byte
+
+	for k, v := range attachments {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, k)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, v)
+
+		m = protowire.AppendTag(m, 1, protowire.BytesType)
+		m = protowire.AppendBytes(m, entry)
+	}
+
+	return protowire.AppendBytes(b, m)
+}
+
+// read the next delimited message body from @b
+func consumeBytes(b []byte) ([]byte, []byte, error) {
+	v, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return nil, b, jerrors.Annotate(protowire.ParseError(n), "protowire.ConsumeBytes")
+	}
+
+	return v, b[n:], nil
+}
+
+func consumeMessage(b []byte, m proto.Message) ([]byte, error) {
+	v, b, err := consumeBytes(b)
+	if err != nil {
+		return b, jerrors.Trace(err)
+	}
+
+	return b, jerrors.Trace(proto.Unmarshal(v, m))
+}
+
+func consumeString(b []byte) (string, []byte, error) {
+	var s wrapperspb.StringValue
+	b, err := consumeMessage(b, &s)
+	return s.GetValue(), b, jerrors.Trace(err)
+}
+
+func consumeInt32(b []byte) (int32, []byte, error) {
+	var i wrapperspb.Int32Value
+	b, err := consumeMessage(b, &i)
+	return i.GetValue(), b, jerrors.Trace(err)
+}
+
+func consumeAttachments(b []byte) (map[string]string, []byte, error) {
+	var (
+		err         error
+		m           []byte
+		attachments = make(map[string]string)
+	)
+
+	if m, b, err = consumeBytes(b); err != nil {
+		return nil, b, jerrors.Trace(err)
+	}
+
+	for len(m) > 0 {
+		num, typ, n := protowire.ConsumeTag(m)
+		if n < 0 {
+			return nil, b, protowire.ParseError(n)
+		}
+		m = m[n:]
+		if num != 1 || typ != protowire.BytesType {
+			if n = protowire.ConsumeFieldValue(num, typ, m); n < 0 {
+				return nil, b, protowire.ParseError(n)
+			}
+			m = m[n:]
+			continue
+		}
+
+		entry, n := protowire.ConsumeBytes(m)
+		if n < 0 {
+			return nil, b, protowire.ParseError(n)
+		}
+		m = m[n:]
+
+		var k, v string
+		for len(entry) > 0 {
+			num, typ, n := protowire.ConsumeTag(entry)
+			if n < 0 {
+				return nil, b, protowire.ParseError(n)
+			}
+			entry = entry[n:]
+			if typ != protowire.BytesType {
+				if n = protowire.ConsumeFieldValue(num, typ, entry); n < 0 {
+					return nil, b, protowire.ParseError(n)
+				}
+				entry = entry[n:]
+				continue
+			}
+			s, n := protowire.ConsumeString(entry)
+			if n < 0 {
+				return nil, b, protowire.ParseError(n)
+			}
+			entry = entry[n:]
+			switch num {
+			case 1:
+				k = s
+			case 2:
+				v = s
+			}
+		}
+		attachments[k] = v
+	}
+
+	return attachments, b, nil
+}
+
+/////////////////////////////////////////
+// dubbo header
+/////////////////////////////////////////
+
+func packHeader(b []byte, h header) []byte {
+	var buf [hessian.HEADER_LENGTH]byte
+
+	buf[0] = hessian.MAGIC_HIGH
+	buf[1] = hessian.MAGIC_LOW
+	buf[2] = SERIALIZATION_ID
+	if h.request {
+		buf[2] |= hessian.FLAG_REQUEST | hessian.FLAG_TWOWAY
+	}
+	if h.event {
+		buf[2] |= hessian.FLAG_EVENT
+	}
+	buf[3] = h.status
+	binary.BigEndian.PutUint64(buf[4:], uint64(h.id))
+	binary.BigEndian.PutUint32(buf[12:], uint32(h.bodyLen))
+
+	return append(b, buf[:]...)
+}
+
+func unpackHeader(buf []byte) (header, error) {
+	var h header
+
+	if len(buf) < hessian.HEADER_LENGTH {
+		return h, codec.ErrHeaderNotEnough
+	}
+	if buf[0] != hessian.MAGIC_HIGH || buf[1] != hessian.MAGIC_LOW {
+		return h, codec.ErrIllegalPackage
+	}
+	if serialID := buf[2] & hessian.SERIAL_MASK; serialID != SERIALIZATION_ID {
+		return h, jerrors.Errorf("illegal serialization ID:%d, protobuf serialization ID is %d", serialID, SERIALIZATION_ID)
+	}
+
+	h.request = buf[2]&hessian.FLAG_REQUEST != 0
+	h.event = buf[2]&hessian.FLAG_EVENT != 0
+	h.status = buf[3]
+	h.id = int64(binary.BigEndian.Uint64(buf[4:]))
+	h.bodyLen = int(binary.BigEndian.Uint32(buf[12:]))
+	if h.bodyLen < 0 || h.bodyLen > hessian.DEFAULT_LEN {
+		return h, codec.ErrIllegalPackage
+	}
+
+	return h, nil
+}
+
+func setBodyLen(b []byte) error {
+	bodyLen := len(b) - hessian.HEADER_LENGTH
+	if bodyLen > hessian.DEFAULT_LEN { // 8M
+		return jerrors.Errorf("Data length %d too large, max payload %d", bodyLen, hessian.DEFAULT_LEN)
+	}
+	binary.BigEndian.PutUint32(b[12:], uint32(bodyLen))
+
+	return nil
+}
+
+/////////////////////////////////////////
+// request
+/////////////////////////////////////////
+
+// the parameter type description of a dubbo request, such as "Lcom/ikurento/user/User;"
+func getArgsTypeList(args []proto.Message) string {
+	var (
+		typ   string
+		types string
+	)
+
+	for _, arg := range args {
+		if j, ok := arg.(JavaClass); ok {
+			typ = j.JavaClassName()
+		} else {
+			typ = string(proto.MessageName(arg))
+		}
+		types += "L" + strings.Replace(typ, ".", "/", -1) + ";"
+	}
+
+	return types
+}
+
+func getArgs(a interface{}) ([]proto.Message, error) {
+	switch arg := a.(type) {
+	case nil:
+		return nil, nil
+
+	case proto.Message:
+		return []proto.Message{arg}, nil
+
+	case []proto.Message:
+		return arg, nil
+
+	case []interface{}:
+		args := make([]proto.Message, 0, len(arg))
+		for i := range arg {
+			m, ok := arg[i].(proto.Message)
+			if !ok {
+				return nil, jerrors.Errorf("arg %d{%#v} is not a proto.Message", i, arg[i])
+			}
+			args = append(args, m)
+		}
+		return args, nil
+
+	default:
+		return nil, jerrors.Errorf("@a{%T} is not a proto.Message or []proto.Message", a)
+	}
+}
+
+// dubbo version + path + version + method + args type list + args value list + attachments
+func packRequest(m *codec.Message, a interface{}) ([]byte, error) {
+	var (
+		err  error
+		b    []byte
+		args []proto.Message
+	)
+
+	if args, err = getArgs(a); err != nil {
+		return nil, jerrors.Trace(err)
+	}
+
+	b = packHeader(b, header{request: true, id: m.ID})
+	b = appendString(b, DUBBO_VERSION)
+	b = appendString(b, m.Target)
+	b = appendString(b, m.Version)
+	b = appendString(b, m.Method)
+	b = appendString(b, getArgsTypeList(args))
+	start := len(b)
+	for i := range args {
+		if b, err = appendMessage(b, args[i]); err != nil {
+			return nil, jerrors.Annotatef(err, "marshal arg %d", i)
+		}
+	}
+	m.DigestArgs(b[start:])
+
+	attachments := map[string]string{
+		hessian.PATH_KEY:      m.ServicePath,
+		hessian.INTERFACE_KEY: m.Target,
+	}
+	if len(m.Version) != 0 {
+		attachments[hessian.VERSION_KEY] = m.Version
+	}
+	if m.Timeout != 0 {
+		attachments[hessian.TIMEOUT_KEY] = strconv.Itoa(int(m.Timeout / time.Millisecond))
+	}
+	for k, v := range m.Header {
+		attachments[k] = v
+	}
+	b = appendAttachments(b, attachments)
+
+	return b, jerrors.Trace(setBodyLen(b))
+}
+
+// the oneway event request of @event, such as the readonly event
+func packEvent(event string) ([]byte, error) {
+	b := packHeader(nil, header{request: true, event: true})
+	b[2] &^= hessian.FLAG_TWOWAY // the consumer does not reply the event
+	b = appendString(b, event)
+
+	return b, jerrors.Trace(setBodyLen(b))
+}
+
+/////////////////////////////////////////
+// response
+/////////////////////////////////////////
+
+// a service error is replied as an exception, and a non proto.Message reply is replied as null.
+func packResponse(m *codec.Message, a interface{}) ([]byte, error) {
+	var (
+		err error
+		b   []byte
+	)
+
+	b = packHeader(b, header{id: m.ID, status: hessian.Response_OK})
+	if len(m.Error) != 0 {
+		b = appendInt32(b, RESPONSE_WITH_EXCEPTION)
+		b = appendString(b, m.Error)
+	} else if rsp, ok := a.(proto.Message); ok && rsp != nil {
+		b = appendInt32(b, RESPONSE_VALUE)
+		if b, err = appendMessage(b, rsp); err != nil {
+			return nil, jerrors.Annotate(err, "marshal response")
+		}
+	} else {
+		b = appendInt32(b, RESPONSE_NULL_VALUE)
+	}
+
+	return b, jerrors.Trace(setBodyLen(b))
+}
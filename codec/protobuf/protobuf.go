@@ -0,0 +1,309 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protobuf
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/codec"
+	"github.com/AlexStocks/dubbogo/codec/hessian"
+	"github.com/AlexStocks/dubbogo/common"
+)
+
+type protobufCodec struct {
+	mt  codec.MessageType
+	rwc io.ReadWriteCloser
+	buf []byte // received bytes which have not been decoded
+
+	header header
+	body   []byte // the rest of current package body
+}
+
+func (c *protobufCodec) Close() error {
+	return c.rwc.Close()
+}
+
+func (c *protobufCodec) String() string {
+	return "protobuf-codec"
+}
+
+func (c *protobufCodec) Write(m *codec.Message, a interface{}) error {
+	var (
+		err error
+		b   []byte
+	)
+
+	switch m.Type {
+	case codec.Request:
+		b, err = packRequest(m, a)
+	case codec.Response:
+		b, err = packResponse(m, a)
+	default:
+		return jerrors.Errorf("Unrecognised message type: %v", m.Type)
+	}
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+
+	_, err = c.rwc.Write(b)
+	return jerrors.Trace(err)
+}
+
+// WriteEvent writes the event request sent by the provider to the consumer
+func (c *protobufCodec) WriteEvent(event string) error {
+	b, err := packEvent(event)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+
+	_, err = c.rwc.Write(b)
+	return jerrors.Trace(err)
+}
+
+// read all the received bytes from @c.rwc
+func (c *protobufCodec) fill() error {
+	b, err := ioutil.ReadAll(c.rwc)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+	c.buf = append(c.buf, b...)
+
+	return nil
+}
+
+// take the next whole package body from @c.buf
+func (c *protobufCodec) takeBody() bool {
+	if len(c.buf) < hessian.HEADER_LENGTH+c.header.bodyLen {
+		return false
+	}
+	c.body = c.buf[hessian.HEADER_LENGTH : hessian.HEADER_LENGTH+c.header.bodyLen]
+	c.buf = c.buf[hessian.HEADER_LENGTH+c.header.bodyLen:]
+
+	return true
+}
+
+func (c *protobufCodec) ReadHeader(m *codec.Message, mt codec.MessageType) error {
+	var err error
+
+	c.mt = mt
+	if err = c.fill(); err != nil {
+		return jerrors.Trace(err)
+	}
+	if c.header, err = unpackHeader(c.buf); err != nil {
+		return err // codec.ErrHeaderNotEnough should not be traced
+	}
+
+	switch mt {
+	case codec.Request:
+		if !c.header.request {
+			return jerrors.Errorf("package %d is not a request", c.header.id)
+		}
+		// service & method are in the body
+		if !c.takeBody() {
+			return codec.ErrHeaderNotEnough
+		}
+		return jerrors.Trace(c.readRequestHeader(m))
+
+	case codec.Response:
+		// the events sent by the provider, such as the readonly event, come before the response
+		for c.header.request && c.header.event {
+			if err = c.readEvent(m); err != nil {
+				return err
+			}
+			if c.header, err = unpackHeader(c.buf); err != nil {
+				return err
+			}
+		}
+		if c.header.request {
+			return jerrors.Errorf("package %d is not a response", c.header.id)
+		}
+		m.ID = c.header.id
+		m.Type = codec.Response
+		if c.header.event {
+			m.Type |= codec.Heartbeat
+		}
+		return nil
+
+	default:
+		return jerrors.Errorf("Unrecognised message type: %v", mt)
+	}
+}
+
+// readEvent discards the event request sent by the provider. The readonly event is
+// set in m.Header[common.DUBBO_EVENT_HEADER].
+func (c *protobufCodec) readEvent(m *codec.Message) error {
+	if !c.takeBody() {
+		return codec.ErrHeaderNotEnough
+	}
+	event, _, err := consumeString(c.body)
+	if err != nil {
+		return jerrors.Annotate(err, "decode event")
+	}
+	if event == common.READONLY_EVENT {
+		if m.Header == nil {
+			m.Header = make(map[string]string)
+		}
+		m.Header[common.DUBBO_EVENT_HEADER] = common.READONLY_EVENT
+	}
+
+	return nil
+}
+
+func (c *protobufCodec) readRequestHeader(m *codec.Message) error {
+	var err error
+
+	m.ID = c.header.id
+	m.Type = codec.Request
+	if c.header.event {
+		m.Type = codec.Heartbeat
+		return nil
+	}
+
+	if _, c.body, err = consumeString(c.body); err != nil { // dubbo version
+		return jerrors.Annotate(err, "decode dubbo version")
+	}
+	if m.Target, c.body, err = consumeString(c.body); err != nil { // path
+		return jerrors.Annotate(err, "decode service path")
+	}
+	m.ServicePath = m.Target
+	if m.Version, c.body, err = consumeString(c.body); err != nil {
+		return jerrors.Annotate(err, "decode service version")
+	}
+	if m.Method, c.body, err = consumeString(c.body); err != nil {
+		return jerrors.Annotate(err, "decode method")
+	}
+	var types string
+	if types, c.body, err = consumeString(c.body); err != nil { // args type list
+		return jerrors.Annotate(err, "decode args type list")
+	}
+
+	// the attachments follow the args, such as the token & the trace context
+	b := c.body
+	for i := strings.Count(types, ";"); 0 < i; i-- {
+		if _, b, err = consumeBytes(b); err != nil {
+			return jerrors.Annotate(err, "skip args")
+		}
+	}
+	m.ArgsDigest = codec.Digest(c.body[:len(c.body)-len(b)])
+	if len(b) == 0 {
+		return nil
+	}
+	attachments, _, err := consumeAttachments(b)
+	if err != nil {
+		return jerrors.Annotate(err, "decode attachments")
+	}
+	if m.Header == nil {
+		m.Header = make(map[string]string, len(attachments))
+	}
+	for k, v := range attachments {
+		m.Header[k] = v
+	}
+
+	return nil
+}
+
+func (c *protobufCodec) ReadBody(ret interface{}) error {
+	switch c.mt {
+	case codec.Request:
+		return jerrors.Trace(c.readRequestBody(ret))
+
+	case codec.Response:
+		if !c.takeBody() {
+			if err := c.fill(); err != nil {
+				return jerrors.Trace(err)
+			}
+			if !c.takeBody() {
+				return codec.ErrBodyNotEnough
+			}
+		}
+		return jerrors.Trace(c.readResponseBody(ret))
+
+	default:
+		return jerrors.Errorf("Unrecognised message type: %v", c.mt)
+	}
+}
+
+// decode the first arg into @ret. the other args and the attachments are dropped.
+func (c *protobufCodec) readRequestBody(ret interface{}) error {
+	if ret == nil || c.header.event {
+		return nil
+	}
+
+	msg, ok := ret.(proto.Message)
+	if !ok {
+		return jerrors.Errorf("@ret{%T} is not a proto.Message", ret)
+	}
+
+	_, err := consumeMessage(c.body, msg)
+	return jerrors.Annotate(err, "decode arg")
+}
+
+func (c *protobufCodec) readResponseBody(ret interface{}) error {
+	var (
+		err     error
+		rspType int32
+		errMsg  string
+	)
+
+	if c.header.status != hessian.Response_OK {
+		errMsg, _, _ = consumeString(c.body)
+		return jerrors.Errorf("dubbo response status:%d, error:%s", c.header.status, errMsg)
+	}
+	if c.header.event { // heartbeat
+		return nil
+	}
+
+	if rspType, c.body, err = consumeInt32(c.body); err != nil {
+		return jerrors.Annotate(err, "decode response type")
+	}
+
+	switch rspType {
+	case RESPONSE_WITH_EXCEPTION, RESPONSE_WITH_EXCEPTION_WITH_ATTACHMENTS:
+		errMsg, _, _ = consumeString(c.body)
+		return jerrors.Errorf("got exception: %s", errMsg)
+
+	case RESPONSE_VALUE, RESPONSE_VALUE_WITH_ATTACHMENTS:
+		if ret == nil {
+			return nil
+		}
+		msg, ok := ret.(proto.Message)
+		if !ok {
+			return jerrors.Errorf("@ret{%T} is not a proto.Message", ret)
+		}
+		_, err = consumeMessage(c.body, msg)
+		return jerrors.Annotate(err, "decode response")
+
+	case RESPONSE_NULL_VALUE, RESPONSE_NULL_VALUE_WITH_ATTACHMENTS:
+		return nil
+
+	default:
+		return jerrors.Errorf("illegal response type:%d", rspType)
+	}
+}
+
+func NewCodec(rwc io.ReadWriteCloser) codec.Codec {
+	return &protobufCodec{
+		rwc: rwc,
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thrift
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/codec"
+)
+
+type buffer struct {
+	bytes.Buffer
+}
+
+func (b *buffer) Close() error {
+	return nil
+}
+
+type User struct {
+	ID      string           `thrift:"id,1"`
+	Name    string           `thrift:"name,2"`
+	Age     int32            `thrift:"age,3"`
+	Male    bool             `thrift:"male,4"`
+	Score   float64          `thrift:"score,5"`
+	Tags    []string         `thrift:"tags,6"`
+	Attrs   map[string]int64 `thrift:"attrs,7"`
+	Friends []*User          `thrift:"friends,20"`
+	Avatar  []byte           `thrift:"avatar,21"`
+	Deleted bool             `thrift:"deleted,22"`
+}
+
+func testRequestResponse(t *testing.T, newCodec codec.NewCodec) {
+	var (
+		err    error
+		buf    buffer
+		pkg    []byte
+		m      codec.Message
+		arg    User
+		rsp    User
+		client = newCodec(&buf)
+		server = newCodec(&buf)
+		user   = User{
+			ID:      "A003",
+			Name:    "Alex Stocks",
+			Age:     -18,
+			Male:    true,
+			Score:   99.5,
+			Tags:    []string{"golang", "dubbo"},
+			Attrs:   map[string]int64{"level": 3},
+			Friends: []*User{{ID: "A004", Age: 20}},
+			Avatar:  []byte{0, 1, 2},
+		}
+	)
+
+	// client -> server
+	m = codec.Message{
+		ID:     1024,
+		Type:   codec.Request,
+		Target: "com.ikurento.user.UserProvider",
+		Method: "GetUser",
+		Header: map[string]string{"token": "dubbogo"},
+	}
+	if err = client.Write(&m, []interface{}{&user}); err != nil {
+		t.Fatalf("client.Write() = %v", err)
+	}
+
+	// the request arrives in two packages
+	pkg = append(pkg, buf.Bytes()...)
+	buf.Reset()
+	buf.Write(pkg[:10])
+	m = codec.Message{}
+	if err = server.ReadHeader(&m, codec.Request); err != codec.ErrHeaderNotEnough {
+		t.Fatalf("server.ReadHeader(half package) = %v", err)
+	}
+	buf.Write(pkg[10:])
+	if err = server.ReadHeader(&m, codec.Request); err != nil {
+		t.Fatalf("server.ReadHeader() = %v", err)
+	}
+	if m.ID != 1024 || m.Method != "GetUser" || m.Header["token"] != "dubbogo" {
+		t.Errorf("server.ReadHeader() message = %+v", m)
+	}
+	if err = server.ReadBody(&arg); err != nil || !reflect.DeepEqual(arg, user) {
+		t.Errorf("server.ReadBody() = %v, arg:%+v", err, arg)
+	}
+
+	// server -> client
+	buf.Reset()
+	m = codec.Message{ID: 1024, Type: codec.Response}
+	if err = server.Write(&m, &user); err != nil {
+		t.Fatalf("server.Write() = %v", err)
+	}
+	m = codec.Message{}
+	if err = client.ReadHeader(&m, codec.Response); err != nil || m.ID != 1024 || m.Method != "GetUser" {
+		t.Fatalf("client.ReadHeader() = %v, message:%+v", err, m)
+	}
+	if err = client.ReadBody(&rsp); err != nil || !reflect.DeepEqual(rsp, user) {
+		t.Errorf("client.ReadBody() = %v, rsp:%+v", err, rsp)
+	}
+
+	// service error
+	buf.Reset()
+	m = codec.Message{ID: 1025, Type: codec.Response, Error: "user not found"}
+	if err = server.Write(&m, nil); err != nil {
+		t.Fatalf("server.Write(error) = %v", err)
+	}
+	m = codec.Message{}
+	if err = client.ReadHeader(&m, codec.Response); err != nil || m.Error != "user not found" {
+		t.Fatalf("client.ReadHeader() = %v, message:%+v", err, m)
+	}
+	if err = client.ReadBody(nil); err != nil {
+		t.Errorf("client.ReadBody(nil) = %v", err)
+	}
+}
+
+func TestBinaryCodec(t *testing.T) {
+	testRequestResponse(t, NewCodec)
+}
+
+func TestCompactCodec(t *testing.T) {
+	testRequestResponse(t, NewCompactCodec)
+}
+
+func TestMultiplexed(t *testing.T) {
+	var (
+		err    error
+		buf    buffer
+		m      codec.Message
+		arg    string
+		client = NewCodecWithOptions(WithProtocol(COMPACT), Multiplexed())(&buf)
+		server = NewCodec(&buf)
+	)
+
+	m = codec.Message{ID: 1, Type: codec.Request, Target: "UserProvider", Method: "GetUser"}
+	if err = client.Write(&m, "A003"); err != nil {
+		t.Fatalf("client.Write() = %v", err)
+	}
+	m = codec.Message{}
+	if err = server.ReadHeader(&m, codec.Request); err != nil || m.Target != "UserProvider" || m.Method != "GetUser" {
+		t.Fatalf("server.ReadHeader() = %v, message:%+v", err, m)
+	}
+	if err = server.ReadBody(&arg); err != nil || arg != "A003" {
+		t.Errorf("server.ReadBody() = %v, arg:%s", err, arg)
+	}
+}
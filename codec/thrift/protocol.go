@@ -0,0 +1,707 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// thrift binary & compact protocol
+// ref: https://github.com/apache/thrift/blob/master/doc/specs/thrift-binary-protocol.md
+// ref: https://github.com/apache/thrift/blob/master/doc/specs/thrift-compact-protocol.md
+
+package thrift
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+type Protocol int
+
+const (
+	BINARY Protocol = iota
+	COMPACT
+)
+
+var protocolStrings = [...]string{
+	"binary",
+	"compact",
+}
+
+func (p Protocol) String() string {
+	if BINARY <= p && p <= COMPACT {
+		return protocolStrings[p]
+	}
+
+	return ""
+}
+
+// thrift type
+const (
+	STOP   = byte(0)
+	VOID   = byte(1)
+	BOOL   = byte(2)
+	BYTE   = byte(3)
+	DOUBLE = byte(4)
+	I16    = byte(6)
+	I32    = byte(8)
+	I64    = byte(10)
+	STRING = byte(11)
+	STRUCT = byte(12)
+	MAP    = byte(13)
+	SET    = byte(14)
+	LIST   = byte(15)
+)
+
+// thrift message type
+const (
+	CALL      = byte(1)
+	REPLY     = byte(2)
+	EXCEPTION = byte(3)
+	ONEWAY    = byte(4)
+)
+
+const (
+	BINARY_VERSION_1    = uint32(0x80010000)
+	BINARY_VERSION_MASK = uint32(0xffff0000)
+
+	COMPACT_PROTOCOL_ID  = byte(0x82)
+	COMPACT_VERSION      = byte(1)
+	COMPACT_VERSION_MASK = byte(0x1f)
+	COMPACT_TYPE_SHIFT   = 5
+
+	// compact type
+	COMPACT_BOOLEAN_TRUE  = byte(0x01)
+	COMPACT_BOOLEAN_FALSE = byte(0x02)
+	COMPACT_BYTE          = byte(0x03)
+	COMPACT_I16           = byte(0x04)
+	COMPACT_I32           = byte(0x05)
+	COMPACT_I64           = byte(0x06)
+	COMPACT_DOUBLE        = byte(0x07)
+	COMPACT_BINARY        = byte(0x08)
+	COMPACT_LIST          = byte(0x09)
+	COMPACT_SET           = byte(0x0a)
+	COMPACT_MAP           = byte(0x0b)
+	COMPACT_STRUCT        = byte(0x0c)
+)
+
+var (
+	ErrNotEnoughBuf = jerrors.New("not enough buf")
+
+	ttype2Compact = map[byte]byte{
+		STOP:   STOP,
+		BOOL:   COMPACT_BOOLEAN_TRUE,
+		BYTE:   COMPACT_BYTE,
+		I16:    COMPACT_I16,
+		I32:    COMPACT_I32,
+		I64:    COMPACT_I64,
+		DOUBLE: COMPACT_DOUBLE,
+		STRING: COMPACT_BINARY,
+		LIST:   COMPACT_LIST,
+		SET:    COMPACT_SET,
+		MAP:    COMPACT_MAP,
+		STRUCT: COMPACT_STRUCT,
+	}
+
+	compact2Ttype = map[byte]byte{
+		STOP:                  STOP,
+		COMPACT_BOOLEAN_TRUE:  BOOL,
+		COMPACT_BOOLEAN_FALSE: BOOL,
+		COMPACT_BYTE:          BYTE,
+		COMPACT_I16:           I16,
+		COMPACT_I32:           I32,
+		COMPACT_I64:           I64,
+		COMPACT_DOUBLE:        DOUBLE,
+		COMPACT_BINARY:        STRING,
+		COMPACT_LIST:          LIST,
+		COMPACT_SET:           SET,
+		COMPACT_MAP:           MAP,
+		COMPACT_STRUCT:        STRUCT,
+	}
+)
+
+/////////////////////////////////////////
+// encoder
+/////////////////////////////////////////
+
+type encoder struct {
+	protocol  Protocol
+	buf       []byte
+	lastField []int16 // compact field id delta stack
+}
+
+func newEncoder(p Protocol) *encoder {
+	return &encoder{protocol: p, lastField: []int16{0}}
+}
+
+func (e *encoder) Buffer() []byte {
+	return e.buf
+}
+
+func (e *encoder) writeVarint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func zigzag64(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func (e *encoder) writeMessageBegin(name string, typ byte, seq int32) {
+	switch e.protocol {
+	case COMPACT:
+		e.buf = append(e.buf, COMPACT_PROTOCOL_ID, COMPACT_VERSION|(typ<<COMPACT_TYPE_SHIFT))
+		e.writeVarint(uint64(uint32(seq)))
+		e.writeBinary([]byte(name))
+	default:
+		e.writeI32(int32(BINARY_VERSION_1 | uint32(typ)))
+		e.writeBinary([]byte(name))
+		e.writeI32(seq)
+	}
+}
+
+func (e *encoder) writeStructBegin() {
+	e.lastField = append(e.lastField, 0)
+}
+
+func (e *encoder) writeStructEnd() {
+	e.buf = append(e.buf, STOP)
+	e.lastField = e.lastField[:len(e.lastField)-1]
+}
+
+func (e *encoder) writeCompactFieldHeader(ctype byte, id int16) {
+	last := &e.lastField[len(e.lastField)-1]
+	if delta := id - *last; 0 < delta && delta <= 15 {
+		e.buf = append(e.buf, byte(delta)<<4|ctype)
+	} else {
+		e.buf = append(e.buf, ctype)
+		e.writeVarint(zigzag64(int64(id)))
+	}
+	*last = id
+}
+
+func (e *encoder) writeFieldBegin(typ byte, id int16) {
+	switch e.protocol {
+	case COMPACT:
+		e.writeCompactFieldHeader(ttype2Compact[typ], id)
+	default:
+		e.buf = append(e.buf, typ)
+		e.writeI16(id)
+	}
+}
+
+// compact protocol encodes the bool field value in the field header
+func (e *encoder) writeBoolField(id int16, v bool) {
+	if e.protocol == COMPACT {
+		ctype := COMPACT_BOOLEAN_FALSE
+		if v {
+			ctype = COMPACT_BOOLEAN_TRUE
+		}
+		e.writeCompactFieldHeader(ctype, id)
+		return
+	}
+
+	e.writeFieldBegin(BOOL, id)
+	e.writeBool(v)
+}
+
+func (e *encoder) writeListBegin(elemType byte, size int) {
+	switch e.protocol {
+	case COMPACT:
+		if size < 15 {
+			e.buf = append(e.buf, byte(size)<<4|ttype2Compact[elemType])
+		} else {
+			e.buf = append(e.buf, 0xf0|ttype2Compact[elemType])
+			e.writeVarint(uint64(size))
+		}
+	default:
+		e.buf = append(e.buf, elemType)
+		e.writeI32(int32(size))
+	}
+}
+
+func (e *encoder) writeMapBegin(keyType, valueType byte, size int) {
+	switch e.protocol {
+	case COMPACT:
+		if size == 0 {
+			e.buf = append(e.buf, 0)
+			return
+		}
+		e.writeVarint(uint64(size))
+		e.buf = append(e.buf, ttype2Compact[keyType]<<4|ttype2Compact[valueType])
+	default:
+		e.buf = append(e.buf, keyType, valueType)
+		e.writeI32(int32(size))
+	}
+}
+
+func (e *encoder) writeBool(v bool) {
+	switch {
+	case e.protocol == COMPACT && v:
+		e.buf = append(e.buf, COMPACT_BOOLEAN_TRUE)
+	case e.protocol == COMPACT:
+		e.buf = append(e.buf, COMPACT_BOOLEAN_FALSE)
+	case v:
+		e.buf = append(e.buf, 1)
+	default:
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) writeByte(v int8) {
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *encoder) writeI16(v int16) {
+	if e.protocol == COMPACT {
+		e.writeVarint(zigzag64(int64(v)))
+		return
+	}
+	e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v))
+}
+
+func (e *encoder) writeI32(v int32) {
+	if e.protocol == COMPACT {
+		e.writeVarint(zigzag64(int64(v)))
+		return
+	}
+	e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v))
+}
+
+func (e *encoder) writeI64(v int64) {
+	if e.protocol == COMPACT {
+		e.writeVarint(zigzag64(v))
+		return
+	}
+	e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v))
+}
+
+func (e *encoder) writeDouble(v float64) {
+	if e.protocol == COMPACT { // compact protocol double is little endian
+		e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(v))
+		return
+	}
+	e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(v))
+}
+
+func (e *encoder) writeBinary(v []byte) {
+	if e.protocol == COMPACT {
+		e.writeVarint(uint64(len(v)))
+	} else {
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(len(v)))
+	}
+	e.buf = append(e.buf, v...)
+}
+
+/////////////////////////////////////////
+// decoder
+/////////////////////////////////////////
+
+type decoder struct {
+	protocol  Protocol
+	buf       []byte
+	lastField []int16
+	boolField int8 // compact bool field value in the field header, -1 means none
+}
+
+func newDecoder(p Protocol, buf []byte) *decoder {
+	return &decoder{protocol: p, buf: buf, lastField: []int16{0}, boolField: -1}
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.buf) < n {
+		return nil, ErrNotEnoughBuf
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+
+	return b, nil
+}
+
+func (d *decoder) readVarint() (uint64, error) {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		return 0, jerrors.Errorf("illegal varint")
+	}
+	d.buf = d.buf[n:]
+
+	return v, nil
+}
+
+func unzigzag64(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+// @name, message type, sequence id
+func (d *decoder) readMessageBegin() (string, byte, int32, error) {
+	var (
+		err  error
+		b    []byte
+		name []byte
+		typ  byte
+		seq  int32
+		v    uint64
+		ver  int32
+	)
+
+	if d.protocol == COMPACT {
+		if b, err = d.next(2); err != nil {
+			return "", 0, 0, err
+		}
+		if b[0] != COMPACT_PROTOCOL_ID || b[1]&COMPACT_VERSION_MASK != COMPACT_VERSION {
+			return "", 0, 0, jerrors.Errorf("bad compact protocol id %#x or version %#x", b[0], b[1])
+		}
+		typ = b[1] >> COMPACT_TYPE_SHIFT
+		if v, err = d.readVarint(); err != nil {
+			return "", 0, 0, err
+		}
+		seq = int32(uint32(v))
+		if name, err = d.readBinary(); err != nil {
+			return "", 0, 0, err
+		}
+		return string(name), typ, seq, nil
+	}
+
+	if ver, err = d.readI32(); err != nil {
+		return "", 0, 0, err
+	}
+	if ver < 0 { // strict
+		if uint32(ver)&BINARY_VERSION_MASK != BINARY_VERSION_1 {
+			return "", 0, 0, jerrors.Errorf("bad binary protocol version %#x", uint32(ver))
+		}
+		typ = byte(ver)
+		if name, err = d.readBinary(); err != nil {
+			return "", 0, 0, err
+		}
+	} else { // old non-strict: name length, name, type
+		if name, err = d.next(int(ver)); err != nil {
+			return "", 0, 0, err
+		}
+		if b, err = d.next(1); err != nil {
+			return "", 0, 0, err
+		}
+		typ = b[0]
+	}
+	if seq, err = d.readI32(); err != nil {
+		return "", 0, 0, err
+	}
+
+	return string(name), typ, seq, nil
+}
+
+func (d *decoder) readStructBegin() {
+	d.lastField = append(d.lastField, 0)
+}
+
+func (d *decoder) readStructEnd() {
+	d.lastField = d.lastField[:len(d.lastField)-1]
+}
+
+// field type, field id. the type is STOP at the end of struct.
+func (d *decoder) readFieldBegin() (byte, int16, error) {
+	var (
+		err error
+		b   []byte
+		id  int16
+		v   uint64
+	)
+
+	if b, err = d.next(1); err != nil {
+		return 0, 0, err
+	}
+	if b[0] == STOP {
+		return STOP, 0, nil
+	}
+
+	if d.protocol != COMPACT {
+		if id, err = d.readI16(); err != nil {
+			return 0, 0, err
+		}
+		return b[0], id, nil
+	}
+
+	last := &d.lastField[len(d.lastField)-1]
+	ctype := b[0] & 0x0f
+	if delta := int16(b[0] >> 4); delta != 0 {
+		id = *last + delta
+	} else {
+		if v, err = d.readVarint(); err != nil {
+			return 0, 0, err
+		}
+		id = int16(unzigzag64(v))
+	}
+	*last = id
+
+	switch ctype {
+	case COMPACT_BOOLEAN_TRUE:
+		d.boolField = 1
+	case COMPACT_BOOLEAN_FALSE:
+		d.boolField = 0
+	}
+	typ, ok := compact2Ttype[ctype]
+	if !ok {
+		return 0, 0, jerrors.Errorf("illegal compact type %#x", ctype)
+	}
+
+	return typ, id, nil
+}
+
+// element type, size
+func (d *decoder) readListBegin() (byte, int, error) {
+	var (
+		err  error
+		b    []byte
+		size int
+		v    uint64
+		i32  int32
+	)
+
+	if b, err = d.next(1); err != nil {
+		return 0, 0, err
+	}
+
+	if d.protocol != COMPACT {
+		if i32, err = d.readI32(); err != nil {
+			return 0, 0, err
+		}
+		if i32 < 0 {
+			return 0, 0, jerrors.Errorf("illegal list size %d", i32)
+		}
+		return b[0], int(i32), nil
+	}
+
+	size = int(b[0] >> 4)
+	if size == 15 {
+		if v, err = d.readVarint(); err != nil {
+			return 0, 0, err
+		}
+		size = int(v)
+	}
+	typ, ok := compact2Ttype[b[0]&0x0f]
+	if !ok {
+		return 0, 0, jerrors.Errorf("illegal compact type %#x", b[0]&0x0f)
+	}
+	if size < 0 || len(d.buf) < size { // every element costs one byte at least
+		return 0, 0, jerrors.Errorf("illegal list size %d", size)
+	}
+
+	return typ, size, nil
+}
+
+// key type, value type, size
+func (d *decoder) readMapBegin() (byte, byte, int, error) {
+	var (
+		err error
+		b   []byte
+		v   uint64
+		i32 int32
+	)
+
+	if d.protocol != COMPACT {
+		if b, err = d.next(2); err != nil {
+			return 0, 0, 0, err
+		}
+		if i32, err = d.readI32(); err != nil {
+			return 0, 0, 0, err
+		}
+		if i32 < 0 {
+			return 0, 0, 0, jerrors.Errorf("illegal map size %d", i32)
+		}
+		return b[0], b[1], int(i32), nil
+	}
+
+	if v, err = d.readVarint(); err != nil {
+		return 0, 0, 0, err
+	}
+	if v == 0 {
+		return STOP, STOP, 0, nil
+	}
+	if len(d.buf) < int(v) {
+		return 0, 0, 0, jerrors.Errorf("illegal map size %d", v)
+	}
+	if b, err = d.next(1); err != nil {
+		return 0, 0, 0, err
+	}
+	kt, ok1 := compact2Ttype[b[0]>>4]
+	vt, ok2 := compact2Ttype[b[0]&0x0f]
+	if !ok1 || !ok2 {
+		return 0, 0, 0, jerrors.Errorf("illegal compact map type %#x", b[0])
+	}
+
+	return kt, vt, int(v), nil
+}
+
+func (d *decoder) readBool() (bool, error) {
+	if d.boolField >= 0 {
+		v := d.boolField == 1
+		d.boolField = -1
+		return v, nil
+	}
+
+	b, err := d.next(1)
+	if err != nil {
+		return false, err
+	}
+	if d.protocol == COMPACT {
+		return b[0] == COMPACT_BOOLEAN_TRUE, nil
+	}
+
+	return b[0] != 0, nil
+}
+
+func (d *decoder) readByte() (int8, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+
+	return int8(b[0]), nil
+}
+
+func (d *decoder) readI16() (int16, error) {
+	if d.protocol == COMPACT {
+		v, err := d.readVarint()
+		return int16(unzigzag64(v)), err
+	}
+
+	b, err := d.next(2)
+	if err != nil {
+		return 0, err
+	}
+	return int16(binary.BigEndian.Uint16(b)), nil
+}
+
+func (d *decoder) readI32() (int32, error) {
+	if d.protocol == COMPACT {
+		v, err := d.readVarint()
+		return int32(unzigzag64(v)), err
+	}
+
+	b, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.BigEndian.Uint32(b)), nil
+}
+
+func (d *decoder) readI64() (int64, error) {
+	if d.protocol == COMPACT {
+		v, err := d.readVarint()
+		return unzigzag64(v), err
+	}
+
+	b, err := d.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(b)), nil
+}
+
+func (d *decoder) readDouble() (float64, error) {
+	b, err := d.next(8)
+	if err != nil {
+		return 0, err
+	}
+	if d.protocol == COMPACT {
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	}
+
+	return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+}
+
+func (d *decoder) readBinary() ([]byte, error) {
+	var (
+		err error
+		l   int
+		v   uint64
+		i32 int32
+	)
+
+	if d.protocol == COMPACT {
+		if v, err = d.readVarint(); err != nil {
+			return nil, err
+		}
+		l = int(v)
+	} else {
+		if i32, err = d.readI32(); err != nil {
+			return nil, err
+		}
+		l = int(i32)
+	}
+
+	return d.next(l)
+}
+
+// skip a value of type @typ
+func (d *decoder) skip(typ byte) error {
+	var err error
+
+	switch typ {
+	case BOOL:
+		_, err = d.readBool()
+	case BYTE:
+		_, err = d.readByte()
+	case I16:
+		_, err = d.readI16()
+	case I32:
+		_, err = d.readI32()
+	case I64:
+		_, err = d.readI64()
+	case DOUBLE:
+		_, err = d.readDouble()
+	case STRING:
+		_, err = d.readBinary()
+	case STRUCT:
+		d.readStructBegin()
+		for {
+			ft, _, err := d.readFieldBegin()
+			if err != nil {
+				return err
+			}
+			if ft == STOP {
+				break
+			}
+			if err = d.skip(ft); err != nil {
+				return err
+			}
+		}
+		d.readStructEnd()
+	case LIST, SET:
+		et, size, err := d.readListBegin()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < size; i++ {
+			if err = d.skip(et); err != nil {
+				return err
+			}
+		}
+	case MAP:
+		kt, vt, size, err := d.readMapBegin()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < size; i++ {
+			if err = d.skip(kt); err != nil {
+				return err
+			}
+			if err = d.skip(vt); err != nil {
+				return err
+			}
+		}
+	default:
+		err = jerrors.Errorf("can not skip thrift type %d", typ)
+	}
+
+	return err
+}
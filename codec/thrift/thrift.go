@@ -0,0 +1,464 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// thrift framed transport codec.
+// A request is a thrift CALL message whose name is codec.Message.Method and whose
+// sequence id is codec.Message.ID. Its args struct carries the args list as
+// field 1, 2, ... A reply is a thrift REPLY message whose result struct carries
+// the response as field 0, and a service error is replied as a TApplicationException.
+
+package thrift
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/codec"
+)
+
+const (
+	FRAME_HEADER_LENGTH = 4
+	DEFAULT_MAX_FRAME   = 16384000
+
+	// multiplexed protocol message name is "service:method"
+	MULTIPLEXED_SEPARATOR = ":"
+
+	// the dubbo attachments of a request are the map<string, string> field of its args
+	// struct, which is skipped by the plain thrift servers
+	ATTACHMENTS_FIELD_ID = int16(32767)
+)
+
+// TApplicationException type
+const (
+	UNKNOWN_EXCEPTION  = int32(0)
+	UNKNOWN_METHOD     = int32(1)
+	INTERNAL_ERROR     = int32(6)
+	PROTOCOL_ERROR     = int32(7)
+	UNSUPPORTED_CLIENT = int32(10)
+)
+
+type ApplicationException struct {
+	Message string `thrift:"message,1"`
+	Type    int32  `thrift:"type,2"`
+}
+
+func (e ApplicationException) Error() string {
+	return e.Message
+}
+
+type Options struct {
+	Protocol    Protocol
+	Multiplexed bool
+}
+
+type Option func(*Options)
+
+// WithProtocol sets the protocol of client request. Server always replies with the protocol of request.
+func WithProtocol(p Protocol) Option {
+	return func(o *Options) {
+		o.Protocol = p
+	}
+}
+
+// Multiplexed makes client send "service:method" as message name,
+// which is needed by a TMultiplexedProcessor server.
+func Multiplexed() Option {
+	return func(o *Options) {
+		o.Multiplexed = true
+	}
+}
+
+type thriftCodec struct {
+	opts Options
+	mt   codec.MessageType
+	rwc  io.ReadWriteCloser
+	buf  []byte // received bytes which have not been decoded
+
+	// current message
+	protocol Protocol
+	name     string
+	msgType  byte
+	dec      *decoder
+}
+
+func (c *thriftCodec) Close() error {
+	return c.rwc.Close()
+}
+
+func (c *thriftCodec) String() string {
+	return "thrift-" + c.opts.Protocol.String() + "-codec"
+}
+
+func (c *thriftCodec) Write(m *codec.Message, a interface{}) error {
+	var (
+		err error
+		e   *encoder
+	)
+
+	switch m.Type {
+	case codec.Request:
+		name := m.Method
+		if c.opts.Multiplexed {
+			name = m.Target + MULTIPLEXED_SEPARATOR + m.Method
+		}
+		e = newEncoder(c.opts.Protocol)
+		e.writeMessageBegin(name, CALL, int32(m.ID))
+		if err = e.encodeArgs(a, m); err != nil {
+			return jerrors.Annotatef(err, "encode args of %s", name)
+		}
+
+	case codec.Response:
+		if c.msgType == ONEWAY { // nobody waits for the reply
+			return nil
+		}
+		e = newEncoder(c.protocol)
+		if len(m.Error) != 0 {
+			typ := INTERNAL_ERROR
+			if strings.HasPrefix(m.Error, "rpc: can't find") {
+				typ = UNKNOWN_METHOD
+			}
+			e.writeMessageBegin(c.name, EXCEPTION, int32(m.ID))
+			err = e.encodeStruct(reflect.ValueOf(ApplicationException{Message: m.Error, Type: typ}))
+		} else {
+			e.writeMessageBegin(c.name, REPLY, int32(m.ID))
+			err = e.encodeResult(a)
+		}
+		if err != nil {
+			return jerrors.Annotatef(err, "encode result of %s", c.name)
+		}
+
+	default:
+		return jerrors.Errorf("Unrecognised message type: %v", m.Type)
+	}
+
+	b := e.Buffer()
+	if len(b) > DEFAULT_MAX_FRAME {
+		return jerrors.Errorf("Data length %d too large, max payload %d", len(b), DEFAULT_MAX_FRAME)
+	}
+	var frame [FRAME_HEADER_LENGTH]byte
+	binary.BigEndian.PutUint32(frame[:], uint32(len(b)))
+	if _, err = c.rwc.Write(frame[:]); err != nil {
+		return jerrors.Trace(err)
+	}
+	_, err = c.rwc.Write(b)
+	return jerrors.Trace(err)
+}
+
+// the args list @a is encoded as field 1, 2, ... of the args struct.
+// a non-list @a is the only arg. the attachments of @m are encoded as ATTACHMENTS_FIELD_ID
+// after the args, whose bytes are digested.
+func (e *encoder) encodeArgs(a interface{}, m *codec.Message) error {
+	var args []interface{}
+
+	switch arg := a.(type) {
+	case nil:
+	case []interface{}:
+		args = arg
+	default:
+		args = []interface{}{a}
+	}
+
+	e.writeStructBegin()
+	start := len(e.buf)
+	for i := range args {
+		if err := e.encodeField(int16(i+1), reflect.ValueOf(&args[i]).Elem()); err != nil {
+			return jerrors.Trace(err)
+		}
+	}
+	m.DigestArgs(e.buf[start:])
+	if len(m.Header) != 0 {
+		if err := e.encodeField(ATTACHMENTS_FIELD_ID, reflect.ValueOf(m.Header)); err != nil {
+			return jerrors.Annotate(err, "encode attachments")
+		}
+	}
+	e.writeStructEnd()
+
+	return nil
+}
+
+// @a is encoded as field 0 of the result struct. nil @a means void.
+func (e *encoder) encodeResult(a interface{}) error {
+	e.writeStructBegin()
+	if a != nil {
+		if err := e.encodeField(0, reflect.ValueOf(&a).Elem()); err != nil {
+			return jerrors.Trace(err)
+		}
+	}
+	e.writeStructEnd()
+
+	return nil
+}
+
+// read all the received bytes from @c.rwc
+func (c *thriftCodec) fill() error {
+	b, err := ioutil.ReadAll(c.rwc)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+	c.buf = append(c.buf, b...)
+
+	return nil
+}
+
+// take the next whole frame from @c.buf
+func (c *thriftCodec) takeFrame() ([]byte, error) {
+	if len(c.buf) < FRAME_HEADER_LENGTH {
+		return nil, codec.ErrHeaderNotEnough
+	}
+	l := binary.BigEndian.Uint32(c.buf)
+	if l == 0 || l > DEFAULT_MAX_FRAME {
+		return nil, jerrors.Errorf("illegal frame size %d", l)
+	}
+	if len(c.buf) < FRAME_HEADER_LENGTH+int(l) {
+		return nil, codec.ErrHeaderNotEnough
+	}
+	frame := c.buf[FRAME_HEADER_LENGTH : FRAME_HEADER_LENGTH+int(l)]
+	c.buf = c.buf[FRAME_HEADER_LENGTH+int(l):]
+
+	return frame, nil
+}
+
+func (c *thriftCodec) ReadHeader(m *codec.Message, mt codec.MessageType) error {
+	var (
+		err   error
+		frame []byte
+		seq   int32
+	)
+
+	c.mt = mt
+	if err = c.fill(); err != nil {
+		return jerrors.Trace(err)
+	}
+	if frame, err = c.takeFrame(); err != nil {
+		return err // codec.ErrHeaderNotEnough should not be traced
+	}
+
+	c.protocol = BINARY
+	if frame[0] == COMPACT_PROTOCOL_ID {
+		c.protocol = COMPACT
+	}
+	c.dec = newDecoder(c.protocol, frame)
+	if c.name, c.msgType, seq, err = c.dec.readMessageBegin(); err != nil {
+		return jerrors.Annotate(err, "decode message header")
+	}
+	m.ID = int64(seq)
+
+	switch mt {
+	case codec.Request:
+		if c.msgType != CALL && c.msgType != ONEWAY {
+			return jerrors.Errorf("thrift message %s{type:%d} is not a request", c.name, c.msgType)
+		}
+		m.Type = codec.Request
+		m.Method = c.name
+		if i := strings.Index(c.name, MULTIPLEXED_SEPARATOR); i != -1 {
+			m.Target, m.Method = c.name[:i], c.name[i+1:]
+			m.ServicePath = m.Target
+			c.name = m.Method
+		}
+		return jerrors.Trace(c.readAttachments(m))
+
+	case codec.Response:
+		m.Type = codec.Response
+		m.Method = c.name
+		switch c.msgType {
+		case REPLY:
+			return nil
+		case EXCEPTION:
+			var ex ApplicationException
+			if err = c.dec.decodeStruct(reflect.ValueOf(&ex).Elem()); err != nil {
+				return jerrors.Annotate(err, "decode TApplicationException")
+			}
+			m.Error = ex.Message
+			if len(m.Error) == 0 {
+				m.Error = fmt.Sprintf("thrift application exception type %d", ex.Type)
+			}
+			return nil
+		default:
+			return jerrors.Errorf("thrift message %s{type:%d} is not a response", c.name, c.msgType)
+		}
+
+	default:
+		return jerrors.Errorf("Unrecognised message type: %v", mt)
+	}
+}
+
+func (c *thriftCodec) ReadBody(ret interface{}) error {
+	switch c.mt {
+	case codec.Request:
+		return jerrors.Trace(c.readArgs(ret))
+	case codec.Response:
+		return jerrors.Trace(c.readResult(ret))
+	default:
+		return jerrors.Errorf("Unrecognised message type: %v", c.mt)
+	}
+}
+
+// decode the attachments field of the args struct into @m.Header, and digest the bytes
+// of the args before it, which leaves the args to ReadBody.
+func (c *thriftCodec) readAttachments(m *codec.Message) error {
+	d := *c.dec
+	d.lastField = append([]int16(nil), c.dec.lastField...)
+
+	d.readStructBegin()
+	args := d.buf
+	for {
+		field := d.buf
+		typ, id, err := d.readFieldBegin()
+		if err != nil {
+			return jerrors.Annotate(err, "decode args")
+		}
+		if typ == STOP || id == ATTACHMENTS_FIELD_ID {
+			m.ArgsDigest = codec.Digest(args[:len(args)-len(field)])
+		}
+		if typ == STOP {
+			return nil
+		}
+		if id != ATTACHMENTS_FIELD_ID || typ != MAP {
+			if err = d.skip(typ); err != nil {
+				return jerrors.Annotatef(err, "decode arg %d", id)
+			}
+			continue
+		}
+
+		var attachments map[string]string
+		if err = d.decodeValue(typ, reflect.ValueOf(&attachments).Elem()); err != nil {
+			return jerrors.Annotate(err, "decode attachments")
+		}
+		if m.Header == nil {
+			m.Header = make(map[string]string, len(attachments))
+		}
+		for k, v := range attachments {
+			m.Header[k] = v
+		}
+		return nil
+	}
+}
+
+// decode the field 1 of the args struct into @ret. the other args are dropped.
+func (c *thriftCodec) readArgs(ret interface{}) error {
+	if ret == nil {
+		return nil
+	}
+
+	v := reflect.ValueOf(ret)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return jerrors.Errorf("@ret{%T} is not a pointer", ret)
+	}
+
+	c.dec.readStructBegin()
+	for {
+		typ, id, err := c.dec.readFieldBegin()
+		if err != nil {
+			return jerrors.Annotate(err, "decode args")
+		}
+		if typ == STOP {
+			break
+		}
+		if id == 1 {
+			err = c.dec.decodeValue(typ, v.Elem())
+		} else {
+			err = c.dec.skip(typ)
+		}
+		if err != nil {
+			return jerrors.Annotatef(err, "decode arg %d", id)
+		}
+	}
+	c.dec.readStructEnd()
+
+	return nil
+}
+
+// decode field 0 of the result struct into @ret. other fields are the exceptions
+// declared by the idl, which are returned as error.
+func (c *thriftCodec) readResult(ret interface{}) error {
+	if c.msgType == EXCEPTION { // decoded in ReadHeader
+		return nil
+	}
+
+	var v reflect.Value
+	if ret != nil {
+		v = reflect.ValueOf(ret)
+		if v.Kind() != reflect.Ptr || v.IsNil() {
+			return jerrors.Errorf("@ret{%T} is not a pointer", ret)
+		}
+	}
+
+	c.dec.readStructBegin()
+	for {
+		typ, id, err := c.dec.readFieldBegin()
+		if err != nil {
+			return jerrors.Annotate(err, "decode result")
+		}
+		if typ == STOP {
+			break
+		}
+		if id != 0 {
+			ex, err := c.dec.decodeInterface(typ)
+			if err != nil {
+				return jerrors.Annotatef(err, "decode exception %d", id)
+			}
+			return jerrors.Errorf("thrift exception{field:%d}: %+v", id, ex)
+		}
+		if ret == nil {
+			err = c.dec.skip(typ)
+		} else {
+			err = c.dec.decodeValue(typ, v.Elem())
+		}
+		if err != nil {
+			return jerrors.Annotate(err, "decode success")
+		}
+	}
+	c.dec.readStructEnd()
+
+	return nil
+}
+
+// NewCodec returns a thrift binary protocol codec.
+func NewCodec(rwc io.ReadWriteCloser) codec.Codec {
+	return &thriftCodec{
+		rwc: rwc,
+	}
+}
+
+// NewCompactCodec returns a thrift compact protocol codec.
+func NewCompactCodec(rwc io.ReadWriteCloser) codec.Codec {
+	return &thriftCodec{
+		opts: Options{Protocol: COMPACT},
+		rwc:  rwc,
+	}
+}
+
+func NewCodecWithOptions(opts ...Option) codec.NewCodec {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return func(rwc io.ReadWriteCloser) codec.Codec {
+		return &thriftCodec{
+			opts: options,
+			rwc:  rwc,
+		}
+	}
+}
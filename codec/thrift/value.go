@@ -0,0 +1,583 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// go value <-> thrift value.
+// The field id of a struct field is taken from its tag in the style of the
+// apache thrift go generator, such as `thrift:"name,1,required"`. A field
+// without tag gets its index + 1 as its id.
+
+package thrift
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+type field struct {
+	id    int16
+	index int
+}
+
+var (
+	bytesType = reflect.TypeOf([]byte(nil))
+	fieldsMap sync.Map // reflect.Type -> []field
+)
+
+func structFields(t reflect.Type) []field {
+	if v, ok := fieldsMap.Load(t); ok {
+		return v.([]field)
+	}
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		id := int16(i + 1)
+		if tag, ok := f.Tag.Lookup("thrift"); ok {
+			if tag == "-" {
+				continue
+			}
+			for _, s := range strings.Split(tag, ",") {
+				if n, err := strconv.ParseInt(s, 10, 16); err == nil {
+					id = int16(n)
+					break
+				}
+			}
+		}
+		fields = append(fields, field{id: id, index: i})
+	}
+	fieldsMap.Store(t, fields)
+
+	return fields
+}
+
+func ttypeOf(t reflect.Type) (byte, error) {
+	if t == bytesType {
+		return STRING, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return BOOL, nil
+	case reflect.Int8, reflect.Uint8:
+		return BYTE, nil
+	case reflect.Int16, reflect.Uint16:
+		return I16, nil
+	case reflect.Int32, reflect.Uint32:
+		return I32, nil
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return I64, nil
+	case reflect.Float32, reflect.Float64:
+		return DOUBLE, nil
+	case reflect.String:
+		return STRING, nil
+	case reflect.Struct:
+		return STRUCT, nil
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.Struct && t.Elem().NumField() == 0 { // map[T]struct{} is a set
+			return SET, nil
+		}
+		return MAP, nil
+	case reflect.Slice, reflect.Array:
+		return LIST, nil
+	case reflect.Ptr:
+		return ttypeOf(t.Elem())
+	}
+
+	return 0, jerrors.Errorf("can not encode %s into thrift", t)
+}
+
+// the thrift type of the dynamic value @v
+func ttypeOfValue(v reflect.Value) (byte, error) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return 0, jerrors.Errorf("can not encode nil %s into thrift", v.Type())
+		}
+		v = v.Elem()
+	}
+
+	return ttypeOf(v.Type())
+}
+
+/////////////////////////////////////////
+// encode
+/////////////////////////////////////////
+
+func (e *encoder) encodeValue(v reflect.Value) error {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return jerrors.Errorf("can not encode nil %s into thrift", v.Type())
+		}
+		v = v.Elem()
+	}
+
+	if v.Type() == bytesType {
+		e.writeBinary(v.Bytes())
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		e.writeBool(v.Bool())
+	case reflect.Int8:
+		e.writeByte(int8(v.Int()))
+	case reflect.Uint8:
+		e.writeByte(int8(v.Uint()))
+	case reflect.Int16:
+		e.writeI16(int16(v.Int()))
+	case reflect.Uint16:
+		e.writeI16(int16(v.Uint()))
+	case reflect.Int32:
+		e.writeI32(int32(v.Int()))
+	case reflect.Uint32:
+		e.writeI32(int32(v.Uint()))
+	case reflect.Int, reflect.Int64:
+		e.writeI64(v.Int())
+	case reflect.Uint, reflect.Uint64:
+		e.writeI64(int64(v.Uint()))
+	case reflect.Float32, reflect.Float64:
+		e.writeDouble(v.Float())
+	case reflect.String:
+		e.writeBinary([]byte(v.String()))
+	case reflect.Struct:
+		return jerrors.Trace(e.encodeStruct(v))
+	case reflect.Map:
+		return jerrors.Trace(e.encodeMap(v))
+	case reflect.Slice, reflect.Array:
+		return jerrors.Trace(e.encodeList(v))
+	default:
+		return jerrors.Errorf("can not encode %s into thrift", v.Type())
+	}
+
+	return nil
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+// encode the field @v with id @id. nil pointer, map, slice and interface are optional fields.
+func (e *encoder) encodeField(id int16, v reflect.Value) error {
+	if isEmpty(v) {
+		return nil
+	}
+
+	typ, err := ttypeOfValue(v)
+	if err != nil {
+		return jerrors.Annotatef(err, "field %d", id)
+	}
+	if typ == BOOL {
+		for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		e.writeBoolField(id, v.Bool())
+		return nil
+	}
+
+	e.writeFieldBegin(typ, id)
+	return jerrors.Annotatef(e.encodeValue(v), "field %d", id)
+}
+
+func (e *encoder) encodeStruct(v reflect.Value) error {
+	e.writeStructBegin()
+	for _, f := range structFields(v.Type()) {
+		if err := e.encodeField(f.id, v.Field(f.index)); err != nil {
+			return jerrors.Annotatef(err, "%s", v.Type())
+		}
+	}
+	e.writeStructEnd()
+
+	return nil
+}
+
+// the element type of an empty interface container is decided by its first element
+func (e *encoder) elemType(t reflect.Type, first func() reflect.Value) (byte, error) {
+	if t.Kind() != reflect.Interface {
+		return ttypeOf(t)
+	}
+
+	v := first()
+	if !v.IsValid() {
+		return STRUCT, nil
+	}
+	return ttypeOfValue(v)
+}
+
+func (e *encoder) encodeList(v reflect.Value) error {
+	typ, err := e.elemType(v.Type().Elem(), func() reflect.Value {
+		if v.Len() == 0 {
+			return reflect.Value{}
+		}
+		return v.Index(0)
+	})
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+
+	e.writeListBegin(typ, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if err = e.encodeValue(v.Index(i)); err != nil {
+			return jerrors.Annotatef(err, "list element %d", i)
+		}
+	}
+
+	return nil
+}
+
+func (e *encoder) encodeMap(v reflect.Value) error {
+	var (
+		err  error
+		kt   byte
+		vt   byte
+		keys = v.MapKeys()
+	)
+
+	first := func(f func(k reflect.Value) reflect.Value) func() reflect.Value {
+		return func() reflect.Value {
+			if len(keys) == 0 {
+				return reflect.Value{}
+			}
+			return f(keys[0])
+		}
+	}
+	if kt, err = e.elemType(v.Type().Key(), first(func(k reflect.Value) reflect.Value { return k })); err != nil {
+		return jerrors.Trace(err)
+	}
+
+	et := v.Type().Elem()
+	if et.Kind() == reflect.Struct && et.NumField() == 0 { // set
+		e.writeListBegin(kt, len(keys))
+		for _, k := range keys {
+			if err = e.encodeValue(k); err != nil {
+				return jerrors.Annotate(err, "set element")
+			}
+		}
+		return nil
+	}
+
+	if vt, err = e.elemType(et, first(v.MapIndex)); err != nil {
+		return jerrors.Trace(err)
+	}
+	e.writeMapBegin(kt, vt, len(keys))
+	for _, k := range keys {
+		if err = e.encodeValue(k); err != nil {
+			return jerrors.Annotate(err, "map key")
+		}
+		if err = e.encodeValue(v.MapIndex(k)); err != nil {
+			return jerrors.Annotatef(err, "map value of key %v", k)
+		}
+	}
+
+	return nil
+}
+
+/////////////////////////////////////////
+// decode
+/////////////////////////////////////////
+
+// decode a value of thrift type @typ into @v, which should be settable.
+// integer and float values can be widened or narrowed into any numeric kind.
+func (d *decoder) decodeValue(typ byte, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decodeValue(typ, v.Elem())
+	}
+
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		i, err := d.decodeInterface(typ)
+		if err != nil {
+			return jerrors.Trace(err)
+		}
+		if i != nil {
+			v.Set(reflect.ValueOf(i))
+		}
+		return nil
+	}
+
+	switch typ {
+	case BOOL:
+		b, err := d.readBool()
+		if err != nil {
+			return jerrors.Trace(err)
+		}
+		if v.Kind() != reflect.Bool {
+			return errIncompatible(typ, v)
+		}
+		v.SetBool(b)
+
+	case BYTE, I16, I32, I64:
+		var (
+			err error
+			i   int64
+			i8  int8
+			i16 int16
+			i32 int32
+		)
+		switch typ {
+		case BYTE:
+			i8, err = d.readByte()
+			i = int64(i8)
+		case I16:
+			i16, err = d.readI16()
+			i = int64(i16)
+		case I32:
+			i32, err = d.readI32()
+			i = int64(i32)
+		default:
+			i, err = d.readI64()
+		}
+		if err != nil {
+			return jerrors.Trace(err)
+		}
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			v.SetInt(i)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			v.SetUint(uint64(i))
+		case reflect.Float32, reflect.Float64:
+			v.SetFloat(float64(i))
+		default:
+			return errIncompatible(typ, v)
+		}
+
+	case DOUBLE:
+		f, err := d.readDouble()
+		if err != nil {
+			return jerrors.Trace(err)
+		}
+		if v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+			return errIncompatible(typ, v)
+		}
+		v.SetFloat(f)
+
+	case STRING:
+		b, err := d.readBinary()
+		if err != nil {
+			return jerrors.Trace(err)
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(b))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(append([]byte(nil), b...))
+		default:
+			return errIncompatible(typ, v)
+		}
+
+	case STRUCT:
+		if v.Kind() != reflect.Struct {
+			return errIncompatible(typ, v)
+		}
+		return jerrors.Trace(d.decodeStruct(v))
+
+	case LIST, SET:
+		return jerrors.Trace(d.decodeList(v))
+
+	case MAP:
+		return jerrors.Trace(d.decodeMap(v))
+
+	default:
+		return jerrors.Errorf("illegal thrift type %d", typ)
+	}
+
+	return nil
+}
+
+func errIncompatible(typ byte, v reflect.Value) error {
+	return jerrors.Errorf("can not decode thrift type %d into %s", typ, v.Type())
+}
+
+func (d *decoder) decodeStruct(v reflect.Value) error {
+	var (
+		ok     bool
+		fields = make(map[int16]int)
+	)
+
+	for _, f := range structFields(v.Type()) {
+		fields[f.id] = f.index
+	}
+
+	d.readStructBegin()
+	for {
+		typ, id, err := d.readFieldBegin()
+		if err != nil {
+			return jerrors.Trace(err)
+		}
+		if typ == STOP {
+			break
+		}
+
+		var index int
+		if index, ok = fields[id]; !ok {
+			if err = d.skip(typ); err != nil {
+				return jerrors.Trace(err)
+			}
+			continue
+		}
+		if err = d.decodeValue(typ, v.Field(index)); err != nil {
+			return jerrors.Annotatef(err, "%s field %d", v.Type(), id)
+		}
+	}
+	d.readStructEnd()
+
+	return nil
+}
+
+func (d *decoder) decodeList(v reflect.Value) error {
+	typ, size, err := d.readListBegin()
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		s := reflect.MakeSlice(v.Type(), size, size)
+		for i := 0; i < size; i++ {
+			if err = d.decodeValue(typ, s.Index(i)); err != nil {
+				return jerrors.Annotatef(err, "list element %d", i)
+			}
+		}
+		v.Set(s)
+
+	case reflect.Array:
+		for i := 0; i < size; i++ {
+			if i >= v.Len() {
+				if err = d.skip(typ); err != nil {
+					return jerrors.Trace(err)
+				}
+				continue
+			}
+			if err = d.decodeValue(typ, v.Index(i)); err != nil {
+				return jerrors.Annotatef(err, "list element %d", i)
+			}
+		}
+
+	case reflect.Map: // set
+		m := reflect.MakeMapWithSize(v.Type(), size)
+		for i := 0; i < size; i++ {
+			k := reflect.New(v.Type().Key()).Elem()
+			if err = d.decodeValue(typ, k); err != nil {
+				return jerrors.Annotatef(err, "set element %d", i)
+			}
+			m.SetMapIndex(k, reflect.Zero(v.Type().Elem()))
+		}
+		v.Set(m)
+
+	default:
+		return errIncompatible(LIST, v)
+	}
+
+	return nil
+}
+
+func (d *decoder) decodeMap(v reflect.Value) error {
+	kt, vt, size, err := d.readMapBegin()
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+	if v.Kind() != reflect.Map {
+		return errIncompatible(MAP, v)
+	}
+
+	m := reflect.MakeMapWithSize(v.Type(), size)
+	for i := 0; i < size; i++ {
+		key := reflect.New(v.Type().Key()).Elem()
+		if err = d.decodeValue(kt, key); err != nil {
+			return jerrors.Annotate(err, "map key")
+		}
+		if key.Kind() == reflect.Interface && !key.IsNil() && !key.Elem().Type().Comparable() {
+			return jerrors.Errorf("map key %s is not comparable", key.Elem().Type())
+		}
+		value := reflect.New(v.Type().Elem()).Elem()
+		if err = d.decodeValue(vt, value); err != nil {
+			return jerrors.Annotatef(err, "map value of key %v", key)
+		}
+		m.SetMapIndex(key, value)
+	}
+	v.Set(m)
+
+	return nil
+}
+
+// decode a value without go type information. a struct is decoded into map[int16]interface{}
+// whose key is the field id, a list or set into []interface{} and a map into
+// map[interface{}]interface{}.
+func (d *decoder) decodeInterface(typ byte) (interface{}, error) {
+	switch typ {
+	case BOOL:
+		return d.readBool()
+	case BYTE:
+		return d.readByte()
+	case I16:
+		return d.readI16()
+	case I32:
+		return d.readI32()
+	case I64:
+		return d.readI64()
+	case DOUBLE:
+		return d.readDouble()
+	case STRING:
+		b, err := d.readBinary()
+		return string(b), err
+
+	case STRUCT:
+		s := make(map[int16]interface{})
+		d.readStructBegin()
+		for {
+			ft, id, err := d.readFieldBegin()
+			if err != nil {
+				return nil, jerrors.Trace(err)
+			}
+			if ft == STOP {
+				break
+			}
+			if s[id], err = d.decodeInterface(ft); err != nil {
+				return nil, jerrors.Annotatef(err, "field %d", id)
+			}
+		}
+		d.readStructEnd()
+		return s, nil
+
+	case LIST, SET:
+		var l []interface{}
+		if err := d.decodeList(reflect.ValueOf(&l).Elem()); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		return l, nil
+
+	case MAP:
+		var m map[interface{}]interface{}
+		if err := d.decodeMap(reflect.ValueOf(&m).Elem()); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		return m, nil
+	}
+
+	return nil, jerrors.Errorf("illegal thrift type %d", typ)
+}
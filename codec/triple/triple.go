@@ -0,0 +1,288 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// triple codec, which is grpc over http/2 with protobuf messages.
+// ref: https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md
+// The request path is "/{service}/{method}". The status of response is carried
+// by the "grpc-status" & "grpc-message" headers, which are sent as trailers by
+// transport.NewHTTP2Transport.
+
+package triple
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/codec"
+)
+
+const (
+	CONTENT_TYPE       = "application/grpc+proto"
+	GRPC_CONTENT_TYPE  = "application/grpc"
+	MESSAGE_HEADER_LEN = 5
+	MAX_MESSAGE_SIZE   = 16 * 1024 * 1024
+
+	PATH_HEADER            = "Path"
+	TIMEOUT_HEADER         = "Grpc-Timeout"
+	STATUS_HEADER          = "Grpc-Status"
+	MESSAGE_HEADER         = "Grpc-Message"
+	SERVICE_VERSION_HEADER = "Tri-Service-Version"
+	SERVICE_GROUP_HEADER   = "Tri-Service-Group"
+
+	// the last response of a stream sent by server
+	streamEnd = "EOS"
+)
+
+// grpc status code
+const (
+	OK            = 0
+	UNKNOWN       = 2
+	UNIMPLEMENTED = 12
+	INTERNAL      = 13
+)
+
+type tripleCodec struct {
+	mt  codec.MessageType
+	rwc io.ReadWriteCloser
+	buf []byte
+
+	// current request
+	service string
+	method  string
+}
+
+func (c *tripleCodec) Close() error {
+	return c.rwc.Close()
+}
+
+func (c *tripleCodec) String() string {
+	return "triple-codec"
+}
+
+func appendMessage(b []byte, a interface{}) ([]byte, error) {
+	msg, ok := a.(proto.Message)
+	if !ok {
+		return nil, jerrors.Errorf("@a{%T} is not a proto.Message", a)
+	}
+	buf, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, jerrors.Trace(err)
+	}
+	if len(buf) > MAX_MESSAGE_SIZE {
+		return nil, jerrors.Errorf("message size %d is larger than %d", len(buf), MAX_MESSAGE_SIZE)
+	}
+
+	var header [MESSAGE_HEADER_LEN]byte // not compressed
+	binary.BigEndian.PutUint32(header[1:], uint32(len(buf)))
+	b = append(b, header[:]...)
+
+	return append(b, buf...), nil
+}
+
+// grpc-timeout allows 8 digits at most
+func encodeTimeout(t time.Duration) string {
+	if ms := t / time.Millisecond; ms < 1e8 {
+		return strconv.FormatInt(int64(ms), 10) + "m"
+	}
+
+	return strconv.FormatInt(int64(t/time.Second), 10) + "S"
+}
+
+func (c *tripleCodec) Write(m *codec.Message, a interface{}) error {
+	var (
+		err error
+		b   []byte
+	)
+
+	if m.Header == nil {
+		m.Header = make(map[string]string)
+	}
+
+	switch m.Type {
+	case codec.Request:
+		if args, ok := a.([]interface{}); ok { // grpc method has only one arg
+			if len(args) != 1 {
+				return jerrors.Errorf("grpc request should have one arg, but got %d", len(args))
+			}
+			a = args[0]
+		}
+		if b, err = appendMessage(b, a); err != nil {
+			return jerrors.Annotate(err, "encode request")
+		}
+		m.DigestArgs(b[MESSAGE_HEADER_LEN:])
+		m.Header[PATH_HEADER] = "/" + m.Target + "/" + m.Method
+		m.Header["Content-Type"] = CONTENT_TYPE
+		m.Header["Te"] = "trailers"
+		if m.Timeout > 0 {
+			m.Header[TIMEOUT_HEADER] = encodeTimeout(m.Timeout)
+		}
+		if len(m.Version) != 0 {
+			m.Header[SERVICE_VERSION_HEADER] = m.Version
+		}
+
+	case codec.Response:
+		switch {
+		case m.Error == streamEnd:
+			m.Header[STATUS_HEADER] = strconv.Itoa(OK)
+		case len(m.Error) != 0:
+			status := UNKNOWN
+			if strings.HasPrefix(m.Error, "rpc: can't find") {
+				status = UNIMPLEMENTED
+			}
+			m.Header[STATUS_HEADER] = strconv.Itoa(status)
+			m.Header[MESSAGE_HEADER] = url.PathEscape(m.Error)
+		default:
+			if b, err = appendMessage(b, a); err != nil {
+				return jerrors.Annotate(err, "encode response")
+			}
+			m.Header[STATUS_HEADER] = strconv.Itoa(OK)
+		}
+
+	default:
+		return jerrors.Errorf("Unrecognised message type: %v", m.Type)
+	}
+
+	_, err = c.rwc.Write(b)
+	return jerrors.Trace(err)
+}
+
+func (c *tripleCodec) ReadHeader(m *codec.Message, mt codec.MessageType) error {
+	c.mt = mt
+
+	switch mt {
+	case codec.Request:
+		// the following messages of a stream have no headers
+		if path, ok := m.Header[PATH_HEADER]; ok {
+			i := strings.LastIndex(path, "/")
+			if i == -1 {
+				return jerrors.Errorf("illegal grpc path %q", path)
+			}
+			c.service, c.method = strings.TrimPrefix(path[:i], "/"), path[i+1:]
+		}
+		m.Type = codec.Request
+		m.Target = c.service
+		m.ServicePath = c.service
+		m.Method = c.method
+		m.Version = m.Header[SERVICE_VERSION_HEADER]
+		// the message is read in ReadBody, so a stream request keeps it for Streamer.Recv
+		if msg, _, err := c.peek(); err == nil && msg != nil {
+			m.ArgsDigest = codec.Digest(msg)
+		}
+		return nil
+
+	case codec.Response:
+		m.Type = codec.Response
+		status, ok := m.Header[STATUS_HEADER]
+		if !ok {
+			m.Error = "grpc-status is missing"
+			return nil
+		}
+		if code, err := strconv.Atoi(status); err != nil || code != OK {
+			msg, _ := url.PathUnescape(m.Header[MESSAGE_HEADER])
+			m.Error = fmt.Sprintf("grpc status:%s, message:%s", status, msg)
+		}
+		return nil
+
+	default:
+		return jerrors.Errorf("Unrecognised message type: %v", mt)
+	}
+}
+
+// return the next message in @c.buf and its length with the message header
+func (c *tripleCodec) peek() ([]byte, int, error) {
+	b, err := ioutil.ReadAll(c.rwc)
+	if err != nil {
+		return nil, 0, jerrors.Trace(err)
+	}
+	c.buf = append(c.buf, b...)
+
+	if len(c.buf) == 0 {
+		return nil, 0, nil
+	}
+	if len(c.buf) < MESSAGE_HEADER_LEN {
+		return nil, 0, codec.ErrBodyNotEnough
+	}
+	if c.buf[0] != 0 {
+		return nil, 0, jerrors.Errorf("compressed grpc message is not supported")
+	}
+	l := binary.BigEndian.Uint32(c.buf[1:])
+	if l > MAX_MESSAGE_SIZE {
+		return nil, 0, jerrors.Errorf("message size %d is larger than %d", l, MAX_MESSAGE_SIZE)
+	}
+	if len(c.buf) < MESSAGE_HEADER_LEN+int(l) {
+		return nil, 0, codec.ErrBodyNotEnough
+	}
+
+	return c.buf[MESSAGE_HEADER_LEN : MESSAGE_HEADER_LEN+int(l)], MESSAGE_HEADER_LEN + int(l), nil
+}
+
+// take the next message from @c.buf
+func (c *tripleCodec) next() ([]byte, error) {
+	msg, n, err := c.peek()
+	if err != nil || msg == nil {
+		return msg, err
+	}
+	c.buf = c.buf[n:]
+
+	return msg, nil
+}
+
+func (c *tripleCodec) ReadBody(ret interface{}) error {
+	if ret == nil {
+		// do not consume the request of a stream, which will be read by Streamer.Recv
+		return nil
+	}
+
+	msg, ok := ret.(proto.Message)
+	if !ok {
+		return jerrors.Errorf("@ret{%T} is not a proto.Message", ret)
+	}
+
+	b, err := c.next()
+	if err != nil {
+		return err // codec.ErrBodyNotEnough should not be traced
+	}
+	if b == nil {
+		if c.mt == codec.Request {
+			return io.EOF
+		}
+		return nil
+	}
+
+	return jerrors.Annotate(proto.Unmarshal(b, msg), "decode message")
+}
+
+// Buffered reports whether there are messages of the stream left in @c.buf
+func (c *tripleCodec) Buffered() bool {
+	return len(c.buf) != 0
+}
+
+func NewCodec(rwc io.ReadWriteCloser) codec.Codec {
+	return &tripleCodec{
+		rwc: rwc,
+	}
+}
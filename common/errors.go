@@ -16,10 +16,15 @@
 package common
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 )
 
+import (
+	jerrors "github.com/juju/errors"
+)
+
 // Errors provide a way to return detailed information
 // for an RPC request error. The error is normally
 // JSON encoded.
@@ -97,3 +102,26 @@ func InternalServerError(id, detail string) error {
 		Status: http.StatusText(500),
 	}
 }
+
+// IsServerError reports whether @err is a 5xx-equivalent error of a provider, which is
+// any error except the 4xx Error other than 408 timeout.
+func IsServerError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if e, ok := jerrors.Cause(err).(*Error); ok {
+		return e.Code < 400 || 500 <= e.Code || e.Code == http.StatusRequestTimeout
+	}
+	return true
+}
+
+// IsCanceled reports whether @err is the cancellation of the caller, which is returned
+// as a 408 Error of context.Canceled by the client, rather than a timeout.
+func IsCanceled(err error) bool {
+	cause := jerrors.Cause(err)
+	if cause == context.Canceled {
+		return true
+	}
+	e, ok := cause.(*Error)
+	return ok && e.Code == http.StatusRequestTimeout && e.Detail == context.Canceled.Error()
+}
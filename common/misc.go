@@ -18,6 +18,7 @@ package common
 import (
 	"fmt"
 	"math/rand"
+	"net/textproto"
 	"runtime"
 	"strconv"
 	"strings"
@@ -26,6 +27,15 @@ import (
 
 const (
 	DUBBOGO_CTX_KEY = "dubbogo-ctx"
+
+	// READONLY_EVENT is sent by the provider in graceful shutdown. It is the event data
+	// of dubbo protocol, or the DUBBO_EVENT_HEADER of http responses.
+	READONLY_EVENT     = "R"
+	DUBBO_EVENT_HEADER = "Dubbo-Event"
+
+	// attachments of the consumer
+	TOKEN_KEY       = "token"
+	APPLICATION_KEY = "application"
 )
 
 var (
@@ -74,3 +84,12 @@ func Goid() int {
 	}
 	return id
 }
+
+// Attachment returns the attachment @key in @header, which is the dubbo attachments
+// or the http headers whose keys are canonical.
+func Attachment(header map[string]string, key string) string {
+	if v, ok := header[key]; ok {
+		return v
+	}
+	return header[textproto.CanonicalMIMEHeaderKey(key)]
+}
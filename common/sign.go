@@ -0,0 +1,53 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+const (
+	// attachments of the signed requests
+	ACCESS_KEY_KEY = "access-key"
+	TIMESTAMP_KEY  = "timestamp" // unix time in milliseconds
+	NONCE_KEY      = "nonce"     // random string of a request, which can not be replayed
+	SIGNATURE_KEY  = "signature"
+
+	// SIGN_KEY is the provider url param of the services whose requests should be signed
+	SIGN_KEY = "sign"
+)
+
+// NewNonce returns a random nonce of a signed request
+func NewNonce() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// Sign returns the hex HMAC-SHA256 signature of a request by @secretKey. @digest is the
+// codec.Digest of its encoded args.
+func Sign(secretKey, accessKey, service, method, digest, timestamp, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	for _, s := range []string{accessKey, service, method, digest, timestamp, nonce} {
+		mac.Write([]byte(s))
+		mac.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
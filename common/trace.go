@@ -0,0 +1,68 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"net/http"
+	"strings"
+)
+
+import (
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	// TRACER_NAME is the instrumentation name of dubbogo spans
+	TRACER_NAME = "github.com/AlexStocks/dubbogo"
+)
+
+// TracePropagator carries the W3C trace context & baggage in the http headers
+// and the dubbo attachments, which is understood by the java dubbo services.
+var TracePropagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// TraceCarrier adapts the request header or the dubbo attachments to
+// propagation.TextMapCarrier. Its keys are case insensitive, because
+// the http transport canonicalizes "traceparent" into "Traceparent".
+type TraceCarrier map[string]string
+
+func (c TraceCarrier) Get(key string) string {
+	if v, ok := c[key]; ok {
+		return v
+	}
+	if v, ok := c[http.CanonicalHeaderKey(key)]; ok {
+		return v
+	}
+	for k, v := range c {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+func (c TraceCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c TraceCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,388 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// conversion between json values and hessian values.
+
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/codec/hessian"
+)
+
+// split "java.util.Map<K, V>" into "java.util.Map" & ["K", "V"]
+func splitGenericType(javaType string) (string, []string) {
+	javaType = strings.TrimSpace(javaType)
+	i := strings.Index(javaType, "<")
+	if i == -1 || !strings.HasSuffix(javaType, ">") {
+		return javaType, nil
+	}
+
+	var (
+		params []string
+		depth  int
+		start  = i + 1
+		inner  = javaType[:len(javaType)-1]
+	)
+	for j := start; j < len(inner); j++ {
+		switch inner[j] {
+		case '<':
+			depth++
+		case '>':
+			depth--
+		case ',':
+			if depth == 0 {
+				params = append(params, strings.TrimSpace(inner[start:j]))
+				start = j + 1
+			}
+		}
+	}
+	params = append(params, strings.TrimSpace(inner[start:]))
+
+	return javaType[:i], params
+}
+
+func jsonInt(v interface{}, min, max int64) (int64, error) {
+	switch n := v.(type) {
+	case json.Number:
+		i, err := n.Int64()
+		if err != nil {
+			return 0, jerrors.Errorf("%s is not an integer", n)
+		}
+		if i < min || max < i {
+			return 0, jerrors.Errorf("%d overflows [%d, %d]", i, min, max)
+		}
+		return i, nil
+	case float64:
+		if n != math.Trunc(n) || n < float64(min) || float64(max) < n {
+			return 0, jerrors.Errorf("%v is not an integer in [%d, %d]", n, min, max)
+		}
+		return int64(n), nil
+	default:
+		return 0, jerrors.Errorf("%v is not a number", v)
+	}
+}
+
+func jsonFloat(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, jerrors.Trace(err)
+	case float64:
+		return n, nil
+	default:
+		return 0, jerrors.Errorf("%v is not a number", v)
+	}
+}
+
+// java.util.Date is a timestamp in milliseconds or a RFC3339 string
+func jsonTime(v interface{}) (time.Time, error) {
+	if s, ok := v.(string); ok {
+		t, err := time.Parse(time.RFC3339, s)
+		return t, jerrors.Trace(err)
+	}
+	ms, err := jsonInt(v, math.MinInt64, math.MaxInt64)
+	if err != nil {
+		return time.Time{}, jerrors.Trace(err)
+	}
+	return time.Unix(ms/1000, ms%1000*int64(time.Millisecond)), nil
+}
+
+// hessianValue converts the json value @v, which is decoded with json.Decoder.UseNumber,
+// into the go value of java type @javaType which can be encoded by hessian.
+func hessianValue(javaType string, v interface{}) (interface{}, error) {
+	typ, params := splitGenericType(javaType)
+	if v == nil {
+		if _, ok := javaPrimitiveTypes[typ]; ok {
+			return nil, jerrors.Errorf("null value of java primitive type %s", typ)
+		}
+		return nil, nil
+	}
+
+	switch typ {
+	case "boolean", "java.lang.Boolean":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, jerrors.Errorf("%v is not a boolean", v)
+		}
+		return b, nil
+
+	// hessian has no byte & short, they are encoded as int
+	case "byte", "java.lang.Byte":
+		i, err := jsonInt(v, math.MinInt8, math.MaxInt8)
+		return int32(i), err
+	case "short", "java.lang.Short":
+		i, err := jsonInt(v, math.MinInt16, math.MaxInt16)
+		return int32(i), err
+	case "int", "java.lang.Integer":
+		i, err := jsonInt(v, math.MinInt32, math.MaxInt32)
+		return int32(i), err
+	case "long", "java.lang.Long":
+		return jsonInt(v, math.MinInt64, math.MaxInt64)
+
+	case "float", "double", "java.lang.Float", "java.lang.Double":
+		return jsonFloat(v)
+
+	case "char", "java.lang.Character", "java.lang.String":
+		s, ok := v.(string)
+		if !ok {
+			return nil, jerrors.Errorf("%v is not a string", v)
+		}
+		if typ != "java.lang.String" && utf8.RuneCountInString(s) != 1 {
+			return nil, jerrors.Errorf("%q is not a char", s)
+		}
+		return s, nil
+
+	case "java.util.Date":
+		return jsonTime(v)
+
+	case "byte[]": // base64 string
+		s, ok := v.(string)
+		if !ok {
+			return nil, jerrors.Errorf("%v is not a base64 string", v)
+		}
+		b, err := base64.StdEncoding.DecodeString(s)
+		return b, jerrors.Trace(err)
+
+	case "java.lang.Object":
+		return hessianObject(v)
+
+	case "java.util.List", "java.util.ArrayList", "java.util.LinkedList",
+		"java.util.Set", "java.util.HashSet", "java.util.Collection":
+		elemType := "java.lang.Object"
+		if len(params) == 1 {
+			elemType = params[0]
+		}
+		return hessianList(elemType, v)
+
+	case "java.util.Map", "java.util.HashMap", "java.util.LinkedHashMap", "java.util.TreeMap":
+		keyType, valueType := "java.lang.String", "java.lang.Object"
+		if len(params) == 2 {
+			keyType, valueType = params[0], params[1]
+		}
+		return hessianMap(keyType, valueType, v)
+	}
+
+	if strings.HasSuffix(typ, "[]") {
+		return hessianList(strings.TrimSuffix(typ, "[]"), v)
+	}
+
+	return hessianPOJO(typ, v)
+}
+
+var javaPrimitiveTypes = map[string]struct{}{
+	"boolean": {}, "byte": {}, "char": {}, "short": {}, "int": {}, "long": {}, "float": {}, "double": {},
+}
+
+func isListType(javaType string) bool {
+	typ, _ := splitGenericType(javaType)
+	if strings.HasSuffix(typ, "[]") {
+		return typ != "byte[]"
+	}
+	switch typ {
+	case "java.util.List", "java.util.ArrayList", "java.util.LinkedList",
+		"java.util.Set", "java.util.HashSet", "java.util.Collection":
+		return true
+	}
+	return false
+}
+
+func hessianList(elemType string, v interface{}) (interface{}, error) {
+	l, ok := v.([]interface{})
+	if !ok {
+		return nil, jerrors.Errorf("%v is not an array", v)
+	}
+
+	list := make([]interface{}, 0, len(l))
+	for i := range l {
+		e, err := hessianValue(elemType, l[i])
+		if err != nil {
+			return nil, jerrors.Annotatef(err, "element %d", i)
+		}
+		list = append(list, e)
+	}
+
+	return list, nil
+}
+
+// the keys of json object are strings, which are converted into @keyType
+func hessianMap(keyType, valueType string, v interface{}) (interface{}, error) {
+	o, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, jerrors.Errorf("%v is not an object", v)
+	}
+
+	m := make(map[interface{}]interface{}, len(o))
+	for k := range o {
+		var jk interface{} = k
+		if t, _ := splitGenericType(keyType); t != "java.lang.String" && t != "java.lang.Object" {
+			jk = json.Number(k)
+		}
+		key, err := hessianValue(keyType, jk)
+		if err != nil {
+			return nil, jerrors.Annotatef(err, "key %s", k)
+		}
+		value, err := hessianValue(valueType, o[k])
+		if err != nil {
+			return nil, jerrors.Annotatef(err, "value of key %s", k)
+		}
+		m[key] = value
+	}
+
+	return m, nil
+}
+
+// a json value without java type. An integer is java.lang.Integer if it
+// fits, otherwise java.lang.Long.
+func hessianObject(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			if math.MinInt32 <= i && i <= math.MaxInt32 {
+				return int32(i), nil
+			}
+			return i, nil
+		}
+		return jsonFloat(t)
+	case []interface{}:
+		return hessianList("java.lang.Object", t)
+	case map[string]interface{}:
+		return hessianMap("java.lang.String", "java.lang.Object", t)
+	default: // bool, string, float64
+		return v, nil
+	}
+}
+
+// the json object is decoded into the go struct registered for java class @javaName
+func hessianPOJO(javaName string, v interface{}) (interface{}, error) {
+	o, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, jerrors.Errorf("%v is not an object of java class %s", v, javaName)
+	}
+	p, ok := hessian.NewPOJO(javaName)
+	if !ok {
+		return nil, jerrors.Errorf("java class %s has not been registered by hessian.RegisterPOJO", javaName)
+	}
+
+	b, err := json.Marshal(o)
+	if err != nil {
+		return nil, jerrors.Trace(err)
+	}
+	if err = json.Unmarshal(b, p); err != nil {
+		return nil, jerrors.Annotatef(err, "json.Unmarshal(%s) into %s", b, javaName)
+	}
+
+	return p, nil
+}
+
+// lowerCamel converts "ID" into "id", "UserName" into "userName" & "URLPath" into "urlPath".
+func lowerCamel(name string) string {
+	r := []rune(name)
+	for i := 0; i < len(r) && unicode.IsUpper(r[i]); i++ {
+		if 0 < i && i+1 < len(r) && unicode.IsLower(r[i+1]) {
+			break
+		}
+		r[i] = unicode.ToLower(r[i])
+	}
+	return string(r)
+}
+
+// jsonValue converts the value decoded by hessian into a value that can be marshaled by
+// encoding/json. The field name of a go struct is its json tag or lower camel case name.
+func jsonValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case time.Time, []byte, string, bool, json.Marshaler:
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, 0, len(t))
+		for _, e := range t {
+			l = append(l, jsonValue(e))
+		}
+		return l
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct:
+		m := make(map[string]interface{}, rv.NumField())
+		for i := 0; i < rv.NumField(); i++ {
+			f := rv.Type().Field(i)
+			if f.PkgPath != "" { // unexported
+				continue
+			}
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = lowerCamel(f.Name)
+			}
+			m[name] = jsonValue(rv.Field(i).Interface())
+		}
+		return m
+
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil
+		}
+		l := make([]interface{}, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			l = append(l, jsonValue(rv.Index(i).Interface()))
+		}
+		return l
+
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil
+		}
+		m := make(map[string]interface{}, rv.Len())
+		for _, k := range rv.MapKeys() {
+			m[fmt.Sprint(k.Interface())] = jsonValue(rv.MapIndex(k).Interface())
+		}
+		return m
+
+	default:
+		return rv.Interface()
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// gateway exposes dubbo services as json over http.
+// The request "POST /{interface}/{method}" carries the json array of the method
+// params, or the only param itself if the method has one param. The params are
+// converted into hessian values by the java types of MethodConfig, and the
+// provider is invoked by the dubbo client whose registry routes the request.
+// The response body is the json of the result, or {"error": "..."}.
+
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+import (
+	log "github.com/AlexStocks/log4go"
+	jerrors "github.com/juju/errors"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/codec"
+	"github.com/AlexStocks/dubbogo/codec/hessian"
+	"github.com/AlexStocks/dubbogo/common"
+)
+
+type method struct {
+	service *ServiceConfig
+	name    string
+	types   []string
+}
+
+type Gateway struct {
+	opts    Options
+	methods map[string]*method // "interface/method" -> method
+}
+
+func NewGateway(opts ...Option) (*Gateway, error) {
+	g := &Gateway{
+		opts:    newOptions(opts...),
+		methods: make(map[string]*method),
+	}
+	if t := g.opts.Client.Options().CodecType; t != codec.CODECTYPE_DUBBO {
+		return nil, jerrors.Errorf("the codec of gateway client is %s rather than dubbo", t)
+	}
+
+	for i := range g.opts.ServiceConfList {
+		svc := &g.opts.ServiceConfList[i]
+		for _, m := range svc.Methods {
+			key := svc.Service + "/" + m.Name
+			if _, ok := g.methods[key]; ok {
+				return nil, jerrors.Errorf("duplicate method %s", key)
+			}
+			g.methods[key] = &method{service: svc, name: m.Name, types: m.ParamTypes}
+		}
+	}
+
+	return g, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		status = http.StatusInternalServerError
+		b, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// decode the json params of @m into hessian args
+func (m *method) args(body []byte) (*hessian.TypedArgs, error) {
+	var params []interface{}
+
+	body = bytes.TrimSpace(body)
+	if len(body) != 0 {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if len(m.types) == 1 && body[0] != '[' {
+			var param interface{}
+			if err := dec.Decode(&param); err != nil {
+				return nil, jerrors.Trace(err)
+			}
+			params = []interface{}{param}
+		} else if err := dec.Decode(&params); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+	}
+	// a single list param may be sent without the outer array
+	if len(m.types) == 1 && len(body) != 0 && isListType(m.types[0]) {
+		if len(params) != 1 {
+			params = []interface{}{params}
+		} else if _, ok := params[0].([]interface{}); !ok {
+			params = []interface{}{params}
+		}
+	}
+	if len(params) != len(m.types) {
+		return nil, jerrors.Errorf("method %s has %d params, but got %d", m.name, len(m.types), len(params))
+	}
+
+	args := &hessian.TypedArgs{Types: m.types, Args: make([]interface{}, 0, len(params))}
+	for i := range params {
+		arg, err := hessianValue(m.types[i], params[i])
+		if err != nil {
+			return nil, jerrors.Annotatef(err, "param %d", i)
+		}
+		args.Args = append(args.Args, arg)
+	}
+
+	return args, nil
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, jerrors.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+
+	key := strings.Trim(r.URL.Path, "/")
+	m, ok := g.methods[key]
+	if !ok {
+		writeError(w, http.StatusNotFound, jerrors.Errorf("can not find method %s", key))
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, g.opts.MaxBodySize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	args, err := m.args(body)
+	if err != nil {
+		log.Warn("gateway: method %s, body:%s, error:%v", key, body, err)
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	if g.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.opts.Timeout)
+		defer cancel()
+	}
+
+	var (
+		rsp interface{}
+		c   = g.opts.Client
+	)
+	req := c.NewRequest(m.service.Group, m.service.Version, m.service.Service, m.name, args)
+	err = c.Call(ctx, req, &rsp)
+	if jerrors.Cause(err) == hessian.ErrNullResponse {
+		err, rsp = nil, nil
+	}
+	if err != nil {
+		log.Warn("gateway: client.Call(%s, args:%+v) = error:%v", key, args.Args, jerrors.ErrorStack(err))
+		status := http.StatusBadGateway
+		if e, ok := jerrors.Cause(err).(*common.Error); ok && e.Code == http.StatusNotFound {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, jsonValue(rsp))
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/client"
+	"github.com/AlexStocks/dubbogo/codec"
+	"github.com/AlexStocks/dubbogo/codec/hessian"
+	"github.com/AlexStocks/dubbogo/codec/jsonrpc"
+	"github.com/AlexStocks/dubbogo/registry"
+)
+
+type User struct {
+	ID   string
+	Name string
+	Age  int32
+}
+
+func (User) JavaClassName() string {
+	return "com.ikurento.user.User"
+}
+
+type fakeRequest struct {
+	method string
+	args   interface{}
+}
+
+func (r *fakeRequest) Options() client.RequestOptions          { return client.RequestOptions{} }
+func (r *fakeRequest) Protocol() string                        { return "dubbo" }
+func (r *fakeRequest) Version() string                         { return "" }
+func (r *fakeRequest) Method() string                          { return r.method }
+func (r *fakeRequest) Args() interface{}                       { return r.args }
+func (r *fakeRequest) ContentType() string                     { return "application/dubbo" }
+func (r *fakeRequest) ServiceConfig() registry.ServiceConfigIf { return nil }
+func (r *fakeRequest) Stream() bool                            { return true }
+
+// fakeClient records the args of the last call
+type fakeClient struct {
+	args *hessian.TypedArgs
+}
+
+func (c *fakeClient) Options() client.Options {
+	return client.Options{CodecType: codec.CODECTYPE_DUBBO}
+}
+
+func (c *fakeClient) NewRequest(group, version, service, method string, args interface{}, reqOpts ...client.RequestOption) client.Request {
+	return &fakeRequest{method: method, args: args}
+}
+
+func (c *fakeClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	c.args = req.Args().(*hessian.TypedArgs)
+	switch req.Method() {
+	case "GetUser":
+		*(rsp.(*interface{})) = &User{ID: "A003", Name: "Alex", Age: 18}
+		return nil
+	case "AddUsers":
+		return nil
+	case "Ping":
+		return jerrors.Trace(hessian.ErrNullResponse)
+	default:
+		return jerrors.Errorf("java.lang.NoSuchMethodException: %s", req.Method())
+	}
+}
+
+func (c *fakeClient) BatchCall(ctx context.Context, group, version, service string, batch jsonrpc.Batch, opts ...client.CallOption) error {
+	return nil
+}
+func (c *fakeClient) String() string { return "fake-client" }
+func (c *fakeClient) Close()         {}
+
+func TestGateway(t *testing.T) {
+	hessian.RegisterPOJO(&User{})
+
+	c := &fakeClient{}
+	g, err := NewGateway(Client(c), ServiceConfList([]ServiceConfig{{
+		Service: "com.ikurento.user.UserProvider",
+		Methods: []MethodConfig{
+			{Name: "GetUser", ParamTypes: []string{"java.lang.String"}},
+			{Name: "AddUsers", ParamTypes: []string{"java.util.List<com.ikurento.user.User>"}},
+			{Name: "Ping", ParamTypes: []string{"int", "long", "java.util.Map<java.lang.String, java.lang.Integer>"}},
+			{Name: "Fail", ParamTypes: nil},
+		},
+	}}))
+	if err != nil {
+		t.Fatalf("NewGateway() = %v", err)
+	}
+
+	post := func(path, body string) (int, string) {
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, httptest.NewRequest("POST", "/com.ikurento.user.UserProvider/"+path, strings.NewReader(body)))
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+
+	// the only param without array
+	if code, body := post("GetUser", `"A003"`); code != http.StatusOK || body != `{"age":18,"id":"A003","name":"Alex"}` {
+		t.Errorf("GetUser() = %d, %s", code, body)
+	}
+	if !reflect.DeepEqual(c.args, &hessian.TypedArgs{Types: []string{"java.lang.String"}, Args: []interface{}{"A003"}}) {
+		t.Errorf("GetUser args:%+v", c.args)
+	}
+
+	if code, body := post("AddUsers", `[{"id":"A001","name":"Joe","age":20}]`); code != http.StatusOK {
+		t.Errorf("AddUsers() = %d, %s", code, body)
+	}
+	if users, ok := c.args.Args[0].([]interface{}); !ok || len(users) != 1 ||
+		!reflect.DeepEqual(users[0], &User{ID: "A001", Name: "Joe", Age: 20}) {
+		t.Errorf("AddUsers args:%#v", c.args.Args)
+	}
+
+	if code, body := post("Ping", `[1, 12345678901, {"a": 1}]`); code != http.StatusOK || body != "null" {
+		t.Errorf("Ping() = %d, %s", code, body)
+	}
+	if !reflect.DeepEqual(c.args.Args, []interface{}{int32(1), int64(12345678901), map[interface{}]interface{}{"a": int32(1)}}) {
+		t.Errorf("Ping args:%#v", c.args.Args)
+	}
+
+	if code, body := post("Ping", `[12345678901, 1, {}]`); code != http.StatusBadRequest {
+		t.Errorf("Ping(overflow) = %d, %s", code, body)
+	}
+	if code, body := post("Fail", ``); code != http.StatusBadGateway || !strings.Contains(body, "NoSuchMethodException") {
+		t.Errorf("Fail() = %d, %s", code, body)
+	}
+	if code, body := post("Unknown", ``); code != http.StatusNotFound {
+		t.Errorf("Unknown() = %d, %s", code, body)
+	}
+}
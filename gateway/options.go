@@ -0,0 +1,96 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"time"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/client"
+)
+
+const (
+	DefaultMaxBodySize = 4 * 1024 * 1024
+)
+
+// MethodConfig maps the json params of a dubbo method to their java types.
+type MethodConfig struct {
+	Name string `required:"true"`
+	// java types of the params, such as "int", "java.lang.String",
+	// "java.util.List<com.ikurento.user.User>" & "com.ikurento.user.User".
+	// The go struct of a POJO type should be registered by hessian.RegisterPOJO.
+	ParamTypes []string
+}
+
+// ServiceConfig is a dubbo service exposed by the gateway.
+type ServiceConfig struct {
+	Service string `required:"true"` // 其本质是dubbo.xml中的interface
+	Group   string
+	Version string
+	Methods []MethodConfig
+}
+
+type Options struct {
+	// the dubbo client whose registry routes the requests
+	Client          client.Client
+	ServiceConfList []ServiceConfig
+	// Timeout of a request, the default is the request timeout of Client
+	Timeout     time.Duration
+	MaxBodySize int64
+}
+
+type Option func(*Options)
+
+func newOptions(opt ...Option) Options {
+	opts := Options{
+		MaxBodySize: DefaultMaxBodySize,
+	}
+
+	for _, o := range opt {
+		o(&opts)
+	}
+
+	if opts.Client == nil {
+		panic("gateway.Options.Client is nil")
+	}
+
+	return opts
+}
+
+// Client is a dubbo client created with client.CodecType(codec.CODECTYPE_DUBBO)
+func Client(c client.Client) Option {
+	return func(o *Options) {
+		o.Client = c
+	}
+}
+
+func ServiceConfList(confList []ServiceConfig) Option {
+	return func(o *Options) {
+		o.ServiceConfList = confList
+	}
+}
+
+func Timeout(t time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = t
+	}
+}
+
+func MaxBodySize(size int64) Option {
+	return func(o *Options) {
+		o.MaxBodySize = size
+	}
+}
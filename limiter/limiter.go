@@ -0,0 +1,330 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// limiter is the adaptive concurrency limiter of the client. Every provider node of a
+// service has a limit of in-flight calls, which grows and shrinks by the latencies and
+// failures of the calls. The calls exceeding the limit fail fast with ErrLimitExceeded.
+//
+//	l := limiter.NewGroup(limiter.WithServiceConfig("com.ikurento.user.UserProvider",
+//		limiter.Config{Algorithm: limiter.Gradient}))
+//	c := client.NewClient(client.Limiter(l), ...)
+
+package limiter
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+import (
+	log "github.com/AlexStocks/log4go"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/breaker"
+	"github.com/AlexStocks/dubbogo/registry"
+)
+
+var (
+	ErrLimitExceeded = errors.New("concurrency limit exceeded")
+)
+
+//////////////////////////////////////////
+// config
+//////////////////////////////////////////
+
+type Algorithm int
+
+const (
+	// AIMD increases the limit by one on a success, and multiplies it by
+	// Config.BackoffRatio on a failure or a call slower than Config.Timeout.
+	AIMD Algorithm = iota
+	// Gradient adjusts the limit by the gradient of the long-term and the short-term
+	// latencies, which shrinks the limit when the latency of the node increases.
+	Gradient
+)
+
+var algorithmStrings = [...]string{
+	"aimd",
+	"gradient",
+}
+
+func (a Algorithm) String() string {
+	return algorithmStrings[a]
+}
+
+// Config of the limiter, its zero fields are set to the defaults.
+type Config struct {
+	Algorithm Algorithm
+	// InitialLimit is the limit of a new node, which is kept in [MinLimit, MaxLimit]
+	InitialLimit int
+	MinLimit     int
+	MaxLimit     int
+	// BackoffRatio of AIMD(default 0.9), or the min gradient of Gradient(default 0.5)
+	BackoffRatio float64
+	// Timeout of AIMD, a call slower than it is a failure. 0 means only errors are failures.
+	Timeout time.Duration
+	// Tolerance of Gradient, the limit shrinks only if the short-term latency is
+	// larger than Tolerance times of the long-term latency.
+	Tolerance float64
+	// LongWindow & ShortWindow of Gradient are the samples of the moving averages of latency
+	LongWindow  int
+	ShortWindow int
+	// Smoothing of Gradient, the weight of the new limit
+	Smoothing float64
+	// IsFailure reports whether @err is a sign of the overload of the node, which backs
+	// the limit off. The default is breaker.IsNodeFailure.
+	IsFailure func(err error) bool
+}
+
+const (
+	DefaultInitialLimit = 20
+	DefaultMinLimit     = 1
+	DefaultMaxLimit     = 1000
+	DefaultBackoffRatio = 0.9
+	DefaultMinGradient  = 0.5
+	DefaultTolerance    = 1.5
+	DefaultLongWindow   = 600
+	DefaultShortWindow  = 10
+	DefaultSmoothing    = 0.2
+)
+
+func (c Config) withDefaults() Config {
+	if c.MinLimit <= 0 {
+		c.MinLimit = DefaultMinLimit
+	}
+	if c.MaxLimit <= 0 {
+		c.MaxLimit = DefaultMaxLimit
+	}
+	if c.MaxLimit < c.MinLimit {
+		c.MaxLimit = c.MinLimit
+	}
+	if c.InitialLimit <= 0 {
+		c.InitialLimit = DefaultInitialLimit
+	}
+	c.InitialLimit = int(clamp(float64(c.InitialLimit), float64(c.MinLimit), float64(c.MaxLimit)))
+	if c.BackoffRatio <= 0 || 1 <= c.BackoffRatio {
+		c.BackoffRatio = DefaultBackoffRatio
+		if c.Algorithm == Gradient {
+			c.BackoffRatio = DefaultMinGradient
+		}
+	}
+	if c.Tolerance < 1 {
+		c.Tolerance = DefaultTolerance
+	}
+	if c.LongWindow <= 0 {
+		c.LongWindow = DefaultLongWindow
+	}
+	if c.ShortWindow <= 0 {
+		c.ShortWindow = DefaultShortWindow
+	}
+	if c.Smoothing <= 0 || 1 < c.Smoothing {
+		c.Smoothing = DefaultSmoothing
+	}
+	if c.IsFailure == nil {
+		c.IsFailure = breaker.IsNodeFailure
+	}
+	return c
+}
+
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, v))
+}
+
+//////////////////////////////////////////
+// limiter of a node
+//////////////////////////////////////////
+
+type nodeLimiter struct {
+	conf Config
+
+	sync.Mutex
+	limit    float64
+	inflight int
+	// the moving averages of the latencies of Gradient, in nanoseconds
+	longRTT  float64
+	shortRTT float64
+}
+
+func newNodeLimiter(conf Config) *nodeLimiter {
+	return &nodeLimiter{
+		conf:  conf,
+		limit: float64(conf.InitialLimit),
+	}
+}
+
+func (l *nodeLimiter) acquire() bool {
+	l.Lock()
+	defer l.Unlock()
+	if int(l.limit) <= l.inflight {
+		return false
+	}
+	l.inflight++
+	return true
+}
+
+// done updates the limit by the result of a call, and returns the old & new limits.
+func (l *nodeLimiter) done(latency time.Duration, err error) (int, int) {
+	l.Lock()
+	defer l.Unlock()
+
+	inflight := l.inflight
+	l.inflight--
+	old := int(l.limit)
+	// the call rejected by the open breaker never reaches the node, it only frees its slot
+	if err == breaker.ErrOpen {
+		return old, old
+	}
+	failed := l.conf.IsFailure(err)
+	if l.conf.Algorithm == Gradient {
+		l.gradient(inflight, latency, failed)
+	} else {
+		l.aimd(inflight, latency, failed)
+	}
+	l.limit = clamp(l.limit, float64(l.conf.MinLimit), float64(l.conf.MaxLimit))
+	return old, int(l.limit)
+}
+
+func (l *nodeLimiter) aimd(inflight int, latency time.Duration, failed bool) {
+	if failed || (0 < l.conf.Timeout && l.conf.Timeout < latency) {
+		l.limit *= l.conf.BackoffRatio
+		return
+	}
+	// do not grow the limit if the node is not busy
+	if l.limit <= float64(2*inflight) {
+		l.limit++
+	}
+}
+
+func ema(avg, sample float64, window int) float64 {
+	if avg == 0 {
+		return sample
+	}
+	factor := 2 / float64(window+1)
+	return avg*(1-factor) + sample*factor
+}
+
+func (l *nodeLimiter) gradient(inflight int, latency time.Duration, failed bool) {
+	rtt := float64(latency)
+	if 0 < rtt {
+		l.shortRTT = ema(l.shortRTT, rtt, l.conf.ShortWindow)
+		l.longRTT = ema(l.longRTT, rtt, l.conf.LongWindow)
+		// the long-term latency recovers quickly after a congestion
+		if l.shortRTT < l.longRTT {
+			l.longRTT = l.shortRTT
+		}
+	}
+	if l.shortRTT == 0 {
+		return
+	}
+
+	gradient := clamp(l.conf.Tolerance*l.longRTT/l.shortRTT, l.conf.BackoffRatio, 1)
+	if failed {
+		gradient = l.conf.BackoffRatio
+	}
+	limit := l.limit * gradient
+	// probe a larger limit by a queue of sqrt(limit) if the node is busy
+	if !failed && l.limit <= float64(2*inflight) {
+		limit += math.Sqrt(l.limit)
+	}
+	l.limit = l.limit*(1-l.conf.Smoothing) + limit*l.conf.Smoothing
+}
+
+//////////////////////////////////////////
+// limiters of all nodes
+//////////////////////////////////////////
+
+type Options struct {
+	Config         Config            // the algorithm & limits of the services without their own
+	ServiceConfigs map[string]Config // service interface -> config
+}
+
+type Option func(*Options)
+
+// WithConfig sets the limiter config of the services without WithServiceConfig
+func WithConfig(conf Config) Option {
+	return func(o *Options) {
+		o.Config = conf
+	}
+}
+
+// WithServiceConfig sets the limiter config of the provider nodes of @service
+func WithServiceConfig(service string, conf Config) Option {
+	return func(o *Options) {
+		o.ServiceConfigs[service] = conf
+	}
+}
+
+// Group holds a limiter of every provider node of the services, which starts with
+// Config.InitialLimit. It is safe for concurrent use.
+type Group struct {
+	limiters *breaker.Nodes
+}
+
+func NewGroup(opts ...Option) *Group {
+	options := Options{
+		ServiceConfigs: make(map[string]Config),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return &Group{
+		limiters: breaker.NewNodes(func(service, location string) interface{} {
+			conf, ok := options.ServiceConfigs[service]
+			if !ok {
+				conf = options.Config
+			}
+			return newNodeLimiter(conf.withDefaults())
+		}),
+	}
+}
+
+func (g *Group) limiter(service string, url *registry.ServiceURL) *nodeLimiter {
+	return g.limiters.Get(service, url.Location).(*nodeLimiter)
+}
+
+// Remove drops the limiters of the provider @location, so a provider which comes back
+// starts with Config.InitialLimit again. It's the callback of selector.RemoveNotifier.
+func (g *Group) Remove(location string) {
+	g.limiters.Remove(location)
+}
+
+// Limit returns the current limit & in-flight calls of the provider @url of @service
+func (g *Group) Limit(service string, url *registry.ServiceURL) (limit, inflight int) {
+	l := g.limiter(service, url)
+	l.Lock()
+	defer l.Unlock()
+	return int(l.limit), l.inflight
+}
+
+// Acquire permits a call to the provider @url of @service, whose result should be
+// reported by @done, and done(breaker.ErrOpen) only frees the slot of the call rejected by
+// the breaker. It returns ErrLimitExceeded if the in-flight calls reach the limit.
+func (g *Group) Acquire(service string, url *registry.ServiceURL) (done func(error), err error) {
+	l := g.limiter(service, url)
+	if !l.acquire() {
+		return nil, ErrLimitExceeded
+	}
+
+	start := time.Now()
+	return func(err error) {
+		if old, limit := l.done(time.Since(start), err); old != limit {
+			log.Debug("concurrency limit of service %s provider %s: %d -> %d",
+				service, url.Location, old, limit)
+		}
+	}, nil
+}
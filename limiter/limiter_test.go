@@ -0,0 +1,117 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package limiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/breaker"
+	"github.com/AlexStocks/dubbogo/codec/hessian"
+	"github.com/AlexStocks/dubbogo/common"
+	"github.com/AlexStocks/dubbogo/registry"
+)
+
+const service = "com.ikurento.user.UserProvider"
+
+func TestAIMD(t *testing.T) {
+	g := NewGroup(WithServiceConfig(service, Config{InitialLimit: 4, MaxLimit: 6, BackoffRatio: 0.5}))
+	url := &registry.ServiceURL{Location: "127.0.0.1:20000"}
+
+	var dones []func(error)
+	for i := 0; i < 4; i++ {
+		done, err := g.Acquire(service, url)
+		if err != nil {
+			t.Fatalf("Acquire() = %v", err)
+		}
+		dones = append(dones, done)
+	}
+	if _, err := g.Acquire(service, url); err != ErrLimitExceeded {
+		t.Fatalf("Acquire() = %v, expected ErrLimitExceeded", err)
+	}
+
+	// the limit grows while the node is busy, and never exceeds MaxLimit
+	for _, done := range dones {
+		done(nil)
+	}
+	if limit, inflight := g.Limit(service, url); limit != 6 || inflight != 0 {
+		t.Fatalf("limit:%d, inflight:%d", limit, inflight)
+	}
+	// 4xx errors are not failures of the node
+	done, _ := g.Acquire(service, url)
+	done(common.NotFound("dubbogo.client", "no such method"))
+	if limit, _ := g.Limit(service, url); limit != 6 {
+		t.Fatalf("limit:%d, expected 6", limit)
+	}
+	// the call rejected by the open breaker is not sampled
+	done, _ = g.Acquire(service, url)
+	done(breaker.ErrOpen)
+	if limit, inflight := g.Limit(service, url); limit != 6 || inflight != 0 {
+		t.Fatalf("limit:%d, inflight:%d after breaker.ErrOpen", limit, inflight)
+	}
+	done, _ = g.Acquire(service, url)
+	done(errors.New("oops"))
+	if limit, _ := g.Limit(service, url); limit != 3 {
+		t.Fatalf("limit:%d, expected 3", limit)
+	}
+	// the null response of java is a normal return
+	done, _ = g.Acquire(service, url)
+	done(hessian.ErrNullResponse)
+	if limit, _ := g.Limit(service, url); limit != 3 {
+		t.Fatalf("limit:%d after a null response, expected 3", limit)
+	}
+
+	// the removed provider starts with InitialLimit when it comes back
+	g.Remove(url.Location)
+	if limit, _ := g.Limit(service, url); limit != 4 {
+		t.Errorf("limit:%d after Remove, expected 4", limit)
+	}
+}
+
+func TestGradient(t *testing.T) {
+	g := NewGroup(WithConfig(Config{Algorithm: Gradient, InitialLimit: 100, ShortWindow: 1}))
+	url := &registry.ServiceURL{Location: "127.0.0.1:20000"}
+	l := g.limiter(service, url)
+
+	call := func(latency time.Duration) int {
+		l.acquire()
+		_, limit := l.done(latency, nil)
+		return limit
+	}
+	for i := 0; i < 10; i++ {
+		call(10 * time.Millisecond)
+	}
+	if limit, _ := g.Limit(service, url); limit != 100 {
+		t.Fatalf("limit:%d, expected 100", limit)
+	}
+	// the limit shrinks as the latency increases
+	limit := 100
+	for i := 0; i < 10; i++ {
+		limit = call(100 * time.Millisecond)
+	}
+	if 50 <= limit {
+		t.Fatalf("limit:%d, expected less than 50", limit)
+	}
+	// and grows when the node is busy again
+	for i := 0; i < limit; i++ {
+		l.acquire()
+	}
+	if _, grown := l.done(10*time.Millisecond, nil); grown <= limit {
+		t.Fatalf("limit:%d, expected larger than %d", grown, limit)
+	}
+}
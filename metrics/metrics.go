@@ -0,0 +1,208 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// metrics exports the prometheus series of dubbogo rpc calls, connection pool,
+// selector cache and zookeeper client. They are registered in Registry, which
+// can be served by Handler or gathered with other collectors.
+
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/common"
+)
+
+const (
+	NAMESPACE = "dubbogo"
+
+	// result code of a successful call
+	CODE_OK = "ok"
+	// result code of a failed call whose error is not a common.Error
+	CODE_ERROR = "error"
+)
+
+var (
+	// Registry holds all of the dubbogo series
+	Registry = prometheus.NewRegistry()
+
+	// client
+	ClientRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "client",
+		Name:      "requests_total",
+		Help:      "Number of requests sent to providers.",
+	}, []string{"service", "method", "provider", "code"})
+	ClientLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "client",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of requests sent to providers.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "method", "provider", "code"})
+
+	// server
+	ServerRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "server",
+		Name:      "requests_total",
+		Help:      "Number of requests handled by the server.",
+	}, []string{"service", "method", "code"})
+	ServerLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "server",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of requests handled by the server.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "method", "code"})
+
+	// client connection pool
+	PoolConns = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "pool",
+		Name:      "idle_conns",
+		Help:      "Number of idle connections in the client connection pool.",
+	}, []string{"address", "protocol"})
+	PoolActiveConns = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "pool",
+		Name:      "active_conns",
+		Help:      "Number of open connections, idle or in use, in the client connection pool.",
+	}, []string{"address", "protocol"})
+	PoolHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "pool",
+		Name:      "hits_total",
+		Help:      "Number of connections reused from the pool.",
+	}, []string{"address", "protocol"})
+	PoolMisses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "pool",
+		Name:      "misses_total",
+		Help:      "Number of connections dialed because the pool has no idle one.",
+	}, []string{"address", "protocol"})
+	PoolEvictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "pool",
+		Name:      "evictions_total",
+		Help:      "Number of connections closed by the pool, such as expired or overflowed ones.",
+	}, []string{"address", "protocol"})
+	PoolWaitTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "pool",
+		Name:      "wait_timeouts_total",
+		Help:      "Number of calls which time out waiting for a free connection.",
+	}, []string{"address", "protocol"})
+
+	// result cache
+	CacheHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "cache",
+		Name:      "hits_total",
+		Help:      "Number of calls served by the client result cache.",
+	}, []string{"service", "method"})
+	CacheMisses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "cache",
+		Name:      "misses_total",
+		Help:      "Number of calls which miss the client result cache.",
+	}, []string{"service", "method"})
+
+	// selector
+	SelectorCacheProviders = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "selector",
+		Name:      "cache_providers",
+		Help:      "Number of providers of a service in the selector cache.",
+	}, []string{"service"})
+	SelectorWatchEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "selector",
+		Name:      "watch_events_total",
+		Help:      "Number of service url events received from the registry watcher.",
+	}, []string{"action"})
+	SelectorEjectedProviders = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "selector",
+		Name:      "ejected_providers",
+		Help:      "Number of providers of a service ejected by the outlier detection.",
+	}, []string{"service"})
+	SelectorEjections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "selector",
+		Name:      "ejections_total",
+		Help:      "Number of ejections of a provider by the outlier detection.",
+	}, []string{"service", "provider", "reason"})
+
+	// zookeeper
+	ZkStateTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Subsystem: "zookeeper",
+		Name:      "state_transitions_total",
+		Help:      "Number of zookeeper session state transitions, labelled by the new state.",
+	}, []string{"client", "state"})
+)
+
+func init() {
+	Registry.MustRegister(
+		ClientRequests, ClientLatency,
+		ServerRequests, ServerLatency,
+		PoolConns, PoolActiveConns, PoolHits, PoolMisses, PoolEvictions, PoolWaitTimeouts,
+		CacheHits, CacheMisses,
+		SelectorCacheProviders, SelectorWatchEvents,
+		SelectorEjectedProviders, SelectorEjections,
+		ZkStateTransitions,
+	)
+}
+
+// ResultCode is the code label of a call result: "ok", the code of common.Error or "error".
+func ResultCode(err error) string {
+	if err == nil {
+		return CODE_OK
+	}
+	if e, ok := jerrors.Cause(err).(*common.Error); ok {
+		return strconv.Itoa(int(e.Code))
+	}
+	return CODE_ERROR
+}
+
+// ObserveClient records a request sent to @provider which starts at @start.
+func ObserveClient(service, method, provider string, start time.Time, err error) {
+	code := ResultCode(err)
+	ClientRequests.WithLabelValues(service, method, provider, code).Inc()
+	ClientLatency.WithLabelValues(service, method, provider, code).Observe(time.Since(start).Seconds())
+}
+
+// ObserveServer records a request handled by the server which starts at @start.
+func ObserveServer(service, method string, start time.Time, err error) {
+	code := ResultCode(err)
+	ServerRequests.WithLabelValues(service, method, code).Inc()
+	ServerLatency.WithLabelValues(service, method, code).Observe(time.Since(start).Seconds())
+}
+
+// Handler serves the series of Registry in the prometheus text format, e.g.
+// http.Handle("/metrics", metrics.Handler())
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
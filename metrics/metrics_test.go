@@ -0,0 +1,69 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/common"
+)
+
+func TestResultCode(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		code string
+	}{
+		{nil, CODE_OK},
+		{errors.New("oops"), CODE_ERROR},
+		{common.NotFound("dubbogo.client", "no provider"), "404"},
+		{jerrors.Trace(common.NewError("dubbogo.client", "timeout", 408)), "408"},
+	} {
+		if code := ResultCode(c.err); code != c.code {
+			t.Errorf("ResultCode(%v) = %s, expected:%s", c.err, code, c.code)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ObserveServer("com.ikurento.Echo", "Hello", time.Now(), nil)
+	ObserveServer("com.ikurento.Echo", "Hello", time.Now(), errors.New("oops"))
+	if n := testutil.ToFloat64(ServerRequests.WithLabelValues("com.ikurento.Echo", "Hello", CODE_OK)); n != 1 {
+		t.Errorf("ok requests:%v", n)
+	}
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	b, _ := ioutil.ReadAll(w.Body)
+	for _, s := range []string{
+		`dubbogo_server_requests_total{code="error",method="Hello",service="com.ikurento.Echo"} 1`,
+		`dubbogo_server_request_duration_seconds_count{code="ok",method="Hello",service="com.ikurento.Echo"} 1`,
+	} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("%s is not in:\n%s", s, b)
+		}
+	}
+}
@@ -16,6 +16,7 @@ package registry
 
 import (
 	"fmt"
+	"net/url"
 )
 
 import (
@@ -40,6 +41,19 @@ type ServiceConfig struct {
 	Service  string `required:"true"`                 // 其本质是dubbo.xml中的interface
 	Group    string
 	Version  string
+	Sign     bool // the requests of the service are signed by the access keys
+	// Mock of the consumer, such as "force:return null", "fail:return {...}", "fail:throw",
+	// or "force" & "fail" which call the mock implementation registered in the client.
+	Mock string
+}
+
+// Params of the consumer config, which can be overridden by the configurators
+func (c ServiceConfig) Params() url.Values {
+	params := url.Values{}
+	if len(c.Mock) != 0 {
+		params.Set("mock", c.Mock)
+	}
+	return params
 }
 
 func (c ServiceConfig) Key() string {
@@ -77,6 +91,8 @@ type ProviderServiceConfig struct {
 	ServiceConfig
 	Path    string
 	Methods string
+	// Params are published in the provider url, such as tps, executes etc
+	Params url.Values
 }
 
 func (c ProviderServiceConfig) String() string {
@@ -123,6 +139,7 @@ type ServerConfig struct {
 	Protocol string `required:"true",default:"dubbo"` // codec string, jsonrpc etc
 	IP       string
 	Port     int `required:"true"`
+	Accepts  int // max connections, 0 is unlimited
 }
 
 func (c *ServerConfig) Address() string {
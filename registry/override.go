@@ -0,0 +1,60 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"net"
+	"net/url"
+)
+
+// the params of the override urls which select the consumers, rather than override their configs
+var overrideKeys = map[string]struct{}{
+	"category": {}, "dynamic": {}, "enabled": {}, "application": {}, "interface": {},
+	"group": {}, "version": {}, "side": {}, "anyhost": {}, "timestamp": {},
+}
+
+// OverrideParams merges the params of the dubbo override urls @urls, such as
+// "override://0.0.0.0/com.xxx.Service?category=configurators&mock=force:return+null",
+// which match the consumer @conf of the application @app at @ip. The later urls take
+// precedence.
+func OverrideParams(urls []string, conf ServiceConfig, app, ip string) url.Values {
+	params := url.Values{}
+	for _, u := range urls {
+		s, err := NewServiceURL(u)
+		if err != nil || s.Protocol != "override" || s.Query.Get("enabled") == "false" {
+			continue
+		}
+		host, _, err := net.SplitHostPort(s.Location)
+		if err != nil {
+			host = s.Location
+		}
+		if host != "0.0.0.0" && host != ip {
+			continue
+		}
+		if a := s.Query.Get("application"); len(a) != 0 && a != app {
+			continue
+		}
+		if (len(s.Group) != 0 && s.Group != conf.Group) || (len(s.Version) != 0 && s.Version != conf.Version) {
+			continue
+		}
+
+		for k, v := range s.Query {
+			if _, ok := overrideKeys[k]; !ok {
+				params[k] = v
+			}
+		}
+	}
+	return params
+}
@@ -17,6 +17,7 @@ package registry
 
 import (
 	"errors"
+	"net/url"
 )
 
 // Result is returned by a call to Next on
@@ -46,6 +47,19 @@ type Registry interface {
 	String() string
 }
 
+// Unregisterer is implemented by the registry which can delete a registered provider
+// before it is closed, such as the provider zookeeper registry.
+type Unregisterer interface {
+	Unregister(conf interface{}) error
+}
+
+// Configurator is implemented by the consumer registry which provides the params of the
+// registered services, overridden by the dynamic configs such as the zookeeper configurators.
+type Configurator interface {
+	// Config returns the params of the service @conf, such as "mock"
+	Config(conf ServiceConfigIf) url.Values
+}
+
 const (
 	REGISTRY_CONN_DELAY = 3 // watchDir中使用，防止不断地对zk重连
 )
@@ -149,3 +149,19 @@ func (s *ServiceURL) CheckMethod(method string) bool {
 
 	return false
 }
+
+// TLS reports whether the provider is served by tls
+func (s *ServiceURL) TLS() bool {
+	return s.Query.Get("tls") == "true"
+}
+
+// MethodParam returns the url param @key of @method, such as "sayHello.timeout",
+// or the service level param @key if the method one is absent.
+func (s *ServiceURL) MethodParam(method, key string) string {
+	if len(method) != 0 {
+		if v := s.Query.Get(method + "." + key); len(v) != 0 {
+			return v
+		}
+	}
+	return s.Query.Get(key)
+}
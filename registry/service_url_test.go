@@ -16,6 +16,7 @@ package registry // for go test -v
 
 import (
 	"fmt"
+	"net/url"
 	"testing"
 )
 
@@ -56,3 +57,49 @@ func TestServiceURL_NewServiceURL(t *testing.T) {
 	fmt.Println("serviceURL.query:", serviceURL.Query)
 	fmt.Println("serviceURL.query.interface:", serviceURL.Query.Get("interface"))
 }
+
+func TestServiceURL_MethodParam(t *testing.T) {
+	serviceURL, err := NewServiceURL("dubbo://127.0.0.1:20880/com.ikurento.user.UserProvider?interface=com.ikurento.user.UserProvider" +
+		"&timeout=3000&retries=2&GetUser.timeout=500&GetUser.loadbalance=roundrobin")
+	if err != nil {
+		t.Fatalf("NewServiceURL() = %v", err)
+	}
+
+	for _, c := range []struct {
+		method, key, value string
+	}{
+		{"GetUser", "timeout", "500"},
+		{"GetUser", "retries", "2"},
+		{"GetUser", "loadbalance", "roundrobin"},
+		{"AddUser", "timeout", "3000"},
+		{"AddUser", "loadbalance", ""},
+		{"", "timeout", "3000"},
+	} {
+		if v := serviceURL.MethodParam(c.method, c.key); v != c.value {
+			t.Errorf("MethodParam(%s, %s) = %q, expected:%q", c.method, c.key, v, c.value)
+		}
+	}
+}
+
+func TestOverrideParams(t *testing.T) {
+	conf := ServiceConfig{Protocol: "dubbo", Service: "com.ikurento.user.UserProvider", Version: "1.0", Mock: "fail:return null"}
+	var urls []string
+	for _, u := range []string{
+		"override://0.0.0.0/com.ikurento.user.UserProvider?category=configurators&mock=force%3Areturn+null&timeout=100",
+		"override://10.0.0.1/com.ikurento.user.UserProvider?category=configurators&timeout=200",
+		"override://0.0.0.0/com.ikurento.user.UserProvider?category=configurators&application=other&timeout=300",
+		"override://0.0.0.0/com.ikurento.user.UserProvider?category=configurators&version=2.0&timeout=400",
+		"override://0.0.0.0/com.ikurento.user.UserProvider?category=configurators&enabled=false&timeout=500",
+		"override://127.0.0.1:20880/com.ikurento.user.UserProvider?category=configurators&application=app&retries=5",
+	} {
+		urls = append(urls, url.QueryEscape(u))
+	}
+
+	params := conf.Params()
+	for k, v := range OverrideParams(urls, conf, "app", "127.0.0.1") {
+		params[k] = v
+	}
+	if e := "mock=force%3Areturn+null&retries=5&timeout=100"; params.Encode() != e {
+		t.Errorf("params:%s, expected:%s", params.Encode(), e)
+	}
+}
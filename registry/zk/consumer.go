@@ -38,6 +38,7 @@ const (
 
 type consumerZookeeperRegistry struct {
 	*zookeeperRegistry
+	overrides map[string]url.Values // service name + protocol -> params of the configurators
 }
 
 func NewConsumerZookeeperRegistry(opts ...registry.Option) registry.Registry {
@@ -58,7 +59,7 @@ func NewConsumerZookeeperRegistry(opts ...registry.Option) registry.Registry {
 		return nil
 	}
 	reg.client.name = ConsumerRegistryZkClient
-	c = &consumerZookeeperRegistry{zookeeperRegistry: reg}
+	c = &consumerZookeeperRegistry{zookeeperRegistry: reg, overrides: make(map[string]url.Values)}
 	c.wg.Add(1)
 	go c.handleZkRestart()
 
@@ -155,6 +156,16 @@ func (c *consumerZookeeperRegistry) register(conf *registry.ServiceConfig) error
 		return jerrors.Trace(err)
 	}
 
+	// 创建服务下面的configurators node，以方便watch动态配置
+	dubboPath = fmt.Sprintf("/dubbo/%s/%s", conf.Service, DubboNodes[CONFIGURATOR])
+	c.Lock()
+	err = c.client.Create(dubboPath)
+	c.Unlock()
+	if err != nil {
+		log.Error("zkClient.create(path{%s}) = error{%v}", dubboPath, jerrors.ErrorStack(err))
+		return jerrors.Trace(err)
+	}
+
 	params = url.Values{}
 	params.Add("interface", conf.Service)
 	params.Add("application", c.ApplicationConfig.Name)
@@ -298,6 +309,7 @@ func (c *consumerZookeeperRegistry) Watch() (registry.Watcher, error) {
 			// watchService过程中会产生event，如果zookeeperWatcher{events} channel被塞满，
 			// 但是selector还没有准备好接收，下面这个函数就会阻塞，所以起动一个gr以防止阻塞for-loop
 			go zkWatcher.watchService(dubboPath, *serviceConf)
+			go c.watchConfigurators(client, *serviceConf)
 		}
 	}
 	c.Unlock()
@@ -377,6 +389,65 @@ func (c *consumerZookeeperRegistry) GetServices(i registry.ServiceConfigIf) ([]*
 	return services, nil
 }
 
+// watchConfigurators keeps the params of the override urls in /dubbo/service/configurators
+// of @conf until @client is closed by the watcher.
+func (c *consumerZookeeperRegistry) watchConfigurators(client *zookeeperClient, conf registry.ServiceConfig) {
+	var (
+		failTimes int
+		dubboPath = fmt.Sprintf("/dubbo/%s/%s", conf.Service, DubboNodes[CONFIGURATOR])
+	)
+
+	for {
+		children, eventCh, err := client.getChildrenW(dubboPath)
+		if err != nil {
+			failTimes++
+			if MAX_TIMES <= failTimes {
+				failTimes = MAX_TIMES
+			}
+			log.Error("watchConfigurators(path{%s}) = error{%v}", dubboPath, err)
+			select {
+			case <-time.After(common.TimeSecondDuration(failTimes * registry.REGISTRY_CONN_DELAY)):
+				continue
+			case <-client.done():
+				return
+			}
+		}
+		failTimes = 0
+
+		params := registry.OverrideParams(children, conf, c.ApplicationConfig.Name, localIP)
+		log.Info("configurators of service %s: %s", conf.Key(), params.Encode())
+		c.Lock()
+		c.overrides[conf.Key()] = params
+		c.Unlock()
+
+		select {
+		case <-eventCh:
+		case <-client.done():
+			log.Warn("client.done(), watchConfigurators(path{%s}) goroutine exit now...", dubboPath)
+			return
+		}
+	}
+}
+
+// Config returns the params of the registered service @i overridden by its configurators
+func (c *consumerZookeeperRegistry) Config(i registry.ServiceConfigIf) url.Values {
+	params := url.Values{}
+	sc, ok := i.(*registry.ServiceConfig)
+	if !ok {
+		return params
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if conf, ok := c.services[sc.Key()].(*registry.ServiceConfig); ok {
+		params = conf.Params()
+	}
+	for k, v := range c.overrides[sc.Key()] {
+		params[k] = v
+	}
+	return params
+}
+
 func (c *consumerZookeeperRegistry) String() string {
 	return "dubbogo-consumer-zookeeper-registry"
 }
@@ -38,7 +38,8 @@ const (
 
 type providerZookeeperRegistry struct {
 	*zookeeperRegistry
-	zkPath map[string]int // key = protocol://ip:port/interface
+	zkPath map[string]int    // key = protocol://ip:port/interface
+	nodes  map[string]string // ProviderServiceConfig.String() -> zk node of the provider url
 }
 
 func NewProviderZookeeperRegistry(opts ...registry.Option) registry.Registry {
@@ -59,7 +60,11 @@ func NewProviderZookeeperRegistry(opts ...registry.Option) registry.Registry {
 		return nil
 	}
 	reg.client.name = ProviderRegistryZkClient
-	s = &providerZookeeperRegistry{zookeeperRegistry: reg, zkPath: make(map[string]int)}
+	s = &providerZookeeperRegistry{
+		zookeeperRegistry: reg,
+		zkPath:            make(map[string]int),
+		nodes:             make(map[string]string),
+	}
 	s.wg.Add(1)
 	go s.handleZkRestart()
 
@@ -180,6 +185,11 @@ func (s *providerZookeeperRegistry) register(conf *registry.ProviderServiceConfi
 	if conf.Methods != "" {
 		params.Add("methods", conf.Methods)
 	}
+	for key, values := range conf.Params {
+		for _, value := range values {
+			params.Add(key, value)
+		}
+	}
 	log.Debug("provider zk url params:%#v", params)
 	if conf.Path == "" {
 		conf.Path = localIP
@@ -200,6 +210,35 @@ func (s *providerZookeeperRegistry) register(conf *registry.ProviderServiceConfi
 	if err != nil {
 		return jerrors.Annotatef(err, "registerTempZookeeperNode(path:%s, url:%s)", dubboPath, rawURL)
 	}
+	s.Lock()
+	s.nodes[conf.String()] = dubboPath + "/" + encodedURL
+	s.Unlock()
+
+	return nil
+}
+
+// Unregister deletes the provider node of @c, which is not registered again on zk restart
+func (s *providerZookeeperRegistry) Unregister(c interface{}) error {
+	conf, ok := c.(registry.ProviderServiceConfig)
+	if !ok {
+		return jerrors.Errorf("@c{%v} type is not registry.ProviderServiceConfig", c)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	node, ok := s.nodes[conf.String()]
+	if !ok {
+		return jerrors.Errorf("Service{%s} has not been registered", conf.String())
+	}
+	delete(s.nodes, conf.String())
+	delete(s.services, conf.String())
+	if s.client == nil {
+		return jerrors.Trace(ZK_CLIENT_CONN_NIL_ERR)
+	}
+	if err := s.client.Delete(node); err != nil {
+		return jerrors.Annotatef(err, "zkClient.Delete(node:%s)", node)
+	}
+	log.Info("unregister provider %s, zk node:%s", conf.String(), node)
 
 	return nil
 }
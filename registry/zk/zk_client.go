@@ -29,6 +29,7 @@ import (
 
 import (
 	"github.com/AlexStocks/dubbogo/common"
+	"github.com/AlexStocks/dubbogo/metrics"
 )
 
 var (
@@ -122,6 +123,9 @@ LOOP:
 		case event = <-session:
 			log.Warn("client{%s} get a zookeeper event{type:%s, server:%s, path:%s, state:%d-%s, err:%v}",
 				z.name, event.Type, event.Server, event.Path, event.State, stateToString(event.State), event.Err)
+			if event.Type == zk.EventSession {
+				metrics.ZkStateTransitions.WithLabelValues(z.name, event.State.String()).Inc()
+			}
 			switch (int)(event.State) {
 			case (int)(zk.StateDisconnected):
 				log.Warn("zk{addr:%s} state is StateDisconnected, so close the zk client{name:%s}.", z.zkAddrs, z.name)
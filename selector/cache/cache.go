@@ -27,6 +27,7 @@ import (
 
 import (
 	"github.com/AlexStocks/dubbogo/common"
+	"github.com/AlexStocks/dubbogo/metrics"
 	"github.com/AlexStocks/dubbogo/registry"
 	"github.com/AlexStocks/dubbogo/selector"
 )
@@ -35,6 +36,9 @@ var (
 	// selector每DefaultTTL分钟通过tick函数清空cache或者get函数去清空某个service的cache，
 	// 以全量获取某个service的所有providers
 	DefaultTTL = 10 * time.Minute
+	// the provider which has sent the readonly event is not selected in DefaultReadonlyTTL,
+	// unless it is registered again
+	DefaultReadonlyTTL = time.Minute
 )
 
 /*
@@ -50,9 +54,16 @@ type cacheSelector struct {
 	sync.Mutex
 	cache map[string][]*registry.ServiceURL
 	ttls  map[string]time.Time // 每个数组的创建时间
+	// readonly providers in graceful shutdown, location -> the time of the readonly event
+	readonly map[string]time.Time
+	// callbacks of the removed provider locations
+	onRemove []func(string)
 
 	// used to close or reload watcher
 	exit chan bool
+
+	// nil if the outlier detection is disabled
+	outlier *outlierDetector
 }
 
 func (c *cacheSelector) quit() bool {
@@ -126,6 +137,7 @@ func (c *cacheSelector) get(s registry.ServiceConfigIf) ([]*registry.ServiceURL,
 	// we didn't have any results so cache
 	c.cache[serviceConf.Key()] = c.copy(ss)
 	c.ttls[serviceConf.Key()] = time.Now().Add(c.ttl)
+	metrics.SelectorCacheProviders.WithLabelValues(serviceConf.Key()).Set(float64(len(ss)))
 	return ss, nil
 }
 
@@ -134,12 +146,14 @@ func (c *cacheSelector) set(service string, services []*registry.ServiceURL) {
 	if 0 < len(services) {
 		c.cache[service] = services
 		c.ttls[service] = time.Now().Add(c.ttl)
+		metrics.SelectorCacheProviders.WithLabelValues(service).Set(float64(len(services)))
 
 		return
 	}
 
 	delete(c.cache, service)
 	delete(c.ttls, service)
+	metrics.SelectorCacheProviders.DeleteLabelValues(service)
 }
 
 func filterServices(array *[]*registry.ServiceURL, i int) {
@@ -161,12 +175,19 @@ func (c *cacheSelector) update(res *registry.Result) {
 	}
 	var (
 		ok       bool
+		gone     bool
 		sname    string
 		services []*registry.ServiceURL
 	)
 
 	log.Debug("update @registry result{%s}", res)
 	sname = res.Service.ServiceConfig().Key()
+	// notify the callbacks after unlock
+	defer func() {
+		if gone {
+			c.notifyRemove(res.Service.Location)
+		}
+	}()
 	c.Lock()
 	defer c.Unlock()
 	services, ok = c.cache[sname]
@@ -183,11 +204,15 @@ func (c *cacheSelector) update(res *registry.Result) {
 	switch res.Action {
 	case registry.ServiceURLAdd, registry.ServiceURLUpdate:
 		services = append(services, res.Service)
+		delete(c.readonly, res.Service.Location)
 		log.Info("selector add serviceURL{%s}", *res.Service)
 	case registry.ServiceURLDel:
 		log.Error("selector delete serviceURL{%s}", *res.Service)
 	}
 	c.set(sname, services)
+	if res.Action == registry.ServiceURLDel {
+		gone = !c.cached(res.Service.Location)
+	}
 	//services, ok = c.cache[sname]
 	log.Debug("after update, cache.services[%s] member list size{%d}", sname, len(c.cache[sname]))
 	// if ok { // debug
@@ -273,6 +298,7 @@ func (c *cacheSelector) watch(w registry.Watcher) error {
 		if err != nil {
 			return jerrors.Trace(err)
 		}
+		metrics.SelectorWatchEvents.WithLabelValues(res.Action.String()).Inc()
 		if res.Action == registry.ServiceURLDel && !w.Valid() {
 			// consumer与registry连接中断的情况下，为了服务的稳定不删除任何provider
 			log.Warn("update @result{%s}. But its connection to registry is invalid", res)
@@ -283,11 +309,115 @@ func (c *cacheSelector) watch(w registry.Watcher) error {
 	}
 }
 
+// filter excludes the providers which are not available by Options.NodeFilter
+func (c *cacheSelector) filter(conf registry.ServiceConfigIf, services []*registry.ServiceURL) []*registry.ServiceURL {
+	var (
+		name      string
+		available []*registry.ServiceURL
+	)
+	if sc, ok := conf.(*registry.ServiceConfig); ok {
+		name = sc.Service
+	} else if sc, ok := conf.(registry.ServiceConfig); ok {
+		name = sc.Service
+	}
+
+	for _, s := range services {
+		if c.so.NodeFilter(name, s) {
+			available = append(available, s)
+		}
+	}
+	if len(available) != len(services) {
+		log.Debug("service %s has %d available providers in %d", name, len(available), len(services))
+	}
+	return available
+}
+
+// cached reports whether @location is the provider of any cached service.
+// It should be called with lock.
+func (c *cacheSelector) cached(location string) bool {
+	for _, services := range c.cache {
+		for _, s := range services {
+			if s.Location == location {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OnRemove adds @fn which is called with the location of a removed provider
+func (c *cacheSelector) OnRemove(fn func(location string)) {
+	c.Lock()
+	c.onRemove = append(c.onRemove, fn)
+	c.Unlock()
+}
+
+func (c *cacheSelector) notifyRemove(location string) {
+	c.Lock()
+	fns := c.onRemove
+	c.Unlock()
+	log.Info("provider %s is removed", location)
+	for _, fn := range fns {
+		fn(location)
+	}
+}
+
+// MarkReadonly stops selecting the provider @url which has sent the readonly event
+func (c *cacheSelector) MarkReadonly(url *registry.ServiceURL) {
+	c.Lock()
+	c.readonly[url.Location] = time.Now()
+	c.Unlock()
+}
+
+// excludeReadonly excludes the readonly providers from @services
+func (c *cacheSelector) excludeReadonly(services []*registry.ServiceURL) []*registry.ServiceURL {
+	c.Lock()
+	defer c.Unlock()
+
+	if len(c.readonly) == 0 {
+		return services
+	}
+	available := make([]*registry.ServiceURL, 0, len(services))
+	for _, s := range services {
+		if t, ok := c.readonly[s.Location]; ok {
+			if time.Since(t) < DefaultReadonlyTTL {
+				continue
+			}
+			delete(c.readonly, s.Location)
+		}
+		available = append(available, s)
+	}
+	return available
+}
+
+// Report collects the latency & error of a call to @url for the outlier detection
+func (c *cacheSelector) Report(conf registry.ServiceConfigIf, url *registry.ServiceURL, latency time.Duration, err error) {
+	if c.outlier == nil || url == nil {
+		return
+	}
+	if key, ok := serviceKey(conf); ok {
+		c.outlier.report(key, url.Location, latency, err)
+	}
+}
+
+func serviceKey(conf registry.ServiceConfigIf) (string, bool) {
+	if sc, ok := conf.(*registry.ServiceConfig); ok {
+		return sc.Key(), true
+	} else if sc, ok := conf.(registry.ServiceConfig); ok {
+		return sc.Key(), true
+	}
+	return "", false
+}
+
 func (c *cacheSelector) Options() selector.Options {
 	return c.so
 }
 
 func (c *cacheSelector) Select(service registry.ServiceConfigIf) (selector.Next, error) {
+	return c.SelectMethod(service, "", selector.SM_BEGIN)
+}
+
+func (c *cacheSelector) SelectMethod(service registry.ServiceConfigIf, method string, mode selector.Mode) (selector.Next, error) {
 	var (
 		err      error
 		services []*registry.ServiceURL
@@ -313,7 +443,32 @@ func (c *cacheSelector) Select(service registry.ServiceConfigIf) (selector.Next,
 		return nil, selector.ErrNoneAvailable
 	}
 
-	return selector.SelectorNext(c.so.Mode)(services), nil
+	services = c.excludeReadonly(services)
+	if len(services) == 0 {
+		return nil, selector.ErrNoneAvailable
+	}
+
+	if c.so.NodeFilter != nil {
+		services = c.filter(service, services)
+		if len(services) == 0 {
+			return nil, selector.ErrNoneAvailable
+		}
+	}
+
+	if c.outlier != nil {
+		if key, ok := serviceKey(service); ok {
+			services = c.outlier.filter(key, services)
+		}
+	}
+
+	if !mode.Valid() {
+		mode = selector.ParseMode(services[0].MethodParam(method, "loadbalance"))
+	}
+	if !mode.Valid() {
+		mode = c.so.Mode
+	}
+
+	return selector.SelectorNext(mode)(services), nil
 }
 
 // Close stops the watcher and destroys the cache
@@ -357,19 +512,26 @@ func NewSelector(opts ...selector.Option) selector.Selector {
 	}
 
 	ttl := DefaultTTL
+	var outlier *outlierDetector
 
 	if sopts.Context != nil {
 		if t, ok := sopts.Context.Value(common.DUBBOGO_CTX_KEY).(time.Duration); ok {
 			ttl = t
 		}
+		if conf, ok := sopts.Context.Value(outlierKey{}).(OutlierConfig); ok {
+			outlier = newOutlierDetector(conf)
+		}
 	}
 
 	c := &cacheSelector{
-		so:    sopts,
-		ttl:   ttl,
-		cache: make(map[string][]*registry.ServiceURL),
-		ttls:  make(map[string]time.Time),
-		exit:  make(chan bool),
+		so:       sopts,
+		ttl:      ttl,
+		cache:    make(map[string][]*registry.ServiceURL),
+		ttls:     make(map[string]time.Time),
+		readonly: make(map[string]time.Time),
+		exit:     make(chan bool),
+
+		outlier: outlier,
 	}
 
 	c.wg.Add(1)
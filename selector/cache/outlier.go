@@ -0,0 +1,290 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+import (
+	log "github.com/AlexStocks/log4go"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/common"
+	"github.com/AlexStocks/dubbogo/metrics"
+	"github.com/AlexStocks/dubbogo/registry"
+	"github.com/AlexStocks/dubbogo/selector"
+)
+
+const (
+	DefaultOutlierInterval      = 10 * time.Second
+	DefaultOutlierMinRequests   = 10
+	DefaultOutlierLatencyFactor = 3
+	DefaultOutlierErrorRate     = 0.5
+	DefaultBaseEjectionTime     = 30 * time.Second
+	DefaultMaxEjectionTime      = 5 * time.Minute
+	DefaultMaxEjectionPercent   = 50
+
+	// latency samples of a provider in an interval
+	outlierMaxSamples = 1024
+)
+
+// OutlierConfig of the outlier detection, its zero fields are set to the defaults.
+type OutlierConfig struct {
+	// Interval of the detection
+	Interval time.Duration
+	// a provider is detected if it has MinRequests in the interval at least
+	MinRequests int
+	// a provider is ejected if its p99 latency is larger than LatencyFactor times
+	// of the median of the p99 latencies of the other providers, or the rate of
+	// its 5xx-equivalent errors (common.IsServerError) reaches ErrorRate.
+	LatencyFactor float64
+	ErrorRate     float64
+	// the n-th ejection of a provider lasts BaseEjectionTime * 2^(n-1), which is
+	// capped at MaxEjectionTime. n decreases by one in every healthy interval.
+	BaseEjectionTime time.Duration
+	MaxEjectionTime  time.Duration
+	// MaxEjectionPercent is the max percent of the ejected providers of a service
+	MaxEjectionPercent int
+}
+
+func (c OutlierConfig) withDefaults() OutlierConfig {
+	if c.Interval <= 0 {
+		c.Interval = DefaultOutlierInterval
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = DefaultOutlierMinRequests
+	}
+	if c.LatencyFactor <= 0 {
+		c.LatencyFactor = DefaultOutlierLatencyFactor
+	}
+	if c.ErrorRate <= 0 {
+		c.ErrorRate = DefaultOutlierErrorRate
+	}
+	if c.BaseEjectionTime <= 0 {
+		c.BaseEjectionTime = DefaultBaseEjectionTime
+	}
+	if c.MaxEjectionTime <= 0 {
+		c.MaxEjectionTime = DefaultMaxEjectionTime
+	}
+	if c.MaxEjectionPercent <= 0 {
+		c.MaxEjectionPercent = DefaultMaxEjectionPercent
+	}
+	return c
+}
+
+type outlierKey struct{}
+
+// OutlierDetection enables the outlier detection of the cache selector.
+func OutlierDetection(conf OutlierConfig) selector.Option {
+	return func(o *selector.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, outlierKey{}, conf)
+	}
+}
+
+type nodeStats struct {
+	requests  int
+	errors    int
+	latencies []time.Duration // ring of the samples
+	next      int
+
+	ejections    int
+	ejectedUntil time.Time
+}
+
+func (n *nodeStats) add(latency time.Duration, err error) {
+	n.requests++
+	if common.IsServerError(err) {
+		n.errors++
+	}
+	if len(n.latencies) < outlierMaxSamples {
+		n.latencies = append(n.latencies, latency)
+		return
+	}
+	n.latencies[n.next] = latency
+	n.next = (n.next + 1) % outlierMaxSamples
+}
+
+func (n *nodeStats) p99() time.Duration {
+	l := make([]time.Duration, len(n.latencies))
+	copy(l, n.latencies)
+	sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+	return l[(len(l)*99-1)/100]
+}
+
+func (n *nodeStats) reset() {
+	n.requests, n.errors, n.next = 0, 0, 0
+	n.latencies = n.latencies[:0]
+}
+
+type serviceStats struct {
+	nodes     map[string]*nodeStats // location -> stats
+	evaluated time.Time
+}
+
+type outlierDetector struct {
+	conf OutlierConfig
+
+	sync.Mutex
+	services map[string]*serviceStats // ServiceConfig.Key() -> stats
+}
+
+func newOutlierDetector(conf OutlierConfig) *outlierDetector {
+	return &outlierDetector{
+		conf:     conf.withDefaults(),
+		services: make(map[string]*serviceStats),
+	}
+}
+
+// stats of @service, it should be called with lock
+func (d *outlierDetector) stats(service string, now time.Time) *serviceStats {
+	s, ok := d.services[service]
+	if !ok {
+		s = &serviceStats{nodes: make(map[string]*nodeStats), evaluated: now}
+		d.services[service] = s
+	}
+	return s
+}
+
+func (d *outlierDetector) report(service, location string, latency time.Duration, err error) {
+	d.Lock()
+	defer d.Unlock()
+
+	s := d.stats(service, time.Now())
+	n, ok := s.nodes[location]
+	if !ok {
+		n = &nodeStats{}
+		s.nodes[location] = n
+	}
+	n.add(latency, err)
+}
+
+// filter excludes the ejected providers of @services, and detects the outliers every interval.
+func (d *outlierDetector) filter(service string, services []*registry.ServiceURL) []*registry.ServiceURL {
+	now := time.Now()
+
+	d.Lock()
+	defer d.Unlock()
+
+	s := d.stats(service, now)
+	if d.conf.Interval <= now.Sub(s.evaluated) {
+		d.evaluate(service, s, services, now)
+	}
+
+	available := make([]*registry.ServiceURL, 0, len(services))
+	for _, url := range services {
+		if n, ok := s.nodes[url.Location]; ok && now.Before(n.ejectedUntil) {
+			continue
+		}
+		available = append(available, url)
+	}
+	if len(available) == 0 { // never eject all providers
+		return services
+	}
+	return available
+}
+
+// medianOf returns the median of @ds, the mean of the middle pair for an even count.
+func medianOf(ds []time.Duration) time.Duration {
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	if len(ds)%2 == 0 {
+		return (ds[len(ds)/2-1] + ds[len(ds)/2]) / 2
+	}
+	return ds[len(ds)/2]
+}
+
+// evaluate ejects the outliers of @services. It should be called with lock.
+func (d *outlierDetector) evaluate(service string, s *serviceStats, services []*registry.ServiceURL, now time.Time) {
+	var (
+		ejected    int
+		candidates []string
+		p99s       []time.Duration
+		nodes      = make(map[string]*nodeStats, len(services))
+	)
+
+	s.evaluated = now
+	for _, url := range services {
+		n, ok := s.nodes[url.Location]
+		if !ok {
+			continue
+		}
+		nodes[url.Location] = n
+		if now.Before(n.ejectedUntil) {
+			ejected++
+		} else if d.conf.MinRequests <= n.requests {
+			candidates = append(candidates, url.Location)
+			p99s = append(p99s, n.p99())
+		}
+	}
+	// the providers which have gone
+	for location := range s.nodes {
+		if _, ok := nodes[location]; !ok {
+			delete(s.nodes, location)
+		}
+	}
+
+	maxEjected := len(services) * d.conf.MaxEjectionPercent / 100
+	for i, location := range candidates {
+		n := nodes[location]
+		// the latency of a node is compared with the other nodes, which is also valid for 2 nodes
+		var median time.Duration
+		if 2 <= len(p99s) {
+			others := append(append([]time.Duration(nil), p99s[:i]...), p99s[i+1:]...)
+			median = medianOf(others)
+		}
+		reason := ""
+		if d.conf.ErrorRate <= float64(n.errors)/float64(n.requests) {
+			reason = "error_rate"
+		} else if 0 < median && float64(median)*d.conf.LatencyFactor < float64(p99s[i]) {
+			reason = "latency"
+		}
+
+		if len(reason) == 0 {
+			if 0 < n.ejections {
+				n.ejections--
+			}
+			continue
+		}
+		if maxEjected <= ejected {
+			log.Warn("outlier provider %s of service %s(%s, requests:%d, errors:%d, p99:%v, median:%v) "+
+				"is not ejected, because %d providers in %d have been ejected",
+				location, service, reason, n.requests, n.errors, p99s[i], median, ejected, len(services))
+			continue
+		}
+
+		n.ejections++
+		duration := d.conf.BaseEjectionTime << uint(n.ejections-1)
+		if duration <= 0 || d.conf.MaxEjectionTime < duration {
+			duration = d.conf.MaxEjectionTime
+		}
+		n.ejectedUntil = now.Add(duration)
+		ejected++
+		metrics.SelectorEjections.WithLabelValues(service, location, reason).Inc()
+		log.Warn("eject outlier provider %s of service %s for %v(%s, requests:%d, errors:%d, p99:%v, median:%v)",
+			location, service, duration, reason, n.requests, n.errors, p99s[i], median)
+	}
+
+	for _, n := range nodes {
+		n.reset()
+	}
+	metrics.SelectorEjectedProviders.WithLabelValues(service).Set(float64(ejected))
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/common"
+	"github.com/AlexStocks/dubbogo/registry"
+)
+
+const service = "com.ikurento.user.UserProvider"
+
+func locations(services []*registry.ServiceURL) []string {
+	var l []string
+	for _, s := range services {
+		l = append(l, s.Location)
+	}
+	return l
+}
+
+func TestOutlierDetector(t *testing.T) {
+	d := newOutlierDetector(OutlierConfig{
+		Interval:         time.Millisecond,
+		MinRequests:      5,
+		BaseEjectionTime: 50 * time.Millisecond,
+	})
+	var services []*registry.ServiceURL
+	for i := 0; i < 4; i++ {
+		services = append(services, &registry.ServiceURL{Location: fmt.Sprintf("127.0.0.1:%d", 20000+i)})
+	}
+	oops := errors.New("oops")
+	round := func(report func(location string)) []*registry.ServiceURL {
+		for _, s := range services {
+			for i := 0; i < 10; i++ {
+				report(s.Location)
+			}
+		}
+		time.Sleep(2 * time.Millisecond)
+		return d.filter(service, services)
+	}
+
+	// node 0 is slow, node 1 fails and node 2 returns 4xx errors
+	available := round(func(location string) {
+		switch location {
+		case services[0].Location:
+			d.report(service, location, 100*time.Millisecond, nil)
+		case services[1].Location:
+			d.report(service, location, time.Millisecond, oops)
+		case services[2].Location:
+			d.report(service, location, time.Millisecond, common.NotFound("dubbogo.client", "no such method"))
+		default:
+			d.report(service, location, time.Millisecond, nil)
+		}
+	})
+	if l := locations(available); len(l) != 2 || l[0] != services[2].Location || l[1] != services[3].Location {
+		t.Fatalf("available providers:%v", l)
+	}
+
+	// at most 50% of the providers are ejected
+	available = round(func(location string) { d.report(service, location, time.Millisecond, oops) })
+	if len(available) != 2 {
+		t.Fatalf("available providers:%v", locations(available))
+	}
+
+	// node 0 & 1 come back after the ejection time, and the second ejection lasts longer
+	time.Sleep(60 * time.Millisecond)
+	available = round(func(location string) {
+		if location == services[1].Location {
+			d.report(service, location, time.Millisecond, oops)
+		} else {
+			d.report(service, location, time.Millisecond, nil)
+		}
+	})
+	if len(available) != 3 {
+		t.Fatalf("available providers:%v", locations(available))
+	}
+	time.Sleep(60 * time.Millisecond)
+	if available = d.filter(service, services); len(available) != 3 {
+		t.Fatalf("provider %s should be ejected for 100ms, available providers:%v",
+			services[1].Location, locations(available))
+	}
+}
+
+func TestOutlierDetectorTwoProviders(t *testing.T) {
+	d := newOutlierDetector(OutlierConfig{
+		Interval:           time.Millisecond,
+		MinRequests:        5,
+		MaxEjectionPercent: 50,
+		BaseEjectionTime:   50 * time.Millisecond,
+	})
+	services := []*registry.ServiceURL{{Location: "127.0.0.1:20000"}, {Location: "127.0.0.1:20001"}}
+	for i := 0; i < 10; i++ {
+		d.report(service, services[0].Location, 100*time.Millisecond, nil)
+		d.report(service, services[1].Location, time.Millisecond, nil)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if l := locations(d.filter(service, services)); len(l) != 1 || l[0] != services[1].Location {
+		t.Errorf("available providers:%v, the slow one should be ejected", l)
+	}
+}
+
+func TestMedianOf(t *testing.T) {
+	for _, c := range []struct {
+		ds     []time.Duration
+		median time.Duration
+	}{
+		{[]time.Duration{3}, 3},
+		{[]time.Duration{4, 1}, 2},
+		{[]time.Duration{5, 1, 3}, 3},
+		{[]time.Duration{8, 1, 2, 4}, 3},
+	} {
+		if m := medianOf(c.ds); m != c.median {
+			t.Errorf("medianOf(%v) = %v, expected:%v", c.ds, m, c.median)
+		}
+	}
+}
@@ -16,6 +16,7 @@ package selector
 
 import (
 	"math/rand"
+	"strings"
 	"sync"
 	"time"
 )
@@ -82,6 +83,22 @@ var selectorModeStrings = [...]string{
 	"End",
 }
 
+func (s Mode) Valid() bool {
+	return SM_BEGIN < s && s < SM_END
+}
+
+// ParseMode returns the Mode of dubbo loadbalance @name, or SM_BEGIN if it is not supported.
+func ParseMode(name string) Mode {
+	switch strings.ToLower(name) {
+	case "random":
+		return SM_Random
+	case "roundrobin":
+		return SM_RoundRobin
+	default:
+		return SM_BEGIN
+	}
+}
+
 func (s Mode) String() string {
 	if SM_BEGIN < s && s < SM_END {
 		return selectorModeStrings[s]
@@ -26,6 +26,8 @@ import (
 type Options struct {
 	Registry registry.Registry
 	Mode     Mode // selector mode
+	// NodeFilter excludes the unavailable providers, such as breaker.Group.Available
+	NodeFilter func(service string, url *registry.ServiceURL) bool
 
 	// Other options for implementations of the interface
 	// can be stored in a context
@@ -54,3 +56,26 @@ func Context(ctx context.Context) Option {
 		o.Context = ctx
 	}
 }
+
+// NodeFilter sets the filter of providers, the providers which @f returns false are not selected.
+// The filters of multiple NodeFilter options are all applied.
+func NodeFilter(f func(service string, url *registry.ServiceURL) bool) Option {
+	return func(o *Options) {
+		if prev := o.NodeFilter; prev != nil {
+			o.NodeFilter = func(service string, url *registry.ServiceURL) bool {
+				return prev(service, url) && f(service, url)
+			}
+			return
+		}
+		o.NodeFilter = f
+	}
+}
+
+// TLSFilter is the NodeFilter which selects the providers served by tls if @secure,
+// otherwise the plaintext ones. The consumer with transport.TLSConfig selects the secure ports by
+// selector.NodeFilter(selector.TLSFilter(true)).
+func TLSFilter(secure bool) func(service string, url *registry.ServiceURL) bool {
+	return func(service string, url *registry.ServiceURL) bool {
+		return url.TLS() == secure
+	}
+}
@@ -17,6 +17,7 @@ package selector
 
 import (
 	"errors"
+	"time"
 )
 
 import (
@@ -38,6 +39,36 @@ type Selector interface {
 	String() string
 }
 
+// MethodSelector is implemented by the selector which selects the provider of a
+// method by the "loadbalance" param of the provider url.
+type MethodSelector interface {
+	// SelectMethod selects the provider of @method by @mode if it is valid, otherwise by
+	// the "<method>.loadbalance" or "loadbalance" param of the provider url, otherwise
+	// by Options.Mode.
+	SelectMethod(conf registry.ServiceConfigIf, method string, mode Mode) (Next, error)
+}
+
+// Reporter is implemented by the selector which tracks the results of calls to
+// providers, such as the outlier detection of the cache selector.
+type Reporter interface {
+	// Report the result of a call to the provider @url of @conf, which takes @latency.
+	Report(conf registry.ServiceConfigIf, url *registry.ServiceURL, latency time.Duration, err error)
+}
+
+// ReadonlyMarker is implemented by the selector which stops selecting the provider
+// which has sent the readonly event in graceful shutdown.
+type ReadonlyMarker interface {
+	// MarkReadonly marks the provider @url readonly before its registry node is deleted.
+	MarkReadonly(url *registry.ServiceURL)
+}
+
+// RemoveNotifier is implemented by the selector which notifies the locations of the
+// providers which have gone, such as the client closes their pooled connections.
+type RemoveNotifier interface {
+	// OnRemove adds @fn which is called with the location of a removed provider.
+	OnRemove(fn func(location string))
+}
+
 // Next is a function that returns the next node
 // based on the selector's strategy
 type Next func(ID int64) (*registry.ServiceURL, error)
@@ -0,0 +1,218 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/common"
+)
+
+// ACLRule of a service or a method. An entry is an ip, a CIDR such as "10.0.0.0/8", or
+// the name of a consumer application. A consumer is denied if it matches Deny, or
+// Allow is not empty and it matches no entry of Allow.
+type ACLRule struct {
+	Allow []string
+	Deny  []string
+}
+
+// ServiceACL is the acl of a service, its methods are checked by the method rules
+// after the service rule.
+type ServiceACL struct {
+	ACLRule
+	Methods map[string]ACLRule // method name -> method rule
+}
+
+// newToken generates a random token
+func newToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+type aclEntries struct {
+	nets []*net.IPNet
+	apps map[string]struct{}
+}
+
+func newACLEntries(entries []string) *aclEntries {
+	if len(entries) == 0 {
+		return nil
+	}
+	e := &aclEntries{apps: make(map[string]struct{})}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			e.nets = append(e.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		} else if _, n, err := net.ParseCIDR(entry); err == nil {
+			e.nets = append(e.nets, n)
+		} else {
+			e.apps[entry] = struct{}{}
+		}
+	}
+	return e
+}
+
+func (e *aclEntries) match(ip net.IP, app string) bool {
+	if _, ok := e.apps[app]; ok && len(app) != 0 {
+		return true
+	}
+	for _, n := range e.nets {
+		if ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type aclRule struct {
+	allow *aclEntries // nil if all are allowed
+	deny  *aclEntries
+}
+
+func newACLRule(rule ACLRule) *aclRule {
+	return &aclRule{allow: newACLEntries(rule.Allow), deny: newACLEntries(rule.Deny)}
+}
+
+func (r *aclRule) permit(ip net.IP, app string) bool {
+	if r == nil {
+		return true
+	}
+	if r.deny != nil && r.deny.match(ip, app) {
+		return false
+	}
+	return r.allow == nil || r.allow.match(ip, app)
+}
+
+type serviceAuth struct {
+	token   string
+	verify  *verifier // nil if the requests are not signed
+	service *aclRule
+	methods map[string]*aclRule
+}
+
+// authenticator checks the tokens, signatures & acls of the services before dispatch,
+// it's shared by the rpc servers.
+type authenticator map[string]*serviceAuth // service name -> auth
+
+func newAuthenticator(opts *Options) authenticator {
+	a := make(authenticator)
+	get := func(service string) *serviceAuth {
+		sa, ok := a[service]
+		if !ok {
+			sa = &serviceAuth{methods: make(map[string]*aclRule)}
+			a[service] = sa
+		}
+		return sa
+	}
+	for service, token := range opts.Tokens {
+		get(service).token = token
+	}
+	for _, conf := range opts.ServiceConfList {
+		if conf.Sign {
+			get(conf.Service).verify = newVerifier(opts.Credentials, opts.SignWindow)
+		}
+	}
+	for service, acl := range opts.ACLs {
+		sa := get(service)
+		sa.service = newACLRule(acl.ACLRule)
+		for method, rule := range acl.Methods {
+			sa.methods[method] = newACLRule(rule)
+		}
+	}
+	if len(a) == 0 {
+		return nil
+	}
+	return a
+}
+
+type remoteKey struct{}
+
+// withRemote stores the remote address of the connection in @ctx for the acl
+func withRemote(ctx context.Context, addr net.Addr) context.Context {
+	return context.WithValue(ctx, remoteKey{}, addr)
+}
+
+func remoteIP(ctx context.Context) net.IP {
+	addr, _ := ctx.Value(remoteKey{}).(net.Addr)
+	if addr == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return net.ParseIP(host)
+}
+
+// check rejects the request of @service.@method whose token or signature of the args
+// @digest is wrong, or whose consumer is denied by the acl.
+func (a authenticator) check(ctx context.Context, service, method, digest string) error {
+	sa, ok := a[service]
+	if !ok {
+		return nil
+	}
+
+	header, _ := ctx.Value(common.DUBBOGO_CTX_KEY).(map[string]string)
+	if len(sa.token) != 0 {
+		token := common.Attachment(header, common.TOKEN_KEY)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(sa.token)) != 1 {
+			return common.NewError("dubbogo.server",
+				fmt.Sprintf("invalid token of service %s", service), http.StatusUnauthorized)
+		}
+	}
+
+	if err := a.verify(header, service, method, digest); err != nil {
+		return err
+	}
+
+	ip, app := remoteIP(ctx), common.Attachment(header, common.APPLICATION_KEY)
+	if !sa.service.permit(ip, app) || !sa.methods[method].permit(ip, app) {
+		return common.NewError("dubbogo.server",
+			fmt.Sprintf("consumer{ip:%v, application:%s} is denied by the acl of %s.%s", ip, app, service, method),
+			http.StatusForbidden)
+	}
+
+	return nil
+}
+
+// verify checks the signature of a request or a stream message of @service.@method
+// whose encoded args have @digest, if the service verifies the signature.
+func (a authenticator) verify(header map[string]string, service, method, digest string) error {
+	sa, ok := a[service]
+	if !ok || sa.verify == nil {
+		return nil
+	}
+	if err := sa.verify.verify(header, service, method, digest); err != nil {
+		return common.NewError("dubbogo.server",
+			fmt.Sprintf("invalid signature of %s.%s: %v", service, method, err), http.StatusUnauthorized)
+	}
+	return nil
+}
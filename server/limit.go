@@ -0,0 +1,227 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/common"
+)
+
+const (
+	DefaultTPSInterval = time.Second
+)
+
+// LimitConfig is the limits of a service or a method, the zero value is unlimited.
+type LimitConfig struct {
+	// TPS is the max requests in TPSInterval
+	TPS         int
+	TPSInterval time.Duration
+	// Executes is the max concurrent executions
+	Executes int
+}
+
+// ServiceLimitConfig is the limits of a service and its methods. They are published
+// in the provider url as tps, tps.interval(ms), executes and <method>.tps etc.
+type ServiceLimitConfig struct {
+	LimitConfig
+	Methods map[string]LimitConfig // method name -> method limits
+}
+
+func (c LimitConfig) params(params url.Values, prefix string) {
+	if 0 < c.TPS {
+		params.Set(prefix+"tps", strconv.Itoa(c.TPS))
+		if 0 < c.TPSInterval {
+			params.Set(prefix+"tps.interval", strconv.FormatInt(int64(c.TPSInterval/time.Millisecond), 10))
+		}
+	}
+	if 0 < c.Executes {
+		params.Set(prefix+"executes", strconv.Itoa(c.Executes))
+	}
+}
+
+// Params returns the provider url params of the limits
+func (c ServiceLimitConfig) Params() url.Values {
+	params := url.Values{}
+	c.LimitConfig.params(params, "")
+	for method, conf := range c.Methods {
+		conf.params(params, method+".")
+	}
+	return params
+}
+
+// tokenBucket is refilled with tps tokens every interval smoothly
+type tokenBucket struct {
+	sync.Mutex
+	tps      float64
+	interval time.Duration
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(tps int, interval time.Duration) *tokenBucket {
+	if interval <= 0 {
+		interval = DefaultTPSInterval
+	}
+	return &tokenBucket{
+		tps:      float64(tps),
+		interval: interval,
+		tokens:   float64(tps),
+		last:     time.Now(),
+	}
+}
+
+func (b *tokenBucket) take() bool {
+	now := time.Now()
+
+	b.Lock()
+	defer b.Unlock()
+	b.tokens += b.tps * float64(now.Sub(b.last)) / float64(b.interval)
+	if b.tps < b.tokens {
+		b.tokens = b.tps
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// refund puts back the token taken by a request which is rejected by other limits
+func (b *tokenBucket) refund() {
+	b.Lock()
+	if b.tokens++; b.tps < b.tokens {
+		b.tokens = b.tps
+	}
+	b.Unlock()
+}
+
+type limit struct {
+	tps      *tokenBucket // nil if unlimited
+	executes int32        // 0 if unlimited
+	active   int32
+}
+
+func newLimit(conf LimitConfig) *limit {
+	l := &limit{executes: int32(conf.Executes)}
+	if 0 < conf.TPS {
+		l.tps = newTokenBucket(conf.TPS, conf.TPSInterval)
+	}
+	return l
+}
+
+func (l *limit) acquire() bool {
+	if l == nil || l.executes <= 0 {
+		return true
+	}
+	if l.executes < atomic.AddInt32(&l.active, 1) {
+		atomic.AddInt32(&l.active, -1)
+		return false
+	}
+	return true
+}
+
+func (l *limit) release() {
+	if l != nil && 0 < l.executes {
+		atomic.AddInt32(&l.active, -1)
+	}
+}
+
+func (l *limit) take() bool {
+	return l == nil || l.tps == nil || l.tps.take()
+}
+
+func (l *limit) refund() {
+	if l != nil && l.tps != nil {
+		l.tps.refund()
+	}
+}
+
+type serviceLimit struct {
+	service *limit
+	methods map[string]*limit
+}
+
+// limiter enforces the limits of the services, it's shared by the rpc servers.
+type limiter map[string]*serviceLimit // service name -> limits
+
+func newLimiter(confs map[string]ServiceLimitConfig) limiter {
+	if len(confs) == 0 {
+		return nil
+	}
+	l := make(limiter, len(confs))
+	for service, conf := range confs {
+		sl := &serviceLimit{
+			service: newLimit(conf.LimitConfig),
+			methods: make(map[string]*limit, len(conf.Methods)),
+		}
+		for method, mconf := range conf.Methods {
+			sl.methods[method] = newLimit(mconf)
+		}
+		l[service] = sl
+	}
+	return l
+}
+
+// acquire checks the limits of @service.@method before dispatch. @release should be
+// called after the request is done if err is nil. The rejected request takes neither
+// executions nor tps tokens of the other limits.
+func (l limiter) acquire(service, method string) (release func(), err error) {
+	sl, ok := l[service]
+	if !ok {
+		return func() {}, nil
+	}
+	ml := sl.methods[method]
+
+	if !sl.service.acquire() {
+		return nil, common.NewError("dubbogo.server",
+			fmt.Sprintf("service %s exceeds its max concurrent executions %d", service, sl.service.executes),
+			http.StatusServiceUnavailable)
+	}
+	if !ml.acquire() {
+		sl.service.release()
+		return nil, common.NewError("dubbogo.server",
+			fmt.Sprintf("method %s.%s exceeds its max concurrent executions %d", service, method, ml.executes),
+			http.StatusServiceUnavailable)
+	}
+	release = func() {
+		ml.release()
+		sl.service.release()
+	}
+
+	if !sl.service.take() {
+		release()
+		return nil, common.NewError("dubbogo.server",
+			fmt.Sprintf("service %s exceeds its max tps %v", service, sl.service.tps.tps),
+			http.StatusTooManyRequests)
+	}
+	if !ml.take() {
+		sl.service.refund()
+		release()
+		return nil, common.NewError("dubbogo.server",
+			fmt.Sprintf("method %s.%s exceeds its max tps %v", service, method, ml.tps.tps),
+			http.StatusTooManyRequests)
+	}
+	return release, nil
+}
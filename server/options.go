@@ -17,6 +17,12 @@ package server
 
 import (
 	"context"
+	"time"
+)
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 import (
@@ -33,14 +39,44 @@ type Options struct {
 
 	ConfList        []registry.ServerConfig
 	ServiceConfList []registry.ServiceConfig
+	// Filters run in order around every handler call
+	Filters []Filter
+	// Limits of the services, service name -> limits
+	Limits map[string]ServiceLimitConfig
+	// Tokens of the services, service name -> token. The token is published in the
+	// provider url, and the requests without it are rejected.
+	Tokens map[string]string
+	// ACLs of the services, service name -> acl
+	ACLs map[string]ServiceACL
+	// Credentials are the secret keys of the access keys of the signed requests, whose
+	// services are registry.ServiceConfig.Sign.
+	Credentials CredentialStore
+	// SignWindow is the max difference between the timestamp of a signed request and
+	// the server time, the older requests are rejected as replays.
+	SignWindow time.Duration
+	// TracerProvider creates the spans of handler calls, the default is the global one of otel
+	TracerProvider trace.TracerProvider
+	// GracePeriod is the wait after the providers are unregistered at Stop, which
+	// should be long enough for the consumers to notice the registry changes.
+	GracePeriod time.Duration
+	// ShutdownTimeout is the max wait for the in-flight requests at Stop
+	ShutdownTimeout time.Duration
 	// Other options for implementations of the interface
 	// can be stored in a context
 	Context context.Context
 }
 
+const (
+	DefaultShutdownTimeout = 10 * time.Second
+	DefaultSignWindow      = 5 * time.Minute
+)
+
 func newOptions(opt ...Option) Options {
 	opts := Options{
-		Codecs: make(map[string]codec.NewCodec),
+		Codecs:          make(map[string]codec.NewCodec),
+		TracerProvider:  otel.GetTracerProvider(),
+		ShutdownTimeout: DefaultShutdownTimeout,
+		SignWindow:      DefaultSignWindow,
 	}
 
 	for _, o := range opt {
@@ -93,3 +129,78 @@ func ServiceConfList(confList []registry.ServiceConfig) Option {
 		o.ServiceConfList = confList
 	}
 }
+
+// Filters appends @filters to the server filter chain. The first filter is the outermost.
+func Filters(filters ...Filter) Option {
+	return func(o *Options) {
+		o.Filters = append(o.Filters, filters...)
+	}
+}
+
+// Token sets the token of @service. A random token is generated if @token is "true".
+func Token(service string, token string) Option {
+	return func(o *Options) {
+		if o.Tokens == nil {
+			o.Tokens = make(map[string]string)
+		}
+		if token == "true" {
+			token = newToken()
+		}
+		o.Tokens[service] = token
+	}
+}
+
+// ACL sets the allow & deny lists of the consumers of @service and its methods
+func ACL(service string, acl ServiceACL) Option {
+	return func(o *Options) {
+		if o.ACLs == nil {
+			o.ACLs = make(map[string]ServiceACL)
+		}
+		o.ACLs[service] = acl
+	}
+}
+
+// Credentials sets the store of the secret keys of the signed requests
+func Credentials(store CredentialStore) Option {
+	return func(o *Options) {
+		o.Credentials = store
+	}
+}
+
+// SignWindow sets the max age of the signed requests
+func SignWindow(d time.Duration) Option {
+	return func(o *Options) {
+		o.SignWindow = d
+	}
+}
+
+// Limits sets the tps & executes limits of @service and its methods
+func Limits(service string, conf ServiceLimitConfig) Option {
+	return func(o *Options) {
+		if o.Limits == nil {
+			o.Limits = make(map[string]ServiceLimitConfig)
+		}
+		o.Limits[service] = conf
+	}
+}
+
+// TracerProvider sets the provider of server spans, such as sdktrace.NewTracerProvider(...)
+func TracerProvider(tp trace.TracerProvider) Option {
+	return func(o *Options) {
+		o.TracerProvider = tp
+	}
+}
+
+// GracePeriod sets the wait after the providers are unregistered at Stop
+func GracePeriod(d time.Duration) Option {
+	return func(o *Options) {
+		o.GracePeriod = d
+	}
+}
+
+// ShutdownTimeout sets the max wait for the in-flight requests at Stop
+func ShutdownTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.ShutdownTimeout = d
+	}
+}
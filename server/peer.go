@@ -0,0 +1,63 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/x509"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/transport"
+)
+
+type peerKey struct{}
+
+// Peer is the identity of the mtls client, whose certificate has been verified.
+type Peer struct {
+	CommonName  string
+	DNSNames    []string
+	URIs        []string // such as the SPIFFE ID
+	Certificate *x509.Certificate
+}
+
+// PeerFromContext returns the identity of the mtls client of the request in @ctx
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(*Peer)
+	return p, ok
+}
+
+// withPeer stores the identity of the verified client certificate of @sock in @ctx
+func withPeer(ctx context.Context, sock transport.Socket) context.Context {
+	s, ok := sock.(transport.SecureSocket)
+	if !ok {
+		return ctx
+	}
+	state := s.ConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ctx
+	}
+
+	cert := state.VerifiedChains[0][0]
+	p := &Peer{
+		CommonName:  cert.Subject.CommonName,
+		DNSNames:    cert.DNSNames,
+		Certificate: cert,
+	}
+	for _, u := range cert.URIs {
+		p.URIs = append(p.URIs, u.String())
+	}
+	return context.WithValue(ctx, peerKey{}, p)
+}
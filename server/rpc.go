@@ -77,6 +77,14 @@ type Streamer interface {
 
 type Option func(*Options)
 
+// HandlerFunc invokes the handler method of @req. @rsp is the reply of a unary
+// call, or the Streamer of a stream call.
+type HandlerFunc func(ctx context.Context, req Request, rsp interface{}) error
+
+// Filter runs around every handler call, such as access log, auth, rate limit,
+// metrics & panic recovery. It should call @next to go on with the call.
+type Filter func(ctx context.Context, req Request, rsp interface{}, next HandlerFunc) error
+
 func NewServer(opts ...Option) Server {
 	return newServer(opts...)
 }
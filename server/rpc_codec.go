@@ -28,6 +28,9 @@ import (
 import (
 	"github.com/AlexStocks/dubbogo/codec"
 	"github.com/AlexStocks/dubbogo/codec/jsonrpc"
+	"github.com/AlexStocks/dubbogo/codec/protobuf"
+	"github.com/AlexStocks/dubbogo/codec/thrift"
+	"github.com/AlexStocks/dubbogo/codec/triple"
 	"github.com/AlexStocks/dubbogo/transport"
 )
 
@@ -46,8 +49,20 @@ type readWriteCloser struct {
 
 var (
 	defaultCodecs = map[string]codec.NewCodec{
-		"application/json":     jsonrpc.NewCodec,
-		"application/json-rpc": jsonrpc.NewCodec,
+		"application/json":       jsonrpc.NewCodec,
+		"application/json-rpc":   jsonrpc.NewCodec,
+		"application/x-protobuf": protobuf.NewCodec,
+		"application/x-thrift":   thrift.NewCodec,
+		"application/grpc":       triple.NewCodec,
+		"application/grpc+proto": triple.NewCodec,
+	}
+
+	// tcp package has no Content-Type header, so its codec is chosen by the server protocol
+	protocol2ContentType = map[string]string{
+		"jsonrpc":  "application/json",
+		"protobuf": "application/x-protobuf",
+		"thrift":   "application/x-thrift",
+		"tri":      "application/grpc+proto",
 	}
 )
 
@@ -80,9 +95,11 @@ func newRPCCodec(req *transport.Package, socket transport.Socket, c codec.NewCod
 }
 
 func (c *rpcCodec) ReadRequestHeader(r *request, first bool) error {
+	c.buf.wbuf.Reset()
 	m := codec.Message{Header: c.pkg.Header}
 
-	if !first {
+	// a codec may leave the first request of a stream in the buffer, such as triple
+	if !first && c.buf.rbuf.Len() == 0 && !c.buffered() {
 		var tp transport.Package
 		// transport.Socket.Recv
 		if err := c.socket.Recv(&tp); err != nil {
@@ -97,9 +114,27 @@ func (c *rpcCodec) ReadRequestHeader(r *request, first bool) error {
 	}
 
 	err := c.codec.ReadHeader(&m, codec.Request)
+	// tcp stream may deliver a request in several packages
+	for err == codec.ErrHeaderNotEnough {
+		var tp transport.Package
+		if err = c.socket.Recv(&tp); err != nil {
+			return err
+		}
+		c.buf.rbuf.Write(tp.Body)
+		err = c.codec.ReadHeader(&m, codec.Request)
+	}
 	r.Service = m.Target
 	r.Method = m.Method
 	r.Seq = m.ID
+	r.Header = m.Header
+	r.ArgsDigest = m.ArgsDigest
+	if err != nil && c.buf.wbuf.Len() != 0 {
+		// the codec has written an error response, such as jsonrpc parse error
+		c.socket.Send(&transport.Package{
+			Header: map[string]string{"Content-Type": c.pkg.Header["Content-Type"]},
+			Body:   c.buf.wbuf.Bytes(),
+		})
+	}
 	return err
 }
 
@@ -121,6 +156,11 @@ func (c *rpcCodec) WriteResponse(r *response, body interface{}, last bool) error
 		return err
 	}
 
+	// the responses of a batch are sent together after its last request
+	if c.buf.wbuf.Len() == 0 && c.More() {
+		return nil
+	}
+
 	m.Header["Content-Type"] = c.pkg.Header["Content-Type"]
 	return c.socket.Send(&transport.Package{
 		Header: m.Header,
@@ -128,6 +168,22 @@ func (c *rpcCodec) WriteResponse(r *response, body interface{}, last bool) error
 	})
 }
 
+// More reports whether there are requests of the current package left.
+func (c *rpcCodec) More() bool {
+	if b, ok := c.codec.(codec.Batcher); ok {
+		return b.More()
+	}
+	return false
+}
+
+// buffered reports whether the codec has read ahead the messages of a stream
+func (c *rpcCodec) buffered() bool {
+	if b, ok := c.codec.(codec.Buffer); ok {
+		return b.Buffered()
+	}
+	return false
+}
+
 func (c *rpcCodec) Close() error {
 	c.buf.Close()
 	c.codec.Close()
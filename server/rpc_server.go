@@ -24,6 +24,7 @@ import (
 	"io"
 	"reflect"
 	"sync"
+	"time"
 	"unicode"
 	"unicode/utf8"
 )
@@ -31,10 +32,13 @@ import (
 import (
 	log "github.com/AlexStocks/log4go"
 	jerrors "github.com/juju/errors"
+	"go.opentelemetry.io/otel/trace"
 )
 
 import (
+	"github.com/AlexStocks/dubbogo/codec"
 	"github.com/AlexStocks/dubbogo/common"
+	"github.com/AlexStocks/dubbogo/metrics"
 	"github.com/AlexStocks/dubbogo/transport"
 )
 
@@ -107,7 +111,10 @@ func (r *rpcRequest) Stream() bool {
 type request struct {
 	Service string
 	Method  string
-	Seq     int64 // sequence number chosen by client
+	Seq     int64             // sequence number chosen by client
+	Header  map[string]string // attachments decoded by the codec, such as the token
+	// digest of the encoded args, whose signature is verified
+	ArgsDigest string
 }
 
 type response struct {
@@ -119,8 +126,17 @@ type response struct {
 
 // server represents an RPC Server.
 type rpcServer struct {
-	mu         sync.Mutex          // protects the serviceMap
-	serviceMap map[string]*service // service name -> service
+	protocol   string                              // registry.ServerConfig.Protocol
+	filters    []Filter                            // Options.Filters
+	tracer     trace.Tracer                        // Options.TracerProvider
+	limiter    limiter                             // Options.Limits
+	auth       authenticator                       // Options.Tokens & Options.ACLs
+	accepts    int32                               // registry.ServerConfig.Accepts
+	pending    int32                               // in-flight requests
+	socksLock  sync.Mutex                          // protects the socks
+	socks      map[transport.Socket]codec.NewCodec // open sockets & the codecs of their events
+	mu         sync.Mutex                          // protects the serviceMap
+	serviceMap map[string]*service                 // service name -> service
 	freeReq    chan *request
 	freeRsp    chan *response
 	listener   transport.Listener
@@ -133,6 +149,7 @@ const (
 func initServer() *rpcServer {
 	return &rpcServer{
 		serviceMap: make(map[string]*service),
+		socks:      make(map[transport.Socket]codec.NewCodec),
 		freeReq:    make(chan *request, FREE_LIST_SIZE),
 		freeRsp:    make(chan *response, FREE_LIST_SIZE),
 	}
@@ -323,6 +340,29 @@ func (s *service) call(ctx context.Context, server *rpcServer, sending *sync.Mut
 		contentType: ct,
 	}
 
+	start := time.Now()
+	ctx, span := server.startSpan(ctx, r)
+	defer func() {
+		endSpan(span, err)
+		metrics.ObserveServer(r.service, r.method, start, err)
+	}()
+
+	if err = server.auth.check(ctx, r.service, r.method, req.ArgsDigest); err != nil {
+		log.Warn("rpc: reject request{service:%s, method:%s}: %v", r.service, r.method, err)
+		server.sendResponse(sending, req, nil, codec, err.Error(), true)
+		server.freeRequest(req)
+		return
+	}
+
+	release, err := server.limiter.acquire(r.service, r.method)
+	if err != nil {
+		log.Warn("rpc: reject request{service:%s, method:%s}: %v", r.service, r.method, err)
+		server.sendResponse(sending, req, nil, codec, err.Error(), true)
+		server.freeRequest(req)
+		return
+	}
+	defer release()
+
 	// http之类的短连接请求
 	if !mtype.stream {
 		r.request = argv.Interface()
@@ -339,7 +379,7 @@ func (s *service) call(ctx context.Context, server *rpcServer, sending *sync.Mut
 		}
 
 		errmsg = ""
-		err = fn(ctx, r, replyv.Interface()) // 调用相关的函数
+		err = server.chain(fn)(ctx, r, replyv.Interface()) // 调用相关的函数
 		if err != nil {
 			errmsg = err.Error()
 		}
@@ -359,6 +399,9 @@ func (s *service) call(ctx context.Context, server *rpcServer, sending *sync.Mut
 		codec:   codec,
 		request: r,
 		seq:     req.Seq,
+		auth:    server.auth,
+
+		signature: common.Attachment(req.Header, common.SIGNATURE_KEY),
 	}
 
 	// Invoke the method, providing a new value for the reply.
@@ -367,20 +410,17 @@ func (s *service) call(ctx context.Context, server *rpcServer, sending *sync.Mut
 		if err := returnValues[0].Interface(); err != nil {
 			// the function returned an error, we use that
 			return err.(error)
-		} else if lastError != nil {
-			// we had an error inside sendReply, we use that
-			return lastError
-		} else {
-			// no error, we send the special EOS error
-			return lastStreamResponseError
 		}
+		// we had an error inside sendReply, we use that
+		return lastError
 	}
 
 	// client.Stream request
 	r.stream = true
 
-	errmsg = ""
-	if err = fn(ctx, r, stream); err != nil {
+	// no error, we send the special EOS error
+	errmsg = lastStreamResponseError.Error()
+	if err = server.chain(fn)(ctx, r, stream); err != nil {
 		errmsg = err.Error()
 	}
 
@@ -391,6 +431,17 @@ func (s *service) call(ctx context.Context, server *rpcServer, sending *sync.Mut
 	server.freeRequest(req)
 }
 
+// chain wraps @fn with the server filters, the first filter is the outermost.
+func (server *rpcServer) chain(fn HandlerFunc) HandlerFunc {
+	for i := len(server.filters) - 1; i >= 0; i-- {
+		filter, next := server.filters[i], fn
+		fn = func(ctx context.Context, req Request, rsp interface{}) error {
+			return filter(ctx, req, rsp, next)
+		}
+	}
+	return fn
+}
+
 func (m *methodType) prepareContext(ctx context.Context) reflect.Value {
 	if contextv := reflect.ValueOf(ctx); contextv.IsValid() {
 		return contextv
@@ -399,6 +450,16 @@ func (m *methodType) prepareContext(ctx context.Context) reflect.Value {
 }
 
 func (server *rpcServer) serveRequest(ctx context.Context, codec serverCodec, ct string) error {
+	for {
+		err := server.serveOneRequest(ctx, codec, ct)
+		// the error of a request in a batch has been replied in the batch response
+		if !codec.More() {
+			return err
+		}
+	}
+}
+
+func (server *rpcServer) serveOneRequest(ctx context.Context, codec serverCodec, ct string) error {
 	sending := new(sync.Mutex)
 	service, mtype, req, argv, replyv, keepReading, err := server.readRequest(codec)
 	if err != nil {
@@ -415,7 +476,7 @@ func (server *rpcServer) serveRequest(ctx context.Context, codec serverCodec, ct
 		}
 		return err
 	}
-	service.call(ctx, server, sending, mtype, req, argv, replyv, codec, ct)
+	service.call(withAttachments(ctx, req.Header), server, sending, mtype, req, argv, replyv, codec, ct)
 	return nil
 }
 
@@ -531,6 +592,16 @@ func (server *rpcServer) readRequestHeader(codec serverCodec) (service *service,
 	// We read the header successfully. If we see an error now,
 	// we can still recover and move on to the next request.
 	keepReading = true
+	if req.Service == "" && req.Method != "" {
+		// a plain thrift request has no service name
+		server.mu.Lock()
+		if len(server.serviceMap) == 1 {
+			for name := range server.serviceMap {
+				req.Service = name
+			}
+		}
+		server.mu.Unlock()
+	}
 	if req.Service == "" || req.Method == "" {
 		err = jerrors.New("rpc: service/method request ill-formed: " + req.Service + "/" + req.Method)
 		return
@@ -556,6 +627,8 @@ type serverCodec interface { // 这个interface的函数列表是dubbogo.codec.C
 	ReadRequestHeader(*request, bool) error
 	ReadRequestBody(interface{}) error
 	WriteResponse(*response, interface{}, bool) error
+	// More reports whether there are requests of a batch left
+	More() bool
 
 	Close() error
 }
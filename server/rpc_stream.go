@@ -23,6 +23,10 @@ import (
 	"sync"
 )
 
+import (
+	"github.com/AlexStocks/dubbogo/common"
+)
+
 // Implements the Streamer interface
 type rpcStream struct {
 	sync.RWMutex
@@ -32,6 +36,9 @@ type rpcStream struct {
 	request Request
 	codec   serverCodec
 	context context.Context
+	auth    authenticator
+	// signature of the request, which the messages of a http/2 stream share
+	signature string
 }
 
 func (r *rpcStream) Context() context.Context {
@@ -77,6 +84,15 @@ func (r *rpcStream) Recv(msg interface{}) error {
 	// we need to stay up to date with sequence numbers
 	r.seq = req.Seq
 
+	// every dubbo frame is signed, while the messages of a http/2 stream share
+	// the signature in the headers of the stream, which has been verified
+	if common.Attachment(req.Header, common.SIGNATURE_KEY) != r.signature {
+		if err := r.auth.verify(req.Header, r.request.Service(), r.request.Method(), req.ArgsDigest); err != nil {
+			r.codec.ReadRequestBody(nil)
+			return err
+		}
+	}
+
 	if err := r.codec.ReadRequestBody(msg); err != nil {
 		return err
 	}
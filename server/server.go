@@ -20,6 +20,7 @@ import (
 	"runtime/debug"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -37,14 +38,17 @@ import (
 
 // 完成注册任务
 type server struct {
-	rpc  []*rpcServer // 处理外部请求,改为数组形式,以监听多个地址
-	done chan struct{}
-	once sync.Once
+	rpc      []*rpcServer // 处理外部请求,改为数组形式,以监听多个地址
+	done     chan struct{}
+	once     sync.Once
+	deadline time.Time // deadline of the shutdown, which is set before done is closed
+	readonly int32     // set at Stop, the responses carry the readonly event since then
 
 	sync.RWMutex
-	opts     Options            // codec,transport,registry
-	handlers map[string]Handler // interface -> Handler
-	wg       sync.WaitGroup
+	opts       Options            // codec,transport,registry
+	handlers   map[string]Handler // interface -> Handler
+	registered []registry.ProviderServiceConfig
+	wg         sync.WaitGroup
 }
 
 func newServer(opts ...Option) Server {
@@ -53,9 +57,17 @@ func newServer(opts ...Option) Server {
 	)
 	options := newOptions(opts...)
 	servers := make([]*rpcServer, len(options.ConfList))
+	limiter := newLimiter(options.Limits)
+	auth := newAuthenticator(&options)
 	num = len(options.ConfList)
 	for i := 0; i < num; i++ {
 		servers[i] = initServer()
+		servers[i].protocol = options.ConfList[i].Protocol
+		servers[i].limiter = limiter
+		servers[i].auth = auth
+		servers[i].accepts = int32(options.ConfList[i].Accepts)
+		servers[i].filters = options.Filters
+		servers[i].tracer = options.TracerProvider.Tracer(common.TRACER_NAME)
 	}
 	return &server{
 		opts:     options,
@@ -105,6 +117,9 @@ func (s *server) handlePkg(servo interface{}, sock transport.Socket) {
 		// 下面的所有逻辑都是处理请求包，并回复response
 		// we use s Content-Type header to identify the codec needed
 		contentType = pkg.Header["Content-Type"]
+		if len(contentType) == 0 {
+			contentType = protocol2ContentType[rpc.protocol]
+		}
 
 		// codec of jsonrpc & other type etc
 		codecFunc, err = s.newCodec(contentType)
@@ -118,9 +133,14 @@ func (s *server) handlePkg(servo interface{}, sock transport.Socket) {
 			return
 		}
 
+		// the tcp package has no header, whose codec frames the events at shutdown
+		if len(pkg.Header) == 0 {
+			rpc.setEventCodec(sock, codecFunc)
+		}
+
 		// !!!! 雷同于consumer/rpc_client中那个关键的一句，把github.com/AlexStocks/dubbogo/transport & github.com/AlexStocks/dubbogo/codec结合了起来
 		// newRPCCodec(*transport.Message, transport.Socket, codec.NewCodec)
-		codec = newRPCCodec(&pkg, sock, codecFunc)
+		codec = newRPCCodec(&pkg, &eventSocket{Socket: sock, readonly: &s.readonly}, codecFunc)
 
 		// strip our headers
 		header = make(map[string]string)
@@ -132,6 +152,12 @@ func (s *server) handlePkg(servo interface{}, sock transport.Socket) {
 
 		// ctx = metadata.NewContext(context.Background(), header)
 		ctx = context.WithValue(context.Background(), common.DUBBOGO_CTX_KEY, header)
+		// the identity of the mtls client
+		ctx = withPeer(ctx, sock)
+		// the remote address for the acl
+		ctx = withRemote(ctx, sock.RemoteAddr())
+		// the trace context of the caller in the http header
+		ctx = common.TracePropagator.Extract(ctx, common.TraceCarrier(pkg.Header))
 		// we use s Timeout header to set a server deadline
 		if len(pkg.Header["Timeout"]) > 0 {
 			if timeout, err = strconv.ParseUint(pkg.Header["Timeout"], 10, 64); err == nil {
@@ -139,11 +165,46 @@ func (s *server) handlePkg(servo interface{}, sock transport.Socket) {
 			}
 		}
 
-		if err = rpc.serveRequest(ctx, codec, contentType); err != nil {
+		atomic.AddInt32(&rpc.pending, 1)
+		err = rpc.serveRequest(ctx, codec, contentType)
+		atomic.AddInt32(&rpc.pending, -1)
+		if err != nil {
 			log.Info("Unexpected error serving request, closing socket: %v", err)
 			return
 		}
+
+		// the connection is closed after its request at shutdown
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+	}
+}
+
+// withAttachments merges the dubbo attachments of a request decoded by the codec into the
+// header of @ctx, because the tcp package has no header. The trace context of the caller
+// is extracted from them too.
+func withAttachments(ctx context.Context, attachments map[string]string) context.Context {
+	if len(attachments) == 0 {
+		return ctx
+	}
+
+	header := make(map[string]string)
+	if h, ok := ctx.Value(common.DUBBOGO_CTX_KEY).(map[string]string); ok {
+		for key, value := range h {
+			header[key] = value
+		}
+	}
+	for key, value := range attachments {
+		header[key] = value
 	}
+	// strip our headers
+	delete(header, "Content-Type")
+	delete(header, "Timeout")
+
+	ctx = context.WithValue(ctx, common.DUBBOGO_CTX_KEY, header)
+	return common.TracePropagator.Extract(ctx, common.TraceCarrier(attachments))
 }
 
 func (s *server) newCodec(contentType string) (codec.NewCodec, error) {
@@ -221,6 +282,7 @@ func (s *server) Handle(h Handler) error {
 
 			serviceConf.Protocol = config.ServiceConfList[i].Protocol
 			serviceConf.Group = config.ServiceConfList[i].Group
+			serviceConf.Sign = config.ServiceConfList[i].Sign
 			// serviceConf.Version = config.ServiceConfList[i].Version
 			for j = 0; j < serverNum; j++ {
 				if config.ConfList[j].Protocol == serviceConf.Protocol {
@@ -232,10 +294,26 @@ func (s *server) Handle(h Handler) error {
 					}
 
 					serviceConf.Path = config.ConfList[j].Address()
+					serviceConf.Params = config.Limits[serviceConf.Service].Params()
+					if 0 < config.ConfList[j].Accepts {
+						serviceConf.Params.Set("accepts", strconv.Itoa(config.ConfList[j].Accepts))
+					}
+					if token := config.Tokens[serviceConf.Service]; len(token) != 0 {
+						serviceConf.Params.Set(common.TOKEN_KEY, token)
+					}
+					if serviceConf.Sign {
+						serviceConf.Params.Set(common.SIGN_KEY, "true")
+					}
+					if config.Transport.Options().TLSConfig != nil {
+						serviceConf.Params.Set("tls", "true")
+					}
 					err = config.Registry.Register(serviceConf)
 					if err != nil {
 						return err
 					}
+					s.Lock()
+					s.registered = append(s.registered, serviceConf)
+					s.Unlock()
 					flag = 1
 				}
 			}
@@ -279,18 +357,23 @@ func (s *server) Start() error {
 
 		s.wg.Add(1)
 		go func(servo *rpcServer) {
-			listener.Accept(func(sock transport.Socket) { s.handlePkg(rpc, sock) })
+			listener.Accept(func(sock transport.Socket) {
+				defer servo.removeSocket(sock)
+				if conns := servo.addSocket(sock); 0 < servo.accepts && servo.accepts < conns {
+					log.Warn("reject connection{local:%v, remote:%v}, because the server has %d connections",
+						sock.LocalAddr(), sock.RemoteAddr(), servo.accepts)
+					sock.Close()
+					return
+				}
+				s.handlePkg(servo, sock)
+			})
 			s.wg.Done()
 		}(rpc)
 
 		s.wg.Add(1)
 		go func(servo *rpcServer) { // server done goroutine
-			var err error
-			<-s.done                     // step1: block to wait for done channel(wait server.Stop step2)
-			err = servo.listener.Close() // step2: and then close listener
-			if err != nil {
-				log.Warn("listener{addr:%s}.Close() = error{%#v}", servo.listener.Addr(), err)
-			}
+			<-s.done                        // step1: block to wait for done channel(wait server.Stop step2)
+			servo.closeListener(s.deadline) // step2: and then close listener
 			s.wg.Done()
 		}(rpc)
 	}
@@ -298,10 +381,32 @@ func (s *server) Start() error {
 	return nil
 }
 
+// Stop shuts the server down gracefully:
+// step1: send the readonly event, unregister the providers, and wait Options.GracePeriod;
+// step2: close the listeners to stop accepting connections;
+// step3: wait for the in-flight requests until Options.ShutdownTimeout;
+// step4: close the open connections and the registry.
 func (s *server) Stop() {
 	s.once.Do(func() {
+		atomic.StoreInt32(&s.readonly, 1)
+		for _, rpc := range s.rpc {
+			rpc.sendEvent(common.READONLY_EVENT)
+		}
+		s.unregister()
+		if 0 < s.opts.GracePeriod {
+			log.Info("wait %v for the consumers to notice the unregistered providers", s.opts.GracePeriod)
+			time.Sleep(s.opts.GracePeriod)
+		}
+
+		s.deadline = time.Now().Add(s.opts.ShutdownTimeout)
 		close(s.done)
 		s.wg.Wait()
+		for _, rpc := range s.rpc {
+			if n := rpc.drain(s.deadline); 0 < n {
+				log.Warn("server{protocol:%s} shuts down with %d in-flight requests", rpc.protocol, n)
+			}
+			rpc.closeSockets()
+		}
 		if s.opts.Registry != nil {
 			s.opts.Registry.Close()
 			s.opts.Registry = nil
@@ -309,6 +414,23 @@ func (s *server) Stop() {
 	})
 }
 
+// unregister deletes the providers of the server from the registry
+func (s *server) unregister() {
+	r, ok := s.opts.Registry.(registry.Unregisterer)
+	if !ok {
+		return
+	}
+
+	s.RLock()
+	registered := s.registered
+	s.RUnlock()
+	for _, conf := range registered {
+		if err := r.Unregister(conf); err != nil {
+			log.Warn("registry.Unregister(conf:%s) = error{%v}", conf, jerrors.ErrorStack(err))
+		}
+	}
+}
+
 func (s *server) String() string {
 	return "dubbogo-server"
 }
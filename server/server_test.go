@@ -0,0 +1,1093 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/client"
+	"github.com/AlexStocks/dubbogo/codec"
+	"github.com/AlexStocks/dubbogo/codec/jsonrpc"
+	"github.com/AlexStocks/dubbogo/codec/protobuf"
+	"github.com/AlexStocks/dubbogo/codec/triple"
+	"github.com/AlexStocks/dubbogo/common"
+	"github.com/AlexStocks/dubbogo/registry"
+	"github.com/AlexStocks/dubbogo/selector"
+	"github.com/AlexStocks/dubbogo/transport"
+)
+
+type testRegistry struct{}
+
+func (r *testRegistry) Register(conf interface{}) error { return nil }
+func (r *testRegistry) GetServices(registry.ServiceConfigIf) ([]*registry.ServiceURL, error) {
+	return nil, nil
+}
+func (r *testRegistry) Watch() (registry.Watcher, error) { return nil, nil }
+func (r *testRegistry) Close()                           {}
+func (r *testRegistry) String() string                   { return "test-registry" }
+
+type Greeter struct{}
+
+func (g *Greeter) Service() string { return "grpc.testing.Greeter" }
+func (g *Greeter) Version() string { return "" }
+
+func (g *Greeter) SayHello(ctx context.Context, req *wrapperspb.StringValue, rsp *wrapperspb.StringValue) error {
+	if req.GetValue() == "" {
+		return jerrors.New("empty name")
+	}
+	rsp.Value = "hello " + req.GetValue()
+	return nil
+}
+
+// server streaming
+func (g *Greeter) Count(ctx context.Context, stream Streamer) error {
+	var n wrapperspb.Int32Value
+	if err := stream.Recv(&n); err != nil {
+		return err
+	}
+	for i := int32(0); i < n.GetValue(); i++ {
+		if err := stream.Send(wrapperspb.Int32(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startServer(t *testing.T, tr transport.Transport, protocol, service string, handler Handler, opts ...Option) (*server, string) {
+	s := newServer(append([]Option{
+		Registry(&testRegistry{}),
+		Transport(tr),
+		ConfList([]registry.ServerConfig{{Protocol: protocol, IP: "127.0.0.1", Port: 0}}),
+		ServiceConfList([]registry.ServiceConfig{{Protocol: protocol, Service: service}}),
+	}, opts...)...).(*server)
+	if err := s.Handle(handler); err != nil {
+		t.Fatalf("Handle() = %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+
+	return s, s.rpc[0].listener.Addr()
+}
+
+func startTripleServer(t *testing.T) (*server, string) {
+	return startServer(t, transport.NewHTTP2Transport(), "tri", "grpc.testing.Greeter", &Greeter{})
+}
+
+func tripleCall(c transport.Client, method string, arg, rsp proto.Message) error {
+	var (
+		err error
+		buf bytes.Buffer
+		p   transport.Package
+	)
+
+	cc := triple.NewCodec(&readWriteCloser{wbuf: &buf, rbuf: &buf})
+	m := codec.Message{Type: codec.Request, Target: "grpc.testing.Greeter", Method: method, Timeout: time.Second}
+	if err = cc.Write(&m, arg); err != nil {
+		return err
+	}
+	if err = c.Send(&transport.Package{Header: m.Header, Body: buf.Bytes()}); err != nil {
+		return err
+	}
+
+	buf.Reset()
+	if err = c.Recv(&p); err != nil {
+		return err
+	}
+	buf.Write(p.Body)
+	m = codec.Message{Header: p.Header}
+	if err = cc.ReadHeader(&m, codec.Response); err != nil {
+		return err
+	}
+	if m.Error != "" {
+		return jerrors.New(m.Error)
+	}
+	return cc.ReadBody(rsp)
+}
+
+func TestTripleUnary(t *testing.T) {
+	s, addr := startTripleServer(t)
+	defer s.Stop()
+
+	c, err := transport.NewHTTP2Transport().Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial(%s) = %v", addr, err)
+	}
+	defer c.Close()
+
+	var rsp wrapperspb.StringValue
+	if err = tripleCall(c, "SayHello", wrapperspb.String("dubbogo"), &rsp); err != nil || rsp.GetValue() != "hello dubbogo" {
+		t.Errorf("SayHello() = %v, rsp:%q", err, rsp.GetValue())
+	}
+
+	// service error & unknown method share the connection
+	if err = tripleCall(c, "SayHello", wrapperspb.String(""), &rsp); err == nil {
+		t.Errorf("SayHello(empty name) should fail")
+	}
+	t.Logf("SayHello(empty name) = %v", err)
+	if err = tripleCall(c, "SayBye", wrapperspb.String("dubbogo"), &rsp); err == nil {
+		t.Errorf("SayBye() should fail")
+	}
+	t.Logf("SayBye() = %v", err)
+}
+
+// a plain grpc client over h2c
+func TestTripleServerStreaming(t *testing.T) {
+	s, addr := startTripleServer(t)
+	defer s.Stop()
+
+	client := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}
+
+	arg, _ := proto.Marshal(wrapperspb.Int32(3))
+	body := make([]byte, 5, 5+len(arg))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(arg)))
+	body = append(body, arg...)
+	req, _ := http.NewRequest("POST", "http://"+addr+"/grpc.testing.Greeter/Count", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	rsp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Count() = %v", err)
+	}
+	defer rsp.Body.Close()
+
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatalf("ioutil.ReadAll() = %v", err)
+	}
+	if status := rsp.Trailer.Get("Grpc-Status"); status != "0" {
+		t.Fatalf("grpc-status:%q, grpc-message:%q", status, rsp.Trailer.Get("Grpc-Message"))
+	}
+
+	var values []int32
+	for len(b) >= 5 {
+		l := binary.BigEndian.Uint32(b[1:])
+		var v wrapperspb.Int32Value
+		if err = proto.Unmarshal(b[5:5+l], &v); err != nil {
+			t.Fatalf("proto.Unmarshal() = %v", err)
+		}
+		values = append(values, v.GetValue())
+		b = b[5+l:]
+	}
+	if !reflect.DeepEqual(values, []int32{0, 1, 2}) {
+		t.Errorf("Count(3) = %v", values)
+	}
+}
+
+type Echo struct{}
+
+func (e *Echo) Service() string { return "com.ikurento.Echo" }
+func (e *Echo) Version() string { return "" }
+
+func (e *Echo) Hello(ctx context.Context, name *string, rsp *string) error {
+	if *name == "panic" {
+		panic("echo panic")
+	}
+	*rsp = "hello " + *name
+	return nil
+}
+
+func TestJSONRPCOverNetHTTP(t *testing.T) {
+	s, addr := startServer(t, transport.NewNetHTTPTransport(), "jsonrpc", "com.ikurento.Echo", &Echo{})
+	defer s.Stop()
+
+	var (
+		url    = "http://" + addr + "/com.ikurento.Echo"
+		client = &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	)
+	do := func(method string, body []byte, header map[string]string) (*http.Response, []byte) {
+		req, _ := http.NewRequest(method, url, bytes.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rsp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s = %v", method, url, err)
+		}
+		defer rsp.Body.Close()
+		b, _ := ioutil.ReadAll(rsp.Body)
+		return rsp, b
+	}
+
+	// cors preflight
+	rsp, _ := do("OPTIONS", nil, map[string]string{
+		"Origin":                         "http://example.com",
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "content-type",
+	})
+	if rsp.StatusCode != http.StatusNoContent || rsp.Header.Get("Access-Control-Allow-Origin") != "http://example.com" ||
+		rsp.Header.Get("Access-Control-Allow-Headers") != "content-type" {
+		t.Errorf("OPTIONS = %d, header:%v", rsp.StatusCode, rsp.Header)
+	}
+	if rsp, _ = do("GET", nil, nil); rsp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET = %d", rsp.StatusCode)
+	}
+
+	// gzip request & response on the same keep-alive connection
+	var zbuf bytes.Buffer
+	zw := gzip.NewWriter(&zbuf)
+	zw.Write([]byte(`{"jsonrpc":"2.0","method":"Hello","params":["dubbogo"],"id":1}`))
+	zw.Close()
+	rsp, b := do("POST", zbuf.Bytes(), map[string]string{
+		"Content-Type":     "application/json; charset=utf-8",
+		"Content-Encoding": "gzip",
+		"Accept-Encoding":  "gzip",
+	})
+	if rsp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, body:%s", rsp.Header.Get("Content-Encoding"), b)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("gzip.NewReader() = %v", err)
+	}
+	if b, _ = ioutil.ReadAll(zr); !bytes.Contains(b, []byte(`"result":"hello dubbogo"`)) {
+		t.Errorf("Hello() = %s", b)
+	}
+
+	// batch with a notification
+	_, b = do("POST", []byte(`[{"jsonrpc":"2.0","method":"Hello","params":["a"],"id":1},
+		{"jsonrpc":"2.0","method":"Hello","params":["b"]},
+		{"jsonrpc":"2.0","method":"Bye","params":["c"],"id":3}]`),
+		map[string]string{"Content-Type": "application/json"})
+	var rsps []struct {
+		ID     int                    `json:"id"`
+		Result string                 `json:"result"`
+		Error  map[string]interface{} `json:"error"`
+	}
+	if err = json.Unmarshal(b, &rsps); err != nil || len(rsps) != 2 ||
+		rsps[0].ID != 1 || rsps[0].Result != "hello a" || rsps[1].ID != 3 || rsps[1].Error == nil {
+		t.Errorf("batch response:%s, err:%v", b, err)
+	}
+
+	// parse error is replied
+	if _, b = do("POST", []byte(`{"jsonrpc"`), map[string]string{"Content-Type": "application/json"}); !bytes.Contains(b, []byte("-32700")) {
+		t.Errorf("parse error response:%s", b)
+	}
+}
+
+func TestFilters(t *testing.T) {
+	var (
+		lock  sync.Mutex
+		trace []string
+	)
+	logFilter := func(ctx context.Context, req Request, rsp interface{}, next HandlerFunc) error {
+		err := next(ctx, req, rsp)
+		lock.Lock()
+		trace = append(trace, fmt.Sprintf("%s.%s:%v", req.Service(), req.Method(), err))
+		lock.Unlock()
+		return err
+	}
+	recoverFilter := func(ctx context.Context, req Request, rsp interface{}, next HandlerFunc) (err error) {
+		defer func() {
+			if e := recover(); e != nil {
+				err = fmt.Errorf("panic: %v", e)
+			}
+		}()
+		return next(ctx, req, rsp)
+	}
+	authFilter := func(ctx context.Context, req Request, rsp interface{}, next HandlerFunc) error {
+		if name, ok := req.Request().(*string); ok && *name == "nobody" {
+			return jerrors.New("permission denied")
+		}
+		return next(ctx, req, rsp)
+	}
+
+	s, addr := startServer(t, transport.NewNetHTTPTransport(), "jsonrpc", "com.ikurento.Echo", &Echo{},
+		Filters(logFilter, recoverFilter), Filters(authFilter))
+	defer s.Stop()
+
+	call := func(name string) string {
+		body := fmt.Sprintf(`{"jsonrpc":"2.0","method":"Hello","params":[%q],"id":1}`, name)
+		rsp, err := http.Post("http://"+addr+"/com.ikurento.Echo", "application/json", bytes.NewReader([]byte(body)))
+		if err != nil {
+			t.Fatalf("Hello(%s) = %v", name, err)
+		}
+		defer rsp.Body.Close()
+		b, _ := ioutil.ReadAll(rsp.Body)
+		return string(b)
+	}
+
+	if b := call("dubbogo"); !strings.Contains(b, `"result":"hello dubbogo"`) {
+		t.Errorf("Hello(dubbogo) = %s", b)
+	}
+	if b := call("nobody"); !strings.Contains(b, "permission denied") {
+		t.Errorf("Hello(nobody) = %s", b)
+	}
+	if b := call("panic"); !strings.Contains(b, "panic: echo panic") {
+		t.Errorf("Hello(panic) = %s", b)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	expected := []string{
+		"com.ikurento.Echo.Hello:<nil>",
+		"com.ikurento.Echo.Hello:permission denied",
+		"com.ikurento.Echo.Hello:panic: echo panic",
+	}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Errorf("trace:%q", trace)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	s, addr := startServer(t, transport.NewNetHTTPTransport(), "jsonrpc", "com.ikurento.Echo", &Echo{},
+		TracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))))
+	defer s.Stop()
+
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	req, _ := http.NewRequest("POST", "http://"+addr+"/com.ikurento.Echo",
+		strings.NewReader(`{"jsonrpc":"2.0","method":"Hello","params":["dubbogo"],"id":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Traceparent", "00-"+traceID+"-"+spanID+"-01")
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Hello() = %v", err)
+	}
+	ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("spans:%+v", spans)
+	}
+	span := spans[0]
+	if span.Name != "com.ikurento.Echo/Hello" || span.SpanKind != trace.SpanKindServer {
+		t.Errorf("span:%+v", span)
+	}
+	if !span.Parent.IsRemote() || span.Parent.TraceID().String() != traceID || span.Parent.SpanID().String() != spanID {
+		t.Errorf("parent:%+v", span.Parent)
+	}
+}
+
+// the trace context is a dubbo attachment over tcp
+func TestTracingOverTCP(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	s, addr := startServer(t, transport.NewTCPTransport(), "protobuf", "grpc.testing.Greeter", &Greeter{},
+		TracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))))
+	defer s.Stop()
+
+	u, err := registry.NewServiceURL("protobuf://" + addr + "/grpc.testing.Greeter")
+	if err != nil {
+		t.Fatalf("NewServiceURL() = %v", err)
+	}
+	c := client.NewClient(
+		client.CodecType(codec.CODECTYPE_PROTOBUF),
+		client.Registry(&testRegistry{}),
+		client.Selector(&staticSelector{url: u}),
+	)
+	defer c.Close()
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	}))
+	var rsp wrapperspb.StringValue
+	if err = c.Call(ctx, c.NewRequest("", "", "grpc.testing.Greeter", "SayHello", wrapperspb.String("dubbogo")), &rsp); err != nil {
+		t.Fatalf("SayHello() = %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("spans:%+v", spans)
+	}
+	if parent := spans[0].Parent; !parent.IsRemote() || parent.TraceID() != traceID {
+		t.Errorf("parent:%+v", parent)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	var (
+		entered = make(chan struct{})
+		blocked = make(chan struct{})
+	)
+	blockFilter := func(ctx context.Context, req Request, rsp interface{}, next HandlerFunc) error {
+		if name, ok := req.Request().(*string); ok && *name == "block" {
+			entered <- struct{}{}
+			<-blocked
+		}
+		return next(ctx, req, rsp)
+	}
+	conf := ServiceLimitConfig{
+		LimitConfig: LimitConfig{Executes: 1},
+		Methods:     map[string]LimitConfig{"Hello": {TPS: 2, TPSInterval: time.Hour}},
+	}
+	if params := conf.Params().Encode(); params != "Hello.tps=2&Hello.tps.interval=3600000&executes=1" {
+		t.Errorf("params:%s", params)
+	}
+
+	s, addr := startServer(t, transport.NewNetHTTPTransport(), "jsonrpc", "com.ikurento.Echo", &Echo{},
+		Filters(blockFilter), Limits("com.ikurento.Echo", conf))
+	defer s.Stop()
+
+	call := func(name string) string {
+		body := fmt.Sprintf(`{"jsonrpc":"2.0","method":"Hello","params":[%q],"id":1}`, name)
+		rsp, err := http.Post("http://"+addr+"/com.ikurento.Echo", "application/json", bytes.NewReader([]byte(body)))
+		if err != nil {
+			t.Errorf("Hello(%s) = %v", name, err)
+			return ""
+		}
+		defer rsp.Body.Close()
+		b, _ := ioutil.ReadAll(rsp.Body)
+		return string(b)
+	}
+
+	done := make(chan string)
+	go func() { done <- call("block") }()
+	<-entered
+	if b := call("dubbogo"); !strings.Contains(b, "max concurrent executions 1") || !strings.Contains(b, `"code":503`) {
+		t.Errorf("Hello(dubbogo) = %s", b)
+	}
+	close(blocked)
+	if b := <-done; !strings.Contains(b, `"result":"hello block"`) {
+		t.Errorf("Hello(block) = %s", b)
+	}
+
+	// the rejected request does not take a token
+	if b := call("dubbogo"); !strings.Contains(b, `"result":"hello dubbogo"`) {
+		t.Errorf("Hello(dubbogo) = %s", b)
+	}
+	if b := call("dubbogo"); !strings.Contains(b, "max tps 2") || !strings.Contains(b, `"code":429`) {
+		t.Errorf("Hello(dubbogo) = %s", b)
+	}
+}
+
+func TestLimiterRefund(t *testing.T) {
+	l := newLimiter(map[string]ServiceLimitConfig{
+		"com.ikurento.Echo": {
+			LimitConfig: LimitConfig{TPS: 2, TPSInterval: time.Hour},
+			Methods:     map[string]LimitConfig{"Hello": {TPS: 1, TPSInterval: time.Hour}},
+		},
+	})
+	acquire := func(method string) error {
+		release, err := l.acquire("com.ikurento.Echo", method)
+		if err == nil {
+			release()
+		}
+		return err
+	}
+
+	if err := acquire("Hello"); err != nil {
+		t.Fatalf("acquire(Hello) = %v", err)
+	}
+	if err := acquire("Hello"); err == nil {
+		t.Fatalf("acquire(Hello) should exceed the method tps")
+	}
+	// the service token taken by the rejected request is refunded
+	if err := acquire("Bye"); err != nil {
+		t.Errorf("acquire(Bye) = %v", err)
+	}
+	if err := acquire("Bye"); err == nil {
+		t.Errorf("acquire(Bye) should exceed the service tps")
+	}
+}
+
+type unregisterRegistry struct {
+	testRegistry
+	sync.Mutex
+	unregistered []string
+}
+
+func (r *unregisterRegistry) Unregister(conf interface{}) error {
+	r.Lock()
+	r.unregistered = append(r.unregistered, conf.(registry.ProviderServiceConfig).Service)
+	r.Unlock()
+	return nil
+}
+
+func TestGracefulStop(t *testing.T) {
+	var (
+		reg     = &unregisterRegistry{}
+		entered = make(chan struct{})
+		blocked = make(chan struct{})
+		stopped = make(chan struct{})
+	)
+	blockFilter := func(ctx context.Context, req Request, rsp interface{}, next HandlerFunc) error {
+		if name, ok := req.Request().(*string); ok && *name == "block" {
+			entered <- struct{}{}
+			<-blocked
+		}
+		return next(ctx, req, rsp)
+	}
+	s, addr := startServer(t, transport.NewHTTPTransport(), "jsonrpc", "com.ikurento.Echo", &Echo{},
+		Registry(reg), Filters(blockFilter), GracePeriod(50*time.Millisecond))
+
+	// call returns the response body and its readonly event
+	call := func(name string) (string, string) {
+		body := fmt.Sprintf(`{"jsonrpc":"2.0","method":"Hello","params":[%q],"id":1}`, name)
+		client := &http.Client{Transport: &http.Transport{}}
+		rsp, err := client.Post("http://"+addr+"/com.ikurento.Echo", "application/json", bytes.NewReader([]byte(body)))
+		if err != nil {
+			return err.Error(), ""
+		}
+		defer rsp.Body.Close()
+		b, _ := ioutil.ReadAll(rsp.Body)
+		return string(b), rsp.Header.Get(common.DUBBO_EVENT_HEADER)
+	}
+	// an idle keep-alive connection
+	if b, event := call("idle"); !strings.Contains(b, `"result":"hello idle"`) || len(event) != 0 {
+		t.Fatalf("Hello(idle) = %s, event:%q", b, event)
+	}
+
+	done := make(chan [2]string)
+	go func() {
+		b, event := call("block")
+		done <- [2]string{b, event}
+	}()
+	<-entered
+	start := time.Now()
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+
+	// the listener is closed after the providers are unregistered and the grace period
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Second < time.Since(start) {
+			t.Fatalf("the listener is not closed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("the listener is closed in %v, before the grace period", d)
+	}
+	reg.Lock()
+	if !reflect.DeepEqual(reg.unregistered, []string{"com.ikurento.Echo"}) {
+		t.Errorf("unregistered:%v", reg.unregistered)
+	}
+	reg.Unlock()
+
+	// the in-flight request is finished before the server stops
+	select {
+	case <-stopped:
+		t.Fatalf("the server stops with an in-flight request")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(blocked)
+	// the response in graceful shutdown carries the readonly event
+	if r := <-done; !strings.Contains(r[0], `"result":"hello block"`) || r[1] != common.READONLY_EVENT {
+		t.Errorf("Hello(block) = %s, event:%q", r[0], r[1])
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("the server does not stop")
+	}
+}
+
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (b *bufferCloser) Close() error { return nil }
+
+// the readonly event is written in the dubbo frame on the idle tcp connections
+func TestReadonlyEventOverTCP(t *testing.T) {
+	s, addr := startServer(t, transport.NewTCPTransport(), "protobuf", "grpc.testing.Greeter", &Greeter{},
+		GracePeriod(50*time.Millisecond))
+
+	conn, err := transport.NewTCPTransport().Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial() = %v", err)
+	}
+	defer conn.Close()
+
+	var (
+		buf = &bufferCloser{}
+		c   = protobuf.NewCodec(buf)
+		m   codec.Message
+		rsp wrapperspb.StringValue
+	)
+	// read reads the packages until @fn succeeds
+	read := func(fn func() error) {
+		for err := fn(); err != nil; err = fn() {
+			if err != codec.ErrHeaderNotEnough && err != codec.ErrBodyNotEnough {
+				t.Fatalf("read() = %v", err)
+			}
+			var p transport.Package
+			if err = conn.Recv(&p); err != nil {
+				t.Fatalf("Recv() = %v", err)
+			}
+			buf.Write(p.Body)
+		}
+	}
+
+	req := &codec.Message{ID: 1, Type: codec.Request, Target: "grpc.testing.Greeter",
+		ServicePath: "grpc.testing.Greeter", Method: "SayHello"}
+	if err = c.Write(req, wrapperspb.String("dubbogo")); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if err = conn.Send(&transport.Package{Body: buf.Bytes()}); err != nil {
+		t.Fatalf("Send() = %v", err)
+	}
+	buf.Reset()
+	read(func() error { return c.ReadHeader(&m, codec.Response) })
+	read(func() error { return c.ReadBody(&rsp) })
+	if rsp.GetValue() != "hello dubbogo" || len(m.Header[common.DUBBO_EVENT_HEADER]) != 0 {
+		t.Fatalf("SayHello() = %q, event:%q", rsp.GetValue(), m.Header[common.DUBBO_EVENT_HEADER])
+	}
+
+	// the connection is idle at shutdown
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+	m = codec.Message{}
+	read(func() error {
+		if err := c.ReadHeader(&m, codec.Response); err != codec.ErrHeaderNotEnough {
+			return err
+		}
+		if m.Header[common.DUBBO_EVENT_HEADER] == common.READONLY_EVENT {
+			return nil
+		}
+		return codec.ErrHeaderNotEnough
+	})
+	<-stopped
+}
+
+// readonlySelector records the providers marked readonly
+type readonlySelector struct {
+	staticSelector
+	sync.Mutex
+	readonly []string
+}
+
+func (s *readonlySelector) MarkReadonly(url *registry.ServiceURL) {
+	s.Lock()
+	s.readonly = append(s.readonly, url.Location)
+	s.Unlock()
+}
+
+// the consumer reads the readonly event on its idle connection before it is reused
+func TestReadonlyEventOnIdleConn(t *testing.T) {
+	s, addr := startServer(t, transport.NewTCPTransport(), "protobuf", "grpc.testing.Greeter", &Greeter{},
+		GracePeriod(200*time.Millisecond))
+
+	u, err := registry.NewServiceURL("protobuf://" + addr + "/grpc.testing.Greeter")
+	if err != nil {
+		t.Fatalf("NewServiceURL() = %v", err)
+	}
+	sel := &readonlySelector{staticSelector: staticSelector{url: u}}
+	c := client.NewClient(
+		client.CodecType(codec.CODECTYPE_PROTOBUF),
+		client.Registry(&testRegistry{}),
+		client.Selector(sel),
+		client.PoolSize(1),
+	)
+	defer c.Close()
+
+	call := func() {
+		var rsp wrapperspb.StringValue
+		req := c.NewRequest("", "", "grpc.testing.Greeter", "SayHello", wrapperspb.String("dubbogo"))
+		if err := c.Call(context.Background(), req, &rsp); err != nil || rsp.GetValue() != "hello dubbogo" {
+			t.Errorf("SayHello() = %v, rsp:%q", err, rsp.GetValue())
+		}
+	}
+	call()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	// the provider still serves in the grace period
+	call()
+	sel.Lock()
+	if !reflect.DeepEqual(sel.readonly, []string{u.Location}) {
+		t.Errorf("readonly providers:%v", sel.readonly)
+	}
+	sel.Unlock()
+	<-stopped
+}
+
+type paramsRegistry struct {
+	testRegistry
+	params url.Values
+}
+
+func (r *paramsRegistry) Register(conf interface{}) error {
+	r.params = conf.(registry.ProviderServiceConfig).Params
+	return nil
+}
+
+// newCert issues a certificate of @cn signed by @ca, or a self-signed CA if @ca is nil
+func newCert(t *testing.T, cn string, ca *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() = %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	parent, signer := tmpl, interface{}(key)
+	if ca == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		parent, signer = ca.Leaf, ca.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate() = %v", err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestMutualTLS(t *testing.T) {
+	var (
+		reg  = &paramsRegistry{}
+		ca   = newCert(t, "ca", nil)
+		pool = x509.NewCertPool()
+		peer = make(chan *Peer, 1)
+	)
+	pool.AddCert(ca.Leaf)
+	serverConf := &tls.Config{
+		Certificates: []tls.Certificate{newCert(t, "provider", &ca)},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	peerFilter := func(ctx context.Context, req Request, rsp interface{}, next HandlerFunc) error {
+		p, _ := PeerFromContext(ctx)
+		peer <- p
+		return next(ctx, req, rsp)
+	}
+	s, addr := startServer(t, transport.NewHTTPTransport(transport.TLSConfig(serverConf)), "jsonrpc",
+		"com.ikurento.Echo", &Echo{}, Registry(reg), Filters(peerFilter))
+	defer s.Stop()
+	if reg.params.Get("tls") != "true" {
+		t.Errorf("the provider url params %v have no tls", reg.params)
+	}
+
+	call := func(certs ...tls.Certificate) (string, error) {
+		body := `{"jsonrpc":"2.0","method":"Hello","params":["tls"],"id":1}`
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs},
+		}}
+		rsp, err := client.Post("https://"+addr+"/com.ikurento.Echo", "application/json", strings.NewReader(body))
+		if err != nil {
+			return "", err
+		}
+		defer rsp.Body.Close()
+		b, _ := ioutil.ReadAll(rsp.Body)
+		return string(b), nil
+	}
+
+	if b, err := call(newCert(t, "consumer", &ca)); err != nil || !strings.Contains(b, `"result":"hello tls"`) {
+		t.Fatalf("Hello() = %s, %v", b, err)
+	}
+	if p := <-peer; p == nil || p.CommonName != "consumer" {
+		t.Errorf("peer:%+v", p)
+	}
+	// the client certificate is required
+	if b, err := call(); err == nil {
+		t.Errorf("Hello() without client certificate = %s", b)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	reg := &paramsRegistry{}
+	acl := ServiceACL{
+		ACLRule: ACLRule{Deny: []string{"blacklisted"}},
+		Methods: map[string]ACLRule{"Hello": {Allow: []string{"10.0.0.0/8", "trusted"}}},
+	}
+	s, addr := startServer(t, transport.NewNetHTTPTransport(), "jsonrpc", "com.ikurento.Echo", &Echo{},
+		Registry(reg), Token("com.ikurento.Echo", "true"), ACL("com.ikurento.Echo", acl))
+	defer s.Stop()
+
+	token := reg.params.Get("token")
+	if len(token) != 32 {
+		t.Fatalf("token:%q", token)
+	}
+
+	call := func(token, app string) string {
+		body := `{"jsonrpc":"2.0","method":"Hello","params":["dubbogo"],"id":1}`
+		req, _ := http.NewRequest("POST", "http://"+addr+"/com.ikurento.Echo", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		if len(token) != 0 {
+			req.Header.Set("token", token)
+		}
+		if len(app) != 0 {
+			req.Header.Set("application", app)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("Hello() = %v", err)
+			return ""
+		}
+		defer rsp.Body.Close()
+		b, _ := ioutil.ReadAll(rsp.Body)
+		return string(b)
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		if b := call(token, "trusted"); !strings.Contains(b, `"code":401`) {
+			t.Errorf("Hello(token:%q) = %s", token, b)
+		}
+	}
+	if b := call(token, "trusted"); !strings.Contains(b, `"result":"hello dubbogo"`) {
+		t.Errorf("Hello(application:trusted) = %s", b)
+	}
+	// 127.0.0.1 is not in the allow list of Hello
+	if b := call(token, "unknown"); !strings.Contains(b, `"code":403`) {
+		t.Errorf("Hello(application:unknown) = %s", b)
+	}
+
+	s.rpc[0].auth = newAuthenticator(&Options{ACLs: map[string]ServiceACL{
+		"com.ikurento.Echo": {ACLRule: ACLRule{Allow: []string{"trusted"}, Deny: []string{"127.0.0.1"}}},
+	}})
+	if b := call("", "trusted"); !strings.Contains(b, `"code":403`) {
+		t.Errorf("Hello(ip:127.0.0.1) = %s", b)
+	}
+}
+
+// staticSelector selects the provider @url
+type staticSelector struct {
+	url *registry.ServiceURL
+}
+
+func (s *staticSelector) Options() selector.Options { return selector.Options{} }
+func (s *staticSelector) Close() error              { return nil }
+func (s *staticSelector) String() string            { return "static-selector" }
+func (s *staticSelector) Select(registry.ServiceConfigIf) (selector.Next, error) {
+	return func(int64) (*registry.ServiceURL, error) { return s.url, nil }, nil
+}
+
+// the token is a dubbo attachment over tcp
+func TestAuthOverTCP(t *testing.T) {
+	reg := &paramsRegistry{}
+	s, addr := startServer(t, transport.NewTCPTransport(), "protobuf", "grpc.testing.Greeter", &Greeter{},
+		Registry(reg), Token("grpc.testing.Greeter", "true"))
+	defer s.Stop()
+
+	call := func(token string) error {
+		u, err := registry.NewServiceURL("protobuf://" + addr + "/grpc.testing.Greeter?token=" + token)
+		if err != nil {
+			t.Fatalf("NewServiceURL() = %v", err)
+		}
+		c := client.NewClient(
+			client.CodecType(codec.CODECTYPE_PROTOBUF),
+			client.Registry(&testRegistry{}),
+			client.Selector(&staticSelector{url: u}),
+		)
+		defer c.Close()
+
+		var rsp wrapperspb.StringValue
+		req := c.NewRequest("", "", "grpc.testing.Greeter", "SayHello", wrapperspb.String("dubbogo"))
+		if err = c.Call(context.Background(), req, &rsp); err == nil && rsp.GetValue() != "hello dubbogo" {
+			t.Errorf("SayHello() = %q", rsp.GetValue())
+		}
+		return err
+	}
+
+	if err := call(reg.params.Get("token")); err != nil {
+		t.Errorf("SayHello() = %v", err)
+	}
+	if err := call("wrong"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("SayHello(token:wrong) = %v", err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	reg := &paramsRegistry{}
+	s, addr := startServer(t, transport.NewNetHTTPTransport(), "jsonrpc", "com.ikurento.Echo", &Echo{}, Registry(reg),
+		ServiceConfList([]registry.ServiceConfig{{Protocol: "jsonrpc", Service: "com.ikurento.Echo", Sign: true}}),
+		Credentials(StaticCredentials{"ak": "sk"}), SignWindow(time.Minute))
+	defer s.Stop()
+
+	if sign := reg.params.Get("sign"); sign != "true" {
+		t.Fatalf("sign:%q", sign)
+	}
+
+	// the signature covers the encoded params
+	digest := codec.Digest([]byte(`["dubbogo"]`))
+	call := func(name, accessKey, secretKey string, ts time.Time, nonce string) string {
+		body := fmt.Sprintf(`{"jsonrpc":"2.0","method":"Hello","params":[%q],"id":1}`, name)
+		req, _ := http.NewRequest("POST", "http://"+addr+"/com.ikurento.Echo", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		timestamp := strconv.FormatInt(ts.UnixNano()/int64(time.Millisecond), 10)
+		req.Header.Set(common.ACCESS_KEY_KEY, accessKey)
+		req.Header.Set(common.TIMESTAMP_KEY, timestamp)
+		req.Header.Set(common.NONCE_KEY, nonce)
+		req.Header.Set(common.SIGNATURE_KEY,
+			common.Sign(secretKey, accessKey, "com.ikurento.Echo", "Hello", digest, timestamp, nonce))
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("Hello(%s) = %v", name, err)
+			return ""
+		}
+		defer rsp.Body.Close()
+		b, _ := ioutil.ReadAll(rsp.Body)
+		return string(b)
+	}
+
+	nonce := common.NewNonce()
+	if b := call("dubbogo", "ak", "sk", time.Now(), nonce); !strings.Contains(b, `"result":"hello dubbogo"`) {
+		t.Errorf("Hello(signed) = %s", b)
+	}
+	for _, c := range []struct {
+		name, accessKey, secretKey string
+		ts                         time.Time
+		nonce                      string
+	}{
+		{"tampered", "ak", "sk", time.Now(), common.NewNonce()},
+		{"dubbogo", "ak", "wrong", time.Now(), common.NewNonce()},
+		{"dubbogo", "unknown", "sk", time.Now(), common.NewNonce()},
+		{"dubbogo", "ak", "sk", time.Now().Add(-2 * time.Minute), common.NewNonce()},
+		{"dubbogo", "ak", "sk", time.Now(), ""},
+		{"dubbogo", "ak", "sk", time.Now(), nonce}, // replayed
+	} {
+		if b := call(c.name, c.accessKey, c.secretKey, c.ts, c.nonce); !strings.Contains(b, `"code":401`) {
+			t.Errorf("Hello(%+v) = %s", c, b)
+		}
+	}
+
+	// every call of a batch is signed with its own nonce
+	u, err := registry.NewServiceURL("jsonrpc://" + addr + "/com.ikurento.Echo?sign=true")
+	if err != nil {
+		t.Fatalf("NewServiceURL() = %v", err)
+	}
+	batchCall := func(secretKey string) (jsonrpc.Batch, error) {
+		c := client.NewClient(
+			client.CodecType(codec.CODECTYPE_JSONRPC),
+			client.Registry(&testRegistry{}),
+			client.Selector(&staticSelector{url: u}),
+			client.Credential("ak", secretKey),
+		)
+		defer c.Close()
+
+		var a, b string
+		batch := jsonrpc.Batch{
+			{Method: "Hello", Params: []string{"a"}, Reply: &a},
+			{Method: "Hello", Params: []string{"b"}, Reply: &b},
+		}
+		return batch, c.BatchCall(context.Background(), "", "", "com.ikurento.Echo", batch)
+	}
+	batch, err := batchCall("sk")
+	if err != nil || batch[0].Error != nil || batch[1].Error != nil ||
+		*batch[0].Reply.(*string) != "hello a" || *batch[1].Reply.(*string) != "hello b" {
+		t.Errorf("BatchCall() = %v, calls:{%v, %v}", err, batch[0].Error, batch[1].Error)
+	}
+	if batch, err = batchCall("wrong"); err != nil {
+		t.Errorf("BatchCall(secret key:wrong) = %v", err)
+	}
+	for i, call := range batch {
+		if call.Error == nil || !strings.Contains(call.Error.Error(), "401") {
+			t.Errorf("BatchCall(secret key:wrong) call %d = %v", i, call.Error)
+		}
+	}
+}
+
+// the signature is a dubbo attachment over tcp
+func TestSignOverTCP(t *testing.T) {
+	s, addr := startServer(t, transport.NewTCPTransport(), "protobuf", "grpc.testing.Greeter", &Greeter{},
+		ServiceConfList([]registry.ServiceConfig{{Protocol: "protobuf", Service: "grpc.testing.Greeter", Sign: true}}),
+		Credentials(StaticCredentials{"ak": "sk"}), SignWindow(time.Minute))
+	defer s.Stop()
+
+	u, err := registry.NewServiceURL("protobuf://" + addr + "/grpc.testing.Greeter?sign=true")
+	if err != nil {
+		t.Fatalf("NewServiceURL() = %v", err)
+	}
+	call := func(secretKey string) error {
+		c := client.NewClient(
+			client.CodecType(codec.CODECTYPE_PROTOBUF),
+			client.Registry(&testRegistry{}),
+			client.Selector(&staticSelector{url: u}),
+			client.Credential("ak", secretKey),
+		)
+		defer c.Close()
+
+		var rsp wrapperspb.StringValue
+		req := c.NewRequest("", "", "grpc.testing.Greeter", "SayHello", wrapperspb.String("dubbogo"))
+		if err := c.Call(context.Background(), req, &rsp); err != nil {
+			return err
+		}
+		if rsp.GetValue() != "hello dubbogo" {
+			t.Errorf("SayHello() = %q", rsp.GetValue())
+		}
+		return nil
+	}
+
+	// every call is signed with a fresh nonce
+	for i := 0; i < 2; i++ {
+		if err := call("sk"); err != nil {
+			t.Errorf("SayHello() = %v", err)
+		}
+	}
+	if err := call("wrong"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("SayHello(secret key:wrong) = %v", err)
+	}
+}
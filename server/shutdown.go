@@ -0,0 +1,147 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+import (
+	log "github.com/AlexStocks/log4go"
+	jerrors "github.com/juju/errors"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/codec"
+	"github.com/AlexStocks/dubbogo/common"
+	"github.com/AlexStocks/dubbogo/transport"
+)
+
+const (
+	drainInterval = 10 * time.Millisecond
+)
+
+// addSocket tracks @sock until it is closed, and returns the number of open sockets
+func (server *rpcServer) addSocket(sock transport.Socket) int32 {
+	server.socksLock.Lock()
+	defer server.socksLock.Unlock()
+	server.socks[sock] = nil
+	return int32(len(server.socks))
+}
+
+// setEventCodec records the codec of @sock, which frames the events sent at shutdown
+func (server *rpcServer) setEventCodec(sock transport.Socket, newCodec codec.NewCodec) {
+	server.socksLock.Lock()
+	defer server.socksLock.Unlock()
+	if _, ok := server.socks[sock]; ok {
+		server.socks[sock] = newCodec
+	}
+}
+
+func (server *rpcServer) removeSocket(sock transport.Socket) {
+	server.socksLock.Lock()
+	delete(server.socks, sock)
+	server.socksLock.Unlock()
+}
+
+// sendEvent writes @event in the dubbo frame on the open connections, including the
+// idle ones in the pools of the consumers, which have no response to carry it.
+func (server *rpcServer) sendEvent(event string) {
+	// Send may block on a slow consumer, so the sockets are sent outside the lock
+	socks := make(map[transport.Socket]codec.NewCodec)
+	server.socksLock.Lock()
+	for sock, newCodec := range server.socks {
+		if newCodec != nil {
+			socks[sock] = newCodec
+		}
+	}
+	server.socksLock.Unlock()
+
+	for sock, newCodec := range socks {
+		rwc := &readWriteCloser{rbuf: bytes.NewBuffer(nil), wbuf: bytes.NewBuffer(nil)}
+		e, ok := newCodec(rwc).(codec.Eventer)
+		if !ok {
+			continue
+		}
+		if err := e.WriteEvent(event); err != nil {
+			log.Warn("WriteEvent(%s) = error{%v}", event, jerrors.ErrorStack(err))
+			continue
+		}
+		if err := sock.Send(&transport.Package{Body: rwc.wbuf.Bytes()}); err != nil {
+			log.Warn("connection{local:%v, remote:%v}.Send(event:%s) = error{%v}",
+				sock.LocalAddr(), sock.RemoteAddr(), event, jerrors.ErrorStack(err))
+		}
+	}
+}
+
+// closeSockets closes the idle keep-alive connections at shutdown, whose goroutines
+// are blocked in Recv.
+func (server *rpcServer) closeSockets() {
+	server.socksLock.Lock()
+	defer server.socksLock.Unlock()
+	for sock := range server.socks {
+		sock.Close()
+	}
+}
+
+// closeListener stops accepting connections. The listener built on net/http.Server
+// closes its idle connections and waits for the active ones until @deadline.
+func (server *rpcServer) closeListener(deadline time.Time) {
+	var err error
+	if s, ok := server.listener.(transport.Shutdowner); ok {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		err = s.Shutdown(ctx)
+		cancel()
+		if err == nil {
+			return
+		}
+		log.Warn("listener{addr:%s}.Shutdown() = error{%v}", server.listener.Addr(), jerrors.ErrorStack(err))
+	}
+	if err = server.listener.Close(); err != nil {
+		log.Warn("listener{addr:%s}.Close() = error{%#v}", server.listener.Addr(), err)
+	}
+}
+
+// drain waits for the in-flight requests until @deadline, and returns the number
+// of the unfinished ones.
+func (server *rpcServer) drain(deadline time.Time) int32 {
+	for {
+		n := atomic.LoadInt32(&server.pending)
+		if n == 0 || !time.Now().Before(deadline) {
+			return n
+		}
+		time.Sleep(drainInterval)
+	}
+}
+
+// eventSocket sends the readonly event in the http header of the responses after
+// the server begins to shut down, so that the consumers stop selecting it.
+type eventSocket struct {
+	transport.Socket
+	readonly *int32
+}
+
+func (e *eventSocket) Send(p *transport.Package) error {
+	if atomic.LoadInt32(e.readonly) != 0 {
+		if p.Header == nil {
+			p.Header = make(map[string]string)
+		}
+		p.Header[common.DUBBO_EVENT_HEADER] = common.READONLY_EVENT
+	}
+	return e.Socket.Send(p)
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/hmac"
+	"strconv"
+	"sync"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+import (
+	"github.com/AlexStocks/dubbogo/common"
+)
+
+// CredentialStore looks up the secret keys of the access keys of the consumers
+type CredentialStore interface {
+	// SecretKey returns the secret key of @accessKey, or an error if it's unknown
+	SecretKey(accessKey string) (string, error)
+}
+
+// StaticCredentials is a CredentialStore of fixed keys, access key -> secret key
+type StaticCredentials map[string]string
+
+func (c StaticCredentials) SecretKey(accessKey string) (string, error) {
+	if sk, ok := c[accessKey]; ok {
+		return sk, nil
+	}
+	return "", jerrors.Errorf("unknown access key %q", accessKey)
+}
+
+// verifier checks the signatures of the requests of a service
+type verifier struct {
+	credentials CredentialStore
+	window      time.Duration
+
+	sync.Mutex
+	nonces map[string]time.Time // access key & nonce -> expiry of the seen requests
+	pruned time.Time
+}
+
+func newVerifier(credentials CredentialStore, window time.Duration) *verifier {
+	return &verifier{
+		credentials: credentials,
+		window:      window,
+		nonces:      make(map[string]time.Time),
+		pruned:      time.Now(),
+	}
+}
+
+// verify checks the signature of the request whose encoded args have @digest, and
+// rejects the replayed one whose nonce has been seen in the timestamp window.
+func (v *verifier) verify(header map[string]string, service, method, digest string) error {
+	var (
+		accessKey = common.Attachment(header, common.ACCESS_KEY_KEY)
+		timestamp = common.Attachment(header, common.TIMESTAMP_KEY)
+		nonce     = common.Attachment(header, common.NONCE_KEY)
+		signature = common.Attachment(header, common.SIGNATURE_KEY)
+	)
+	if len(accessKey) == 0 || len(signature) == 0 || len(nonce) == 0 {
+		return jerrors.New("the request is not signed")
+	}
+	if v.credentials == nil {
+		return jerrors.New("no credential store")
+	}
+
+	ms, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return jerrors.Errorf("invalid timestamp %q", timestamp)
+	}
+	t := time.Unix(0, ms*int64(time.Millisecond))
+	if d := time.Since(t); d > v.window || d < -v.window {
+		return jerrors.Errorf("timestamp %s is out of the window %v", timestamp, v.window)
+	}
+
+	secretKey, err := v.credentials.SecretKey(accessKey)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+	expected := common.Sign(secretKey, accessKey, service, method, digest, timestamp, nonce)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return jerrors.New("signature mismatch")
+	}
+
+	return jerrors.Trace(v.seen(accessKey+"/"+nonce, t.Add(v.window)))
+}
+
+// seen records the nonce @key until @expiry, or returns an error if it has been seen
+func (v *verifier) seen(key string, expiry time.Time) error {
+	now := time.Now()
+
+	v.Lock()
+	defer v.Unlock()
+	if now.Sub(v.pruned) > v.window {
+		for k, e := range v.nonces {
+			if e.Before(now) {
+				delete(v.nonces, k)
+			}
+		}
+		v.pruned = now
+	}
+	if e, ok := v.nonces[key]; ok && now.Before(e) {
+		return jerrors.New("replayed request")
+	}
+	v.nonces[key] = expiry
+
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd || solaris
+// +build linux darwin dragonfly freebsd netbsd openbsd solaris
+
+package transport
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+var (
+	errUnexpectedRead = errors.New("unexpected read from an idle connection")
+)
+
+// checkConn peeks @conn without blocking. It returns io.EOF if the peer has closed
+// it, and errUnexpectedRead if there is unread data, such as an unsolicited event.
+func checkConn(conn net.Conn) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var checkErr error
+	err = rc.Read(func(fd uintptr) bool {
+		var buf [1]byte
+		n, _, err := syscall.Recvfrom(int(fd), buf[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		switch {
+		case n == 0 && err == nil:
+			checkErr = io.EOF
+		case 0 < n:
+			checkErr = errUnexpectedRead
+		case err == syscall.EAGAIN || err == syscall.EWOULDBLOCK:
+			checkErr = nil
+		default:
+			checkErr = err
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	return checkErr
+}
@@ -0,0 +1,521 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// cleartext http/2(h2c) transport for grpc/triple.
+// Every client Send starts a new http/2 stream whose response is returned by the next Recv.
+// Every server side http/2 stream is a Socket: its first Recv returns the request
+// headers and the first grpc message, and the following Recv returns the next
+// grpc message. The Package.Header of Send whose key is a grpc trailer is sent as trailer.
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+import (
+	log "github.com/AlexStocks/log4go"
+	jerrors "github.com/juju/errors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const (
+	GRPC_MESSAGE_HEADER_LENGTH = 5
+	DefaultGRPCMaxMessageSize  = 16 * 1024 * 1024
+)
+
+var (
+	// the headers which should be sent as http/2 trailers
+	http2Trailers = map[string]bool{
+		"Grpc-Status":                true,
+		"Grpc-Message":               true,
+		"Grpc-Status-Details-Bin":    true,
+		"Tri-Exception-Code":         true,
+		"Tri-Service-Exception-Code": true,
+	}
+
+	errHTTP2StreamClosed = jerrors.New("http2 stream closed")
+)
+
+// grpc-timeout: integer value followed by one of H, M, S, m, u, n
+func parseGRPCTimeout(s string) (time.Duration, bool) {
+	if len(s) < 2 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+
+	unit := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}[s[len(s)-1]]
+	if unit == 0 {
+		return 0, false
+	}
+
+	return time.Duration(n) * unit, true
+}
+
+//////////////////////////////////////////////
+// http2 transport client
+//////////////////////////////////////////////
+
+type http2Result struct {
+	rsp    *http.Response
+	err    error
+	cancel context.CancelFunc
+}
+
+type http2TransportClient struct {
+	t        *http2Transport
+	addr     string
+	conn     net.Conn
+	cc       *http2.ClientConn
+	dialOpts DialOptions
+	once     sync.Once
+	rspQ     chan http2Result
+}
+
+func initHTTP2TransportClient(t *http2Transport, addr string, conn net.Conn, cc *http2.ClientConn, opts DialOptions) *http2TransportClient {
+	return &http2TransportClient{
+		t:        t,
+		addr:     addr,
+		conn:     conn,
+		cc:       cc,
+		dialOpts: opts,
+		rspQ:     make(chan http2Result, 1),
+	}
+}
+
+// Package.Header["Path"] is the request path, default is DialOptions.Path.
+func (h *http2TransportClient) Send(p *Package) error {
+	path := h.dialOpts.Path
+	header := make(http.Header)
+	for k, v := range p.Header {
+		if k == "Path" {
+			path = v
+			continue
+		}
+		header.Set(k, v)
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if h.t.opts.Timeout > time.Duration(0) {
+		ctx, cancel = context.WithTimeout(ctx, h.t.opts.Timeout)
+	}
+	req := (&http.Request{
+		Method: "POST",
+		URL: &url.URL{
+			Scheme: "http",
+			Host:   h.addr,
+			Path:   path,
+		},
+		Proto:         "HTTP/2",
+		ProtoMajor:    2,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(p.Body)),
+		ContentLength: int64(len(p.Body)),
+		Host:          h.addr,
+	}).WithContext(ctx)
+
+	// the response is waited in Recv
+	go func() {
+		rsp, err := h.cc.RoundTrip(req)
+		h.rspQ <- http2Result{rsp: rsp, err: err, cancel: cancel}
+	}()
+
+	return nil
+}
+
+// Recv returns the whole response body and the response headers with the trailers.
+func (h *http2TransportClient) Recv(p *Package) error {
+	r, ok := <-h.rspQ
+	if !ok {
+		return io.EOF
+	}
+	defer r.cancel()
+	if r.err != nil {
+		return jerrors.Trace(r.err)
+	}
+	defer r.rsp.Body.Close()
+
+	b, err := ioutil.ReadAll(r.rsp.Body)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+	if r.rsp.StatusCode != http.StatusOK {
+		return jerrors.New(r.rsp.Status + ": " + string(b))
+	}
+
+	mr := &Package{
+		Header: make(map[string]string),
+		Body:   b,
+	}
+	for _, header := range []http.Header{r.rsp.Header, r.rsp.Trailer} {
+		for k, v := range header {
+			if len(v) > 0 {
+				mr.Header[k] = v[0]
+			} else {
+				mr.Header[k] = ""
+			}
+		}
+	}
+
+	*p = *mr
+	return nil
+}
+
+// Valid reports whether the http/2 connection can take new requests
+func (h *http2TransportClient) Valid() bool {
+	return h.cc.CanTakeNewRequest()
+}
+
+func (h *http2TransportClient) Close() error {
+	var err error
+	h.once.Do(func() {
+		h.cc.Close()
+		err = h.conn.Close()
+	})
+	return jerrors.Trace(err)
+}
+
+//////////////////////////////////////////////
+// http2 transport socket
+//////////////////////////////////////////////
+
+type http2TransportSocket struct {
+	t     *http2Transport
+	w     http.ResponseWriter
+	r     *http.Request
+	local net.Addr
+
+	sync.Mutex
+	first       bool
+	wroteHeader bool
+	trailer     map[string]string
+	closed      bool
+}
+
+func initHTTP2TransportSocket(t *http2Transport, w http.ResponseWriter, r *http.Request) *http2TransportSocket {
+	local, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return &http2TransportSocket{
+		t:       t,
+		w:       w,
+		r:       r,
+		local:   local,
+		first:   true,
+		trailer: make(map[string]string),
+	}
+}
+
+// a http/2 stream can not be reused
+func (h *http2TransportSocket) Reset(c net.Conn, release func()) {
+}
+
+// read the next grpc length-prefixed message
+func (h *http2TransportSocket) readMessage() ([]byte, error) {
+	var header [GRPC_MESSAGE_HEADER_LENGTH]byte
+
+	if _, err := io.ReadFull(h.r.Body, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, jerrors.Trace(err)
+		}
+		return nil, err // io.EOF should not be traced
+	}
+	l := binary.BigEndian.Uint32(header[1:])
+	if l > DefaultGRPCMaxMessageSize {
+		return nil, jerrors.Errorf("grpc message size %d is larger than %d", l, DefaultGRPCMaxMessageSize)
+	}
+	b := make([]byte, GRPC_MESSAGE_HEADER_LENGTH+int(l))
+	copy(b, header[:])
+	if _, err := io.ReadFull(h.r.Body, b[GRPC_MESSAGE_HEADER_LENGTH:]); err != nil {
+		return nil, jerrors.Trace(err)
+	}
+
+	return b, nil
+}
+
+func (h *http2TransportSocket) Recv(p *Package) error {
+	if p == nil {
+		return jerrors.New("message passed in is nil")
+	}
+
+	h.Lock()
+	first := h.first
+	h.first = false
+	closed := h.closed
+	h.Unlock()
+	if closed {
+		return io.EOF
+	}
+
+	b, err := h.readMessage()
+	if err != nil && !(first && err == io.EOF) {
+		return err
+	}
+
+	mr := &Package{
+		Header: make(map[string]string),
+		Body:   b,
+	}
+	if first {
+		for k, v := range h.r.Header {
+			if len(v) > 0 {
+				mr.Header[k] = v[0]
+			} else {
+				mr.Header[k] = ""
+			}
+		}
+		mr.Header["Path"] = strings.TrimPrefix(h.r.URL.Path, "/") // service/method
+		mr.Header["HttpMethod"] = h.r.Method
+		if timeout, ok := parseGRPCTimeout(h.r.Header.Get("Grpc-Timeout")); ok {
+			mr.Header["Timeout"] = strconv.FormatInt(int64(timeout), 10) // nanoseconds
+		}
+	}
+
+	*p = *mr
+	return nil
+}
+
+func (h *http2TransportSocket) writeHeader(header map[string]string) {
+	for k, v := range header {
+		h.w.Header().Set(k, v)
+	}
+	h.w.WriteHeader(http.StatusOK)
+	h.wroteHeader = true
+}
+
+func (h *http2TransportSocket) Send(p *Package) error {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.closed {
+		return errHTTP2StreamClosed
+	}
+
+	header := make(map[string]string)
+	for k, v := range p.Header {
+		if http2Trailers[http.CanonicalHeaderKey(k)] {
+			h.trailer[k] = v
+			continue
+		}
+		header[k] = v
+	}
+	if !h.wroteHeader {
+		if len(p.Body) == 0 { // maybe it is a trailers-only response
+			for k, v := range header {
+				h.w.Header().Set(k, v)
+			}
+			return nil
+		}
+		h.writeHeader(header)
+	}
+	if len(p.Body) == 0 {
+		return nil
+	}
+
+	if _, err := h.w.Write(p.Body); err != nil {
+		return jerrors.Trace(err)
+	}
+	if f, ok := h.w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	return nil
+}
+
+// Close finishes the response with the trailers
+func (h *http2TransportSocket) Close() error {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.closed {
+		return nil
+	}
+	h.closed = true
+
+	if !h.wroteHeader { // trailers-only
+		h.writeHeader(h.trailer)
+		return nil
+	}
+	for k, v := range h.trailer {
+		h.w.Header().Set(http.TrailerPrefix+k, v)
+	}
+
+	return nil
+}
+
+func (h *http2TransportSocket) ConnectionState() *tls.ConnectionState {
+	return h.r.TLS
+}
+
+func (h *http2TransportSocket) LocalAddr() net.Addr {
+	return h.local
+}
+
+func (h *http2TransportSocket) RemoteAddr() net.Addr {
+	addr, err := net.ResolveTCPAddr("tcp", h.r.RemoteAddr)
+	if err != nil {
+		return nil
+	}
+	return addr
+}
+
+//////////////////////////////////////////////
+// http2 transport listener
+//////////////////////////////////////////////
+
+type http2TransportListener struct {
+	t        *http2Transport
+	listener net.Listener
+	server   *http.Server
+	fn       func(Socket)
+}
+
+func initHTTP2TransportListener(t *http2Transport, listener net.Listener) *http2TransportListener {
+	h := &http2TransportListener{
+		t:        t,
+		listener: listener,
+	}
+	h.server = &http.Server{
+		Handler: h2c.NewHandler(http.HandlerFunc(h.serveHTTP), &http2.Server{}),
+	}
+
+	return h
+}
+
+func (h *http2TransportListener) Addr() string {
+	return h.listener.Addr().String()
+}
+
+func (h *http2TransportListener) Close() error {
+	return jerrors.Trace(h.server.Close())
+}
+
+func (h *http2TransportListener) Shutdown(ctx context.Context) error {
+	return jerrors.Trace(h.server.Shutdown(ctx))
+}
+
+func (h *http2TransportListener) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 {
+		http.Error(w, "http/2 is required", http.StatusHTTPVersionNotSupported)
+		return
+	}
+
+	sock := initHTTP2TransportSocket(h.t, w, r)
+	defer sock.Close()
+	h.fn(sock) // rpcServer:handlePkg 函数里面有一个defer语句段，保证了正常退出的情况下sock.Close()
+}
+
+// Accept serves every http/2 stream by @fn in the stream handler goroutine.
+func (h *http2TransportListener) Accept(fn func(Socket)) error {
+	h.fn = fn
+	err := serve(h.server, h.listener, h.t.opts.TLSConfig)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	log.Warn("http2: Serve(%s) = error:%v", h.Addr(), err)
+	return jerrors.Trace(err)
+}
+
+//////////////////////////////////////////////
+// http2 transport
+//////////////////////////////////////////////
+
+type http2Transport struct {
+	opts Options
+}
+
+func (h *http2Transport) Options() *Options {
+	return &h.opts
+}
+
+func (h *http2Transport) Dial(addr string, opts ...DialOption) (Client, error) {
+	dopts := DialOptions{
+		Timeout: DefaultDialTimeout,
+	}
+	for _, opt := range opts {
+		opt(&dopts)
+	}
+
+	var conf *tls.Config
+	if h.opts.TLSConfig != nil {
+		conf = withProtos(h.opts.TLSConfig, http2.NextProtoTLS)
+	}
+	conn, err := dial(conf, addr, dopts.Timeout)
+	if err != nil {
+		return nil, jerrors.Trace(err)
+	}
+
+	// prior knowledge h2c, or h2 over tls
+	cc, err := (&http2.Transport{AllowHTTP: true}).NewClientConn(conn)
+	if err != nil {
+		conn.Close()
+		return nil, jerrors.Trace(err)
+	}
+
+	return initHTTP2TransportClient(h, addr, conn, cc, dopts), nil
+}
+
+func (h *http2Transport) Listen(addr string, opts ...ListenOption) (Listener, error) {
+	var options ListenOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	fn := func(addr string) (net.Listener, error) {
+		return net.Listen("tcp", addr)
+	}
+	l, err := listen(addr, fn)
+	if err != nil {
+		return nil, jerrors.Trace(err)
+	}
+
+	return initHTTP2TransportListener(h, l), nil
+}
+
+func (h *http2Transport) String() string {
+	return "http2-transport"
+}
+
+func newHTTP2Transport(opts ...Option) Transport {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+	return &http2Transport{opts: options}
+}
@@ -18,6 +18,7 @@ package transport
 import (
 	"bufio"
 	"bytes"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -195,6 +196,16 @@ func (h *httpTransportClient) Recv(p *Package) error {
 	return nil
 }
 
+// Valid reports whether the keep-alive connection is open and has no pending response
+func (h *httpTransportClient) Valid() bool {
+	h.Lock()
+	defer h.Unlock()
+	if h.buff == nil || 0 < h.buff.Buffered() || 0 < len(h.bl) || 0 < len(h.r) {
+		return false
+	}
+	return checkConn(h.conn) == nil
+}
+
 func (h *httpTransportClient) Close() error {
 	var err error
 	h.once.Do(func() {
@@ -376,17 +387,18 @@ func (h *httpTransportSocket) Close() error {
 	log.Debug("httpTransportSocket.Close")
 	var err error
 	h.once.Do(func() {
-		h.Lock()
-		h.bufReader.Reset(nil)
-		h.bufReader = nil
-		h.rspBuf.Reset()
-		h.Unlock()
+		// the reader & buffer are not reset, because the server may close the socket
+		// at shutdown while Recv is blocked in the goroutine of the connection
 		h.release()
 		err = h.conn.Close()
 	})
 	return err
 }
 
+func (h *httpTransportSocket) ConnectionState() *tls.ConnectionState {
+	return connState(h.conn)
+}
+
 func (h *httpTransportSocket) LocalAddr() net.Addr {
 	return h.conn.LocalAddr()
 }
@@ -495,7 +507,7 @@ func (h *httpTransport) Dial(addr string, opts ...DialOption) (Client, error) {
 		opt(&dopts)
 	}
 
-	conn, err := net.DialTimeout("tcp", addr, dopts.Timeout)
+	conn, err := dial(h.opts.TLSConfig, addr, dopts.Timeout)
 	if err != nil {
 		return nil, jerrors.Trace(err)
 	}
@@ -574,6 +586,9 @@ func (h *httpTransport) Listen(addr string, opts ...ListenOption) (Listener, err
 	if err != nil {
 		return nil, err
 	}
+	if h.opts.TLSConfig != nil {
+		l = tls.NewListener(l, h.opts.TLSConfig)
+	}
 
 	return initHTTPTransportListener(h, l), nil
 }
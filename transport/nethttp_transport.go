@@ -0,0 +1,341 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// http/1.1 transport whose server side is built on net/http.Server, so that
+// browsers & curl can call jsonrpc services directly. The keep-alive connection
+// is managed by net/http, and every http request is a Socket whose first Recv
+// returns the request and whose Send writes the response.
+// The request body is decompressed if its Content-Encoding is gzip, and the
+// response body is compressed if the request accepts gzip.
+// CORS preflight OPTIONS request is answered by the listener.
+// The client side is the same as NewHTTPTransport.
+
+package transport
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+import (
+	log "github.com/AlexStocks/log4go"
+	jerrors "github.com/juju/errors"
+)
+
+const (
+	DefaultHTTPMaxBodySize = 16 * 1024 * 1024
+	DefaultCORSMaxAge      = "86400"
+)
+
+var (
+	errHTTPResponseSent = jerrors.New("http response has been sent")
+)
+
+//////////////////////////////////////////////
+// net/http transport socket
+//////////////////////////////////////////////
+
+type netHTTPTransportSocket struct {
+	w     http.ResponseWriter
+	r     *http.Request
+	body  []byte
+	local net.Addr
+
+	sync.Mutex
+	received bool
+	sent     bool
+}
+
+func initNetHTTPTransportSocket(w http.ResponseWriter, r *http.Request, body []byte) *netHTTPTransportSocket {
+	local, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return &netHTTPTransportSocket{
+		w:     w,
+		r:     r,
+		body:  body,
+		local: local,
+	}
+}
+
+// the connection is owned by net/http.Server
+func (h *netHTTPTransportSocket) Reset(c net.Conn, release func()) {
+}
+
+// Recv returns the http request at the first time, and then io.EOF.
+func (h *netHTTPTransportSocket) Recv(p *Package) error {
+	if p == nil {
+		return jerrors.New("message passed in is nil")
+	}
+
+	h.Lock()
+	received := h.received
+	h.received = true
+	h.Unlock()
+	if received {
+		return io.EOF
+	}
+
+	mr := &Package{
+		Header: make(map[string]string),
+		Body:   h.body,
+	}
+	for k, v := range h.r.Header {
+		if len(v) > 0 {
+			mr.Header[k] = v[0]
+		} else {
+			mr.Header[k] = ""
+		}
+	}
+	// 请求中的 Content-Type 可能带有 charset
+	if ct := mr.Header["Content-Type"]; len(ct) != 0 {
+		mr.Header["Content-Type"] = strings.TrimSpace(strings.Split(ct, ";")[0])
+	}
+	delete(mr.Header, "Content-Encoding")
+	mr.Header["Path"] = strings.TrimPrefix(h.r.URL.Path, "/") // to get service name
+	mr.Header["HttpMethod"] = h.r.Method
+
+	*p = *mr
+	return nil
+}
+
+func (h *netHTTPTransportSocket) Send(p *Package) error {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.sent {
+		return errHTTPResponseSent
+	}
+	h.sent = true
+
+	for k, v := range p.Header {
+		h.w.Header().Set(k, v)
+	}
+	if len(p.Body) == 0 { // such as jsonrpc notification
+		h.w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	if !strings.Contains(h.r.Header.Get("Accept-Encoding"), "gzip") {
+		_, err := h.w.Write(p.Body)
+		return jerrors.Trace(err)
+	}
+
+	h.w.Header().Set("Content-Encoding", "gzip")
+	h.w.Header().Add("Vary", "Accept-Encoding")
+	h.w.Header().Del("Content-Length")
+	zw := gzip.NewWriter(h.w)
+	if _, err := zw.Write(p.Body); err != nil {
+		return jerrors.Trace(err)
+	}
+
+	return jerrors.Trace(zw.Close())
+}
+
+// Close marks the response finished. The connection is kept alive by net/http.Server.
+func (h *netHTTPTransportSocket) Close() error {
+	h.Lock()
+	h.received = true
+	h.sent = true
+	h.Unlock()
+
+	return nil
+}
+
+func (h *netHTTPTransportSocket) ConnectionState() *tls.ConnectionState {
+	return h.r.TLS
+}
+
+func (h *netHTTPTransportSocket) LocalAddr() net.Addr {
+	return h.local
+}
+
+func (h *netHTTPTransportSocket) RemoteAddr() net.Addr {
+	addr, err := net.ResolveTCPAddr("tcp", h.r.RemoteAddr)
+	if err != nil {
+		return nil
+	}
+	return addr
+}
+
+//////////////////////////////////////////////
+// net/http transport listener
+//////////////////////////////////////////////
+
+type netHTTPTransportListener struct {
+	t        *netHTTPTransport
+	listener net.Listener
+	server   *http.Server
+	fn       func(Socket)
+}
+
+func initNetHTTPTransportListener(t *netHTTPTransport, listener net.Listener) *netHTTPTransportListener {
+	h := &netHTTPTransportListener{
+		t:        t,
+		listener: listener,
+	}
+	h.server = &http.Server{
+		Handler:      http.HandlerFunc(h.serveHTTP),
+		ReadTimeout:  t.opts.Timeout,
+		WriteTimeout: t.opts.Timeout,
+	}
+
+	return h
+}
+
+func (h *netHTTPTransportListener) Addr() string {
+	return h.listener.Addr().String()
+}
+
+func (h *netHTTPTransportListener) Close() error {
+	return jerrors.Trace(h.server.Close())
+}
+
+func (h *netHTTPTransportListener) Shutdown(ctx context.Context) error {
+	return jerrors.Trace(h.server.Shutdown(ctx))
+}
+
+// the request body decompressed
+func readHTTPBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	var body io.Reader = http.MaxBytesReader(w, r.Body, DefaultHTTPMaxBodySize)
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		defer zr.Close()
+		body = io.LimitReader(zr, DefaultHTTPMaxBodySize+1)
+	}
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, jerrors.Trace(err)
+	}
+	if len(b) > DefaultHTTPMaxBodySize {
+		return nil, jerrors.Errorf("http body size is larger than %d", DefaultHTTPMaxBodySize)
+	}
+
+	return b, nil
+}
+
+func (h *netHTTPTransportListener) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if origin := r.Header.Get("Origin"); len(origin) != 0 {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+	}
+
+	switch r.Method {
+	case http.MethodOptions: // cors preflight
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		if headers := r.Header.Get("Access-Control-Request-Headers"); len(headers) != 0 {
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+		}
+		w.Header().Set("Access-Control-Max-Age", DefaultCORSMaxAge)
+		w.WriteHeader(http.StatusNoContent)
+		return
+
+	case http.MethodPost:
+
+	default:
+		w.Header().Set("Allow", "POST, OPTIONS")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := readHTTPBody(w, r)
+	if err != nil {
+		log.Warn("readHTTPBody(remote:%s) = error:%v", r.RemoteAddr, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sock := initNetHTTPTransportSocket(w, r, body)
+	defer sock.Close()
+	h.fn(sock) // rpcServer:handlePkg 函数里面有一个defer语句段，保证了正常退出的情况下sock.Close()
+}
+
+// serve @listener by @server, by tls with h2 & http/1.1 if @conf is not nil
+func serve(server *http.Server, listener net.Listener, conf *tls.Config) error {
+	if conf == nil {
+		return server.Serve(listener)
+	}
+	server.TLSConfig = conf
+	return server.ServeTLS(listener, "", "")
+}
+
+// Accept serves every http request by @fn in the request handler goroutine.
+func (h *netHTTPTransportListener) Accept(fn func(Socket)) error {
+	h.fn = fn
+	err := serve(h.server, h.listener, h.t.opts.TLSConfig)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	log.Warn("net/http: Serve(%s) = error:%v", h.Addr(), err)
+	return jerrors.Trace(err)
+}
+
+//////////////////////////////////////////////
+// net/http transport
+//////////////////////////////////////////////
+
+type netHTTPTransport struct {
+	opts Options
+	ht   *httpTransport
+}
+
+func (h *netHTTPTransport) Options() *Options {
+	return &h.opts
+}
+
+func (h *netHTTPTransport) Dial(addr string, opts ...DialOption) (Client, error) {
+	return h.ht.Dial(addr, opts...)
+}
+
+func (h *netHTTPTransport) Listen(addr string, opts ...ListenOption) (Listener, error) {
+	var options ListenOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	fn := func(addr string) (net.Listener, error) {
+		return net.Listen("tcp", addr)
+	}
+	l, err := listen(addr, fn)
+	if err != nil {
+		return nil, jerrors.Trace(err)
+	}
+
+	return initNetHTTPTransportListener(h, l), nil
+}
+
+func (h *netHTTPTransport) String() string {
+	return "net-http-transport"
+}
+
+func newNetHTTPTransport(opts ...Option) Transport {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+	return &netHTTPTransport{
+		opts: options,
+		ht:   &httpTransport{opts: options},
+	}
+}
@@ -17,6 +17,7 @@ package transport
 
 import (
 	"context"
+	"crypto/tls"
 	"time"
 )
 
@@ -24,6 +25,8 @@ type Options struct {
 	Addrs []string
 	// Timeout sets the timeout for Send/Recv
 	Timeout time.Duration
+	// TLSConfig enables tls for both Dial and Listen, see LoadTLSConfig
+	TLSConfig *tls.Config
 
 	// Other options for implementations of the interface
 	// can be stored in a context
@@ -55,6 +58,14 @@ func Timeout(t time.Duration) Option {
 	}
 }
 
+// TLSConfig enables tls of the transport. The client certificates are verified
+// if @conf.ClientAuth is tls.RequireAndVerifyClientCert.
+func TLSConfig(conf *tls.Config) Option {
+	return func(o *Options) {
+		o.TLSConfig = conf
+	}
+}
+
 // Addrs to use for transport
 func Addrs(addrs ...string) Option {
 	return func(o *Options) {
@@ -16,6 +16,7 @@
 package transport
 
 import (
+	"crypto/tls"
 	"io"
 	"net"
 	"runtime"
@@ -72,7 +73,15 @@ func (t *tcpTransportSocket) Recv(p *Package) error {
 		defer common.SetNetConnTimeout(t.conn, 0)
 	}
 
-	t.conn.Read(p.Body)
+	buf := make([]byte, 4096)
+	bufLen, err := t.conn.Read(buf)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+	if bufLen == 0 {
+		return io.EOF
+	}
+	p.Body = append(p.Body, buf[:bufLen]...)
 
 	return nil
 }
@@ -99,6 +108,10 @@ func (t *tcpTransportSocket) Close() error {
 	return jerrors.Trace(t.conn.Close())
 }
 
+func (t *tcpTransportSocket) ConnectionState() *tls.ConnectionState {
+	return connState(t.conn)
+}
+
 func (t *tcpTransportSocket) LocalAddr() net.Addr {
 	return t.conn.LocalAddr()
 }
@@ -170,6 +183,16 @@ func (t *tcpTransportClient) Recv(p *Package) error {
 	return jerrors.Trace(t.read(p))
 }
 
+// Valid reports whether the connection is open and has no unread data
+func (t *tcpTransportClient) Valid() bool {
+	return checkConn(t.conn) == nil
+}
+
+// Pending reports whether the open connection has unread data, such as the readonly event
+func (t *tcpTransportClient) Pending() bool {
+	return checkConn(t.conn) == errUnexpectedRead
+}
+
 func (t *tcpTransportClient) Close() error {
 	return jerrors.Trace(t.conn.Close())
 }
@@ -276,7 +299,7 @@ func (t *tcpTransport) Dial(addr string, opts ...DialOption) (Client, error) {
 		opt(&dopts)
 	}
 
-	conn, err := net.DialTimeout("tcp", addr, dopts.Timeout)
+	conn, err := dial(t.opts.TLSConfig, addr, dopts.Timeout)
 	if err != nil {
 		return nil, jerrors.Trace(err)
 	}
@@ -297,6 +320,9 @@ func (t *tcpTransport) Listen(addr string, opts ...ListenOption) (Listener, erro
 	if err != nil {
 		return nil, jerrors.Trace(err)
 	}
+	if t.opts.TLSConfig != nil {
+		l = tls.NewListener(l, t.opts.TLSConfig)
+	}
 
 	return initTCPTransportListener(t, l), nil
 }
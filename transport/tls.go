@@ -0,0 +1,110 @@
+// Copyright (c) 2016 ~ 2018, Alex Stocks.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+// TLSFiles are the PEM files of the tls config
+type TLSFiles struct {
+	// CertFile & KeyFile are the certificate of the server, or that of the client in mtls
+	CertFile string
+	KeyFile  string
+	// CAFile verifies the certificate of the peer, the default is the system roots
+	CAFile string
+	// ServerName verifies the hostname of the server, the default is the dialed host
+	ServerName string
+	// ClientAuth requires and verifies the certificates of the clients by CAFile
+	ClientAuth bool
+}
+
+// LoadTLSConfig loads the tls config of both the client and the server from @files
+func LoadTLSConfig(files TLSFiles) (*tls.Config, error) {
+	conf := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: files.ServerName,
+	}
+
+	if len(files.CertFile) != 0 || len(files.KeyFile) != 0 {
+		cert, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+		if err != nil {
+			return nil, jerrors.Annotatef(err, "tls.LoadX509KeyPair(%s, %s)", files.CertFile, files.KeyFile)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(files.CAFile) != 0 {
+		ca, err := ioutil.ReadFile(files.CAFile)
+		if err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, jerrors.Errorf("no certificate in CA file %s", files.CAFile)
+		}
+		conf.RootCAs = pool
+		conf.ClientCAs = pool
+	}
+	if files.ClientAuth {
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return conf, nil
+}
+
+// SecureSocket is implemented by the socket which is served by tls.
+type SecureSocket interface {
+	// ConnectionState returns the tls state of the connection, nil if it is not a tls one.
+	ConnectionState() *tls.ConnectionState
+}
+
+// connState returns the tls state of @conn, nil if it is not a tls connection.
+func connState(conn net.Conn) *tls.ConnectionState {
+	c, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	state := c.ConnectionState()
+	return &state
+}
+
+// withProtos returns a copy of @conf whose application protocols are @protos
+func withProtos(conf *tls.Config, protos ...string) *tls.Config {
+	conf = conf.Clone()
+	conf.NextProtos = protos
+	return conf
+}
+
+// dial connects @addr, by tls if @conf is not nil
+func dial(conf *tls.Config, addr string, timeout time.Duration) (net.Conn, error) {
+	if conf == nil {
+		return net.DialTimeout("tcp", addr, timeout)
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, conf)
+	if err != nil {
+		return nil, jerrors.Annotatef(err, "tls.Dial(%s)", addr)
+	}
+	return conn, nil
+}
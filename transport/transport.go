@@ -16,6 +16,7 @@
 package transport
 
 import (
+	"context"
 	"net"
 	"time"
 )
@@ -53,6 +54,27 @@ type Listener interface {
 	Accept(func(Socket)) error
 }
 
+// Shutdowner is implemented by the listener which can stop gracefully, such as the
+// listeners built on net/http.Server, which close the idle connections and wait for
+// the active ones until @ctx is done.
+type Shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// Validator is implemented by the client whose connection can be checked before it
+// is reused by the connection pool.
+type Validator interface {
+	// Valid reports whether the connection is open and idle.
+	Valid() bool
+}
+
+// Pender is implemented by the client whose idle connection may receive the unsolicited
+// packages of the provider, such as the readonly event in graceful shutdown.
+type Pender interface {
+	// Pending reports whether the open connection has unread data.
+	Pending() bool
+}
+
 // Transport is an interface which is used for communication between
 // services. It uses socket send/recv semantics.
 type Transport interface {
@@ -81,6 +103,16 @@ func NewHTTPTransport(opts ...Option) Transport {
 	return newHTTPTransport(opts...)
 }
 
+// NewNetHTTPTransport returns a http/1.1 transport whose server is built on net/http.Server
+func NewNetHTTPTransport(opts ...Option) Transport {
+	return newNetHTTPTransport(opts...)
+}
+
 func NewTCPTransport(opts ...Option) Transport {
 	return newTCPTransport(opts...)
 }
+
+// NewHTTP2Transport returns a cleartext http/2 transport for grpc/triple
+func NewHTTP2Transport(opts ...Option) Transport {
+	return newHTTP2Transport(opts...)
+}